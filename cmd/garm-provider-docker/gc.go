@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/mercedes-benz/garm-provider-docker/internal/provider"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// runGC removes containers, volumes and networks of controllers and pools
+// that no longer exist.
+func runGC(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("gc", flag.ContinueOnError)
+	configPath := configPathFlag(flags)
+	var liveControllers, livePools stringSlice
+	flags.Var(&liveControllers, "live-controllers", "IDs of the controllers in use, comma-separated (repeatable)")
+	flags.Var(&livePools, "live-pools", "IDs of the pools in use, comma-separated (repeatable, default: keep all pools of live controllers)")
+	dryRun := flags.Bool("dry-run", false, "only print what would be removed")
+	output := flags.String("output", "table", "output format, \"table\" or \"json\"")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	cfg, err := config.NewConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := setupLogging(cfg.Log, "command", "gc"); err != nil {
+		return err
+	}
+
+	prov, err := provider.NewDockerProvider(cfg, "", "")
+	if err != nil {
+		return fmt.Errorf("failed to create docker provider: %w", err)
+	}
+
+	groups, err := prov.GarbageCollect(ctx, provider.GCOptions{
+		LiveControllers: splitIDs(liveControllers),
+		LivePools:       splitIDs(livePools),
+		DryRun:          *dryRun,
+	})
+	if err != nil {
+		return err
+	}
+
+	if *output == "json" {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(groups)
+	}
+	printGCGroups(groups, *dryRun)
+	return nil
+}
+
+// splitIDs splits comma-separated flag values and drops empty entries.
+func splitIDs(values []string) []string {
+	var ids []string
+	for _, v := range values {
+		for _, id := range strings.Split(v, ",") {
+			if id = strings.TrimSpace(id); id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
+
+func printGCGroups(groups []provider.GCGroup, dryRun bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CONTROLLER\tPOOL\tKIND\tNAME\tSTATUS")
+	for _, g := range groups {
+		for _, obj := range g.Objects {
+			status := "kept"
+			switch {
+			case !obj.Orphan:
+			case dryRun:
+				status = "would remove"
+			case obj.Error != "":
+				status = "failed: " + obj.Error
+			default:
+				status = "removed"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", g.ControllerID, g.PoolID, obj.Kind, obj.Name, status)
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/mercedes-benz/garm-provider-docker/internal/provider"
+)
+
+// runImageGC removes old runner images that no runner uses anymore.
+func runImageGC(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("image-gc", flag.ContinueOnError)
+	configPath := configPathFlag(flags)
+	var images stringSlice
+	flags.Var(&images, "images", "patterns of the runner image repositories to collect, comma-separated (repeatable, default: image_gc.images)")
+	retention := flags.Duration("retention", 0, "remove images created longer ago than this (default: image_gc.retention)")
+	keepDigests := flags.Int("keep-digests", 0, "number of newest images kept per repository (default: image_gc.keep_digests)")
+	dryRun := flags.Bool("dry-run", false, "only print what would be removed")
+	output := flags.String("output", "table", "output format, \"table\" or \"json\"")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	prov, err := loadProvider(*configPath, "image-gc", "", "")
+	if err != nil {
+		return err
+	}
+
+	opts := provider.ImageGCOptionsFromConfig(prov.Config)
+	if patterns := splitIDs(images); len(patterns) > 0 {
+		opts.Images = patterns
+	}
+	if *retention != 0 {
+		opts.Retention = *retention
+	}
+	if *keepDigests != 0 {
+		opts.KeepDigests = *keepDigests
+	}
+	if opts.Retention == 0 && opts.KeepDigests == 0 {
+		return fmt.Errorf("a retention or a number of images to keep is required")
+	}
+	opts.DryRun = *dryRun
+
+	report, err := prov.CollectImages(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	if *output == "json" {
+		return printJSON(report)
+	}
+	printImageGCReport(report, opts.DryRun)
+	return nil
+}
+
+func printImageGCReport(report provider.ImageGCReport, dryRun bool) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "REPOSITORY\tID\tCREATED\tSIZE\tSTATUS")
+	for _, img := range report.Images {
+		status := "kept"
+		switch {
+		case img.InUse:
+			status = "in use"
+		case img.Reason == "":
+		case dryRun:
+			status = "would remove: " + img.Reason
+		case img.Error != "":
+			status = "failed: " + img.Error
+		default:
+			status = "removed: " + img.Reason
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", strings.Join(img.Repositories, ","), shortImageID(img.ID),
+			units.HumanDuration(time.Since(img.Created))+" ago", units.HumanSize(float64(img.Size)), status)
+	}
+	w.Flush()
+
+	if dryRun {
+		fmt.Printf("would reclaim at least %s\n", units.HumanSize(float64(report.Reclaimed)))
+	} else {
+		fmt.Printf("reclaimed %s\n", units.HumanSize(float64(report.Reclaimed)))
+	}
+}
+
+// shortImageID returns the short form of an image ID, as shown by docker images.
+func shortImageID(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
@@ -2,16 +2,26 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"sort"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/cloudbase/garm-provider-common/execution"
+	"github.com/mercedes-benz/garm-provider-docker/internal/logging"
+	"github.com/mercedes-benz/garm-provider-docker/internal/metrics"
 	"github.com/mercedes-benz/garm-provider-docker/internal/provider"
+	"github.com/mercedes-benz/garm-provider-docker/internal/tracing"
 	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
 )
 
 var signals = []os.Signal{
@@ -19,14 +29,84 @@ var signals = []os.Signal{
 	syscall.SIGTERM,
 }
 
+// command is a subcommand of the binary.
+type command struct {
+	run  func(ctx context.Context, args []string) error
+	help string
+}
+
+// commands are run instead of the Garm execution mode when the binary is
+// invoked without the Garm environment, with their name as the first
+// argument.
+var commands = map[string]command{
+	"list":            {runList, "list the runners of a controller"},
+	"inspect":         {runInspect, "show a runner"},
+	"logs":            {runLogs, "print the logs of a runner"},
+	"create":          {runCreate, "create a runner the way Garm would"},
+	"delete":          {runDelete, "remove a runner with its sidecars and volumes"},
+	"reap":            {runReap, "remove exited and unregistered runners"},
+	"gc":              {runGC, "remove resources of dead controllers and pools"},
+	"image-gc":        {runImageGC, "remove old runner images"},
+	"validate-config": {runValidateConfig, "check the config file and probe the Docker daemon"},
+	"verify-audit":    {runVerifyAudit, "check the HMAC chain of the audit log"},
+	"socket-proxy":    {runSocketProxy, "serve the Docker socket proxy of a runner"},
+}
+
 func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), signals...)
 	defer stop()
 
-	if err := run(ctx); err != nil {
+	var err error
+	switch {
+	case os.Getenv("GARM_COMMAND") != "":
+		err = run(ctx)
+	case len(os.Args) > 1 && commands[os.Args[1]].run != nil:
+		err = commands[os.Args[1]].run(ctx, os.Args[2:])
+	default:
+		usage()
+		os.Exit(2)
+	}
+	if err != nil && !errors.Is(err, flag.ErrHelp) {
 		slog.Error("provider execution failed", "error", err)
+		closeLog()
 		os.Exit(1)
 	}
+	closeLog()
+}
+
+// usage explains how to run the binary outside of Garm.
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [flags]\n\n", filepath.Base(os.Args[0]))
+	fmt.Fprintln(os.Stderr, "Garm runs the provider with GARM_COMMAND and related environment variables set.")
+	fmt.Fprintln(os.Stderr, "Without them, one of these commands is run:")
+	fmt.Fprintln(os.Stderr)
+	w := tabwriter.NewWriter(os.Stderr, 0, 0, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%s\n", name, commands[name].help)
+	}
+	w.Flush()
+	fmt.Fprintf(os.Stderr, "\nRun \"%s <command> -h\" for the flags of a command.\n", filepath.Base(os.Args[0]))
+}
+
+// closeLog releases the log output set up by setupLogging.
+var closeLog = func() {}
+
+// setupLogging replaces the default logger with one configured by the log
+// section of the config, adding attrs to every line.
+func setupLogging(cfg config.LogConfig, attrs ...any) error {
+	logger, closer, err := logging.New(cfg, attrs...)
+	if err != nil {
+		return fmt.Errorf("failed to set up logging: %w", err)
+	}
+	slog.SetDefault(logger)
+	closeLog = func() { closer.Close() }
+	return nil
 }
 
 func run(ctx context.Context) error {
@@ -42,17 +122,67 @@ func run(ctx context.Context) error {
 		*configPath = executionEnv.ProviderConfigFile
 	}
 
-	if err := config.NewConfig(*configPath); err != nil {
+	cfg, err := config.NewConfig(*configPath)
+	if err != nil {
 		return fmt.Errorf("failed to load config: %w", err)
 	}
 
-	prov, err := provider.NewDockerProvider(executionEnv.ControllerID, executionEnv.PoolID)
+	instance := executionEnv.InstanceID
+	if executionEnv.Command == execution.CreateInstanceCommand {
+		instance = executionEnv.BootstrapParams.Name
+	}
+	err = setupLogging(cfg.Log,
+		"controller_id", executionEnv.ControllerID,
+		"pool_id", executionEnv.PoolID,
+		"instance", instance,
+		"command", string(executionEnv.Command),
+	)
+	if err != nil {
+		return err
+	}
+
+	if cfg.Tracing.Enabled() {
+		shutdown, err := tracing.Setup(ctx, cfg.Tracing)
+		if err != nil {
+			return fmt.Errorf("failed to set up tracing: %w", err)
+		}
+		defer func() {
+			// Flush spans even if ctx was cancelled, they explain why
+			flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), cfg.Tracing.Timeout)
+			defer cancel()
+			if err := shutdown(flushCtx); err != nil {
+				slog.Warn("failed to flush traces", "error", err)
+			}
+		}()
+	}
+	ctx, span := tracing.Tracer().Start(tracing.ContextFromEnv(ctx), string(executionEnv.Command))
+	defer span.End()
+	span.SetAttributes(
+		attribute.String("garm.controller_id", executionEnv.ControllerID),
+		attribute.String("garm.pool_id", executionEnv.PoolID),
+		attribute.String("garm.instance", instance),
+	)
+
+	prov, err := provider.NewDockerProvider(cfg, executionEnv.ControllerID, executionEnv.PoolID)
 	if err != nil {
 		return fmt.Errorf("failed to create docker provider: %w", err)
 	}
 
+	if cfg.Metrics.Enabled() {
+		prov.Metrics = metrics.NewRecorder()
+	}
+	start := time.Now()
 	result, err := execution.Run(ctx, prov, executionEnv)
+	if prov.Metrics != nil {
+		prov.Metrics.ObserveCommand(string(executionEnv.Command), time.Since(start), err)
+		// Emit even if ctx was cancelled, failures are the interesting part
+		if emitErr := metrics.Emit(context.WithoutCancel(ctx), cfg.Metrics, prov.Metrics, string(executionEnv.Command)); emitErr != nil {
+			slog.Warn("failed to emit metrics", "error", emitErr)
+		}
+	}
 	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
 		return fmt.Errorf("failed to run command: %w", err)
 	}
 
@@ -61,3 +191,9 @@ func run(ctx context.Context) error {
 	}
 	return nil
 }
+
+// configPathFlag registers the -configpath flag of a command. It defaults to
+// the config file Garm passes to the provider.
+func configPathFlag(flags *flag.FlagSet) *string {
+	return flags.String("configpath", os.Getenv("GARM_PROVIDER_CONFIG_FILE"), "path to the config file")
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/mercedes-benz/garm-provider-docker/internal/provider"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// operatorFlags are the flags shared by the operator commands, which call the
+// same Provider methods as Garm does, for debugging.
+type operatorFlags struct {
+	configPath   *string
+	controllerID *string
+	output       *string
+}
+
+func newOperatorFlags(flags *flag.FlagSet) operatorFlags {
+	return operatorFlags{
+		configPath:   configPathFlag(flags),
+		controllerID: controllerIDFlag(flags),
+		output:       flags.String("output", "table", "output format, \"table\" or \"json\""),
+	}
+}
+
+func controllerIDFlag(flags *flag.FlagSet) *string {
+	return flags.String("controller-id", os.Getenv("GARM_CONTROLLER_ID"), "ID of the Garm controller the runners belong to")
+}
+
+// provider loads the config and returns a provider for the controller.
+// requireController is set by commands that only act on the runners of one
+// controller.
+func (f operatorFlags) provider(command, poolID string, requireController bool) (*provider.Provider, error) {
+	if *f.output != "table" && *f.output != "json" {
+		return nil, fmt.Errorf("unknown output format %q", *f.output)
+	}
+	if requireController && *f.controllerID == "" {
+		return nil, fmt.Errorf("-controller-id or GARM_CONTROLLER_ID is required")
+	}
+	return loadProvider(*f.configPath, command, *f.controllerID, poolID)
+}
+
+// loadProvider loads the config and sets up logging for an operator command.
+func loadProvider(configPath, command, controllerID, poolID string) (*provider.Provider, error) {
+	cfg, err := config.NewConfig(configPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := setupLogging(cfg.Log, "controller_id", controllerID, "command", command); err != nil {
+		return nil, err
+	}
+	prov, err := provider.NewDockerProvider(cfg, controllerID, poolID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create docker provider: %w", err)
+	}
+	return prov, nil
+}
+
+// instanceArg returns the single instance name or ID a command takes.
+func instanceArg(flags *flag.FlagSet) (string, error) {
+	if flags.NArg() != 1 {
+		return "", fmt.Errorf("%s takes exactly one instance name or container ID", flags.Name())
+	}
+	return flags.Arg(0), nil
+}
+
+// runList lists the runners of a controller, optionally only of one pool.
+func runList(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("list", flag.ContinueOnError)
+	opts := newOperatorFlags(flags)
+	poolID := flags.String("pool", "", "only list runners of this pool")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	prov, err := opts.provider("list", *poolID, true)
+	if err != nil {
+		return err
+	}
+	instances, err := prov.ListInstances(ctx, *poolID)
+	if err != nil {
+		return err
+	}
+	if *opts.output == "json" {
+		return printJSON(instances)
+	}
+	return printInstances(instances...)
+}
+
+// runInspect shows a runner.
+func runInspect(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("inspect", flag.ContinueOnError)
+	opts := newOperatorFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	instance, err := instanceArg(flags)
+	if err != nil {
+		return err
+	}
+
+	prov, err := opts.provider("inspect", "", true)
+	if err != nil {
+		return err
+	}
+	if err := prov.CheckController(ctx, instance); err != nil {
+		return err
+	}
+	inst, err := prov.GetInstance(ctx, instance)
+	if err != nil {
+		return err
+	}
+	if *opts.output == "json" {
+		return printJSON(inst)
+	}
+	return printInstances(inst)
+}
+
+// runLogs prints the logs of a runner.
+func runLogs(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("logs", flag.ContinueOnError)
+	configPath := configPathFlag(flags)
+	controllerID := controllerIDFlag(flags)
+	follow := flags.Bool("follow", false, "keep printing new log lines")
+	tail := flags.String("tail", "all", "number of lines to show from the end of the logs")
+	timestamps := flags.Bool("timestamps", false, "show timestamps")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	instance, err := instanceArg(flags)
+	if err != nil {
+		return err
+	}
+
+	if *controllerID == "" {
+		return fmt.Errorf("-controller-id or GARM_CONTROLLER_ID is required")
+	}
+
+	prov, err := loadProvider(*configPath, "logs", *controllerID, "")
+	if err != nil {
+		return err
+	}
+	if err := prov.CheckController(ctx, instance); err != nil {
+		return err
+	}
+	return prov.Logs(ctx, instance, os.Stdout, provider.LogsOptions{
+		Follow:     *follow,
+		Tail:       *tail,
+		Timestamps: *timestamps,
+	})
+}
+
+// runDelete removes a runner with its sidecars and volumes.
+func runDelete(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("delete", flag.ContinueOnError)
+	opts := newOperatorFlags(flags)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	instance, err := instanceArg(flags)
+	if err != nil {
+		return err
+	}
+
+	prov, err := opts.provider("delete", "", true)
+	if err != nil {
+		return err
+	}
+	if err := prov.CheckController(ctx, instance); err != nil {
+		return err
+	}
+	if err := prov.DeleteInstance(ctx, instance); err != nil {
+		return err
+	}
+	if *opts.output == "json" {
+		return printJSON(map[string]string{"deleted": instance})
+	}
+	fmt.Printf("deleted %s\n", instance)
+	return nil
+}
+
+// runCreate creates a runner the way Garm would.
+func runCreate(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	opts := newOperatorFlags(flags)
+	image := flags.String("image", "", "runner image")
+	poolID := flags.String("pool", "", "ID of the pool the runner belongs to")
+	name := flags.String("name", "", "name of the runner (default: garm-debug-<random suffix>)")
+	repoURL := flags.String("repo-url", "", "URL of the GitHub repository, organization or enterprise to register with")
+	flavor := flags.String("flavor", "", "flavor of the pool")
+	osArch := flags.String("os-arch", string(params.Amd64), "OS architecture of the image")
+	extraSpecs := flags.String("extra-specs", "", "extra specs of the pool, as JSON")
+	var labels stringSlice
+	flags.Var(&labels, "labels", "runner labels, comma-separated (repeatable)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *image == "" || *poolID == "" || *repoURL == "" {
+		return fmt.Errorf("-image, -pool and -repo-url are required")
+	}
+	if *name == "" {
+		*name = "garm-debug-" + strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+
+	bootstrapParams := params.BootstrapInstance{
+		Name:    *name,
+		Image:   *image,
+		PoolID:  *poolID,
+		RepoURL: *repoURL,
+		Flavor:  *flavor,
+		OSType:  params.Linux,
+		OSArch:  params.OSArch(*osArch),
+		Labels:  splitIDs(labels),
+	}
+	if *extraSpecs != "" {
+		if !json.Valid([]byte(*extraSpecs)) {
+			return fmt.Errorf("-extra-specs is not valid JSON")
+		}
+		bootstrapParams.ExtraSpecs = json.RawMessage(*extraSpecs)
+	}
+
+	prov, err := opts.provider("create", *poolID, true)
+	if err != nil {
+		return err
+	}
+	inst, err := prov.CreateInstance(ctx, bootstrapParams)
+	if err != nil {
+		return err
+	}
+	if *opts.output == "json" {
+		return printJSON(inst)
+	}
+	return printInstances(inst)
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func printInstances(instances ...params.ProviderInstance) error {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tSTATUS\tCONTAINER\tOS\tADDRESSES\tFAULT")
+	for _, inst := range instances {
+		addrs := make([]string, 0, len(inst.Addresses))
+		for _, a := range inst.Addresses {
+			addrs = append(addrs, a.Address)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s/%s\t%s\t%s\n",
+			strings.TrimPrefix(inst.Name, "/"), inst.Status, shortID(inst.ProviderID),
+			inst.OSType, inst.OSArch, strings.Join(addrs, ","), inst.ProviderFault)
+	}
+	return w.Flush()
+}
+
+// shortID abbreviates a container ID like the Docker CLI does.
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
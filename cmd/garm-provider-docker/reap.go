@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/mercedes-benz/garm-provider-docker/internal/provider"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// runReap removes finished and stuck runner containers, once or continuously.
+func runReap(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("reap", flag.ContinueOnError)
+	configPath := configPathFlag(flags)
+	controllerID := flags.String("controller-id", os.Getenv("GARM_CONTROLLER_ID"), "only reap runners of this controller (default: all controllers)")
+	grace := flags.Duration("grace", 0, "remove runners that exited longer ago than this (default: reaper.exited_grace_period)")
+	registrationTimeout := flags.Duration("registration-timeout", 0, "remove runners that didn't register within this time (default: reaper.registration_timeout)")
+	dryRun := flags.Bool("dry-run", false, "only print what would be removed")
+	loop := flags.Bool("loop", false, "keep running and reap every reaper.interval")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.NewConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if err := setupLogging(cfg.Log, "controller_id", *controllerID, "command", "reap"); err != nil {
+		return err
+	}
+
+	opts, err := provider.ReapOptionsFromConfig(cfg)
+	if err != nil {
+		return err
+	}
+	if *grace != 0 {
+		opts.ExitedGracePeriod = *grace
+	}
+	if *registrationTimeout != 0 {
+		opts.RegistrationTimeout = *registrationTimeout
+	}
+	opts.DryRun = *dryRun
+
+	prov, err := provider.NewDockerProvider(cfg, *controllerID, "")
+	if err != nil {
+		return fmt.Errorf("failed to create docker provider: %w", err)
+	}
+
+	for {
+		results, err := prov.Reap(ctx, opts)
+		if err != nil {
+			if !*loop {
+				return err
+			}
+			slog.Error("reaper pass failed", "error", err)
+		} else {
+			printReapResults(results, opts.DryRun)
+		}
+
+		if !*loop {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(cfg.Reaper.Interval):
+		}
+	}
+}
+
+func printReapResults(results []provider.ReapResult, dryRun bool) {
+	if len(results) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tPOOL\tSTATE\tREASON\tACTION")
+	for _, r := range results {
+		action := "removed"
+		switch {
+		case dryRun:
+			action = "would remove"
+		case r.Error != "":
+			action = "failed: " + r.Error
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", r.Name, r.PoolID, r.State, r.Reason, action)
+	}
+	w.Flush()
+}
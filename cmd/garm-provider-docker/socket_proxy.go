@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/mercedes-benz/garm-provider-docker/internal/sockproxy"
+)
+
+// stringSlice is a flag that can be given multiple times.
+type stringSlice []string
+
+func (s *stringSlice) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// runSocketProxy serves the filtering Docker socket proxy. It runs inside the
+// proxy sidecar started for each runner in "socket" mode.
+func runSocketProxy(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("socket-proxy", flag.ContinueOnError)
+	listen := flags.String("listen", "", "path of the unix socket to listen on")
+	upstream := flags.String("upstream", "/var/run/docker.sock", "path of the Docker daemon socket")
+	owner := flags.String("owner", "", "name of the runner the proxy belongs to")
+	var allow stringSlice
+	flags.Var(&allow, "allow", "allowed endpoint as \"METHOD /path-regex\" (repeatable, replaces the defaults)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if *listen == "" || *owner == "" {
+		return fmt.Errorf("--listen and --owner are required")
+	}
+
+	ruleSpecs := sockproxy.DefaultRules
+	if len(allow) > 0 {
+		ruleSpecs = allow
+	}
+	rules, err := sockproxy.ParseRules(ruleSpecs)
+	if err != nil {
+		return err
+	}
+
+	return sockproxy.NewUnix(*upstream, *owner, rules).ListenAndServe(ctx, *listen)
+}
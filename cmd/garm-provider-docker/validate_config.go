@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/mercedes-benz/garm-provider-docker/internal/provider"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// runValidateConfig loads the config strictly and checks it against the
+// Docker daemon.
+func runValidateConfig(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("validate-config", flag.ContinueOnError)
+	configPath := configPathFlag(flags)
+	var images stringSlice
+	flags.Var(&images, "image", "runner images to check registry credentials for, comma-separated (repeatable)")
+	offline := flags.Bool("offline", false, "only check the config file, don't probe the Docker daemon")
+	printConfig := flags.Bool("print", false, "print the effective config, with secrets redacted, instead of probing the Docker daemon")
+	output := flags.String("output", "table", "output format, \"table\" or \"json\"")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+
+	cfg, err := config.NewConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("invalid config: %w", err)
+	}
+	if *printConfig {
+		data, err := cfg.Marshal()
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	if *offline {
+		fmt.Printf("%s: config is valid\n", *configPath)
+		return nil
+	}
+
+	prov, err := provider.NewDockerProvider(cfg, "", "")
+	if err != nil {
+		return fmt.Errorf("failed to create docker provider: %w", err)
+	}
+	checks := prov.CheckDaemon(ctx, splitIDs(images))
+
+	if *output == "json" {
+		if err := printJSON(checks); err != nil {
+			return err
+		}
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "CHECK\tSTATUS\tDETAIL")
+		for _, c := range checks {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Name, c.Status, c.Detail)
+		}
+		w.Flush()
+	}
+
+	for _, c := range checks {
+		if c.Status == provider.CheckFailed {
+			return fmt.Errorf("config %s failed daemon checks", *configPath)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/mercedes-benz/garm-provider-docker/internal/audit"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// runVerifyAudit checks the HMAC chain of the audit log.
+func runVerifyAudit(ctx context.Context, args []string) error {
+	flags := flag.NewFlagSet("verify-audit", flag.ContinueOnError)
+	configPath := configPathFlag(flags)
+	path := flags.String("path", "", "audit log to verify (default: audit.path)")
+	keyFile := flags.String("hmac-key-file", "", "file holding the HMAC key (default: audit.hmac_key_file)")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.NewConfig(*configPath)
+	if err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+	if *path == "" {
+		*path = cfg.Audit.Path
+	}
+	if *keyFile == "" {
+		*keyFile = cfg.Audit.HMACKeyFile
+	}
+	if *path == "" || *keyFile == "" {
+		return fmt.Errorf("an audit log and an hmac key file are required")
+	}
+
+	key, err := audit.ReadKey(*keyFile)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(*path)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	n, err := audit.Verify(f, key)
+	if err != nil {
+		return fmt.Errorf("audit log %s failed verification after %d valid entries: %w", *path, n, err)
+	}
+	fmt.Printf("%s: %d entries verified\n", *path, n)
+	return nil
+}
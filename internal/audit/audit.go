@@ -0,0 +1,314 @@
+// Package audit writes an append-only JSON-lines log of the mutating actions
+// of the provider: who created, started, stopped or removed which runner, with
+// which image and host config. Entries can be chained with an HMAC so that
+// editing or removing them is detectable.
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/mercedes-benz/garm-provider-docker/internal/filelock"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// Actions that are audited.
+const (
+	ActionCreateInstance     = "CreateInstance"
+	ActionDeleteInstance     = "DeleteInstance"
+	ActionStop               = "Stop"
+	ActionStart              = "Start"
+	ActionRemoveAllInstances = "RemoveAllInstances"
+	ActionReap               = "Reap"
+	ActionGarbageCollect     = "GarbageCollect"
+)
+
+// Outcomes of an action.
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+)
+
+// Entry is a line of the audit log.
+type Entry struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// Env is the Garm execution environment of the provider call.
+	Env Env `json:"env"`
+	// User and Host the provider ran as and on.
+	User         string      `json:"user,omitempty"`
+	Host         string      `json:"host,omitempty"`
+	Instance     string      `json:"instance,omitempty"`
+	ContainerID  string      `json:"container_id,omitempty"`
+	Image        string      `json:"image,omitempty"`
+	ImageID      string      `json:"image_id,omitempty"`
+	ImageDigests []string    `json:"image_digests,omitempty"`
+	HostConfig   *HostConfig `json:"host_config,omitempty"`
+	Outcome      string      `json:"outcome"`
+	Error        string      `json:"error,omitempty"`
+	// HMAC chains the entry to the previous one, if a key is configured.
+	HMAC string `json:"hmac,omitempty"`
+}
+
+// Env is the part of the Garm execution environment that identifies a call.
+// Bootstrap params are left out, as they hold the runner's registration token.
+type Env struct {
+	Command      string `json:"command,omitempty"`
+	ControllerID string `json:"controller_id,omitempty"`
+	PoolID       string `json:"pool_id,omitempty"`
+	InstanceID   string `json:"instance_id,omitempty"`
+}
+
+// HostConfig summarizes the security relevant parts of a container's host
+// config.
+type HostConfig struct {
+	Runtime        string   `json:"runtime,omitempty"`
+	NetworkMode    string   `json:"network_mode,omitempty"`
+	Privileged     bool     `json:"privileged"`
+	ReadonlyRootfs bool     `json:"readonly_rootfs,omitempty"`
+	UsernsMode     string   `json:"userns_mode,omitempty"`
+	CapAdd         []string `json:"cap_add,omitempty"`
+	CapDrop        []string `json:"cap_drop,omitempty"`
+	SecurityOpt    []string `json:"security_opt,omitempty"`
+	Binds          []string `json:"binds,omitempty"`
+	Mounts         []Mount  `json:"mounts,omitempty"`
+}
+
+// Mount is a mount of a container.
+type Mount struct {
+	Type     string `json:"type"`
+	Source   string `json:"source,omitempty"`
+	Target   string `json:"target"`
+	ReadOnly bool   `json:"read_only,omitempty"`
+}
+
+// NewEntry returns an entry for an action, filled in from the environment
+// of the process.
+func NewEntry(action, instance string) Entry {
+	e := Entry{
+		Action:   action,
+		Instance: instance,
+		Env: Env{
+			Command:      os.Getenv("GARM_COMMAND"),
+			ControllerID: os.Getenv("GARM_CONTROLLER_ID"),
+			PoolID:       os.Getenv("GARM_POOL_ID"),
+			InstanceID:   os.Getenv("GARM_INSTANCE_ID"),
+		},
+	}
+	if u, err := user.Current(); err == nil {
+		e.User = u.Username
+	}
+	e.Host, _ = os.Hostname()
+	return e
+}
+
+// SetOutcome records the result of the action.
+func (e *Entry) SetOutcome(err error) {
+	e.Outcome = OutcomeSuccess
+	if err != nil {
+		e.Outcome = OutcomeFailure
+		e.Error = err.Error()
+	}
+}
+
+// SummarizeHostConfig returns the audited parts of a host config, or nil.
+func SummarizeHostConfig(h *container.HostConfig) *HostConfig {
+	if h == nil {
+		return nil
+	}
+	s := &HostConfig{
+		Runtime:        h.Runtime,
+		NetworkMode:    string(h.NetworkMode),
+		Privileged:     h.Privileged,
+		ReadonlyRootfs: h.ReadonlyRootfs,
+		UsernsMode:     string(h.UsernsMode),
+		CapAdd:         h.CapAdd,
+		CapDrop:        h.CapDrop,
+		SecurityOpt:    h.SecurityOpt,
+		Binds:          h.Binds,
+	}
+	for _, m := range h.Mounts {
+		s.Mounts = append(s.Mounts, Mount{Type: string(m.Type), Source: m.Source, Target: m.Target, ReadOnly: m.ReadOnly})
+	}
+	return s
+}
+
+// Log appends entries to an audit log file.
+type Log struct {
+	path string
+	key  []byte
+}
+
+// New returns the audit log of the config, or nil if auditing is disabled.
+func New(cfg config.AuditConfig) (*Log, error) {
+	if !cfg.Enabled() {
+		return nil, nil
+	}
+	l := &Log{path: cfg.Path}
+	if cfg.HMACKeyFile != "" {
+		key, err := ReadKey(cfg.HMACKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		l.key = key
+	}
+	return l, nil
+}
+
+// ReadKey reads an HMAC key from a file, ignoring surrounding whitespace.
+func ReadKey(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audit hmac key: %w", err)
+	}
+	key := bytes.TrimSpace(data)
+	if len(key) == 0 {
+		return nil, fmt.Errorf("audit hmac key file %s is empty", path)
+	}
+	return key, nil
+}
+
+// Write appends an entry to the log. Concurrent provider processes are
+// serialized with a lock file next to it, which also keeps the HMAC chain
+// intact.
+func (l *Log) Write(e Entry) error {
+	unlock, err := filelock.Lock(l.path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	e.Time = e.Time.UTC()
+	e.HMAC = ""
+	if l.key != nil {
+		prev, err := lastHMAC(l.path)
+		if err != nil {
+			return err
+		}
+		if e.HMAC, err = sign(l.key, prev, e); err != nil {
+			return err
+		}
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open audit log: %w", err)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write audit log: %w", err)
+	}
+	return f.Close()
+}
+
+// sign returns the HMAC of an entry, without its own HMAC, chained to the
+// HMAC of the previous entry.
+func sign(key []byte, prev string, e Entry) (string, error) {
+	e.HMAC = ""
+	data, err := json.Marshal(e)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode audit entry: %w", err)
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(prev))
+	mac.Write([]byte{'\n'})
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// lastHMAC returns the HMAC of the last entry of the log at path, or "" if
+// there is none.
+func lastHMAC(path string) (string, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to open audit log: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to read audit log: %w", err)
+	}
+	// Read backwards in growing chunks until the last line is complete
+	size := info.Size()
+	for chunk := int64(64 << 10); ; chunk *= 2 {
+		if chunk > size {
+			chunk = size
+		}
+		buf := make([]byte, chunk)
+		if _, err := f.ReadAt(buf, size-chunk); err != nil && err != io.EOF {
+			return "", fmt.Errorf("failed to read audit log: %w", err)
+		}
+		buf = bytes.TrimRight(buf, "\n")
+		i := bytes.LastIndexByte(buf, '\n')
+		if i < 0 && chunk < size {
+			continue
+		}
+		last := buf[i+1:]
+		if len(last) == 0 {
+			return "", nil
+		}
+		var e Entry
+		if err := json.Unmarshal(last, &e); err != nil {
+			return "", fmt.Errorf("failed to decode last audit entry: %w", err)
+		}
+		return e.HMAC, nil
+	}
+}
+
+// Verify checks the HMAC chain of an audit log and returns the number of
+// entries checked. It fails at the first entry that was modified, inserted or
+// follows a removed one.
+func Verify(r io.Reader, key []byte) (int, error) {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64<<10), 16<<20)
+	prev := ""
+	n := 0
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		n++
+		var e Entry
+		if err := json.Unmarshal(line, &e); err != nil {
+			return n - 1, fmt.Errorf("entry %d: invalid JSON: %w", n, err)
+		}
+		want, err := sign(key, prev, e)
+		if err != nil {
+			return n - 1, err
+		}
+		if e.HMAC == "" || !hmac.Equal([]byte(e.HMAC), []byte(want)) {
+			return n - 1, fmt.Errorf("entry %d (%s %s at %s): hmac mismatch", n, e.Action, e.Instance, e.Time.Format(time.RFC3339))
+		}
+		prev = e.HMAC
+	}
+	if err := scanner.Err(); err != nil {
+		return n, fmt.Errorf("failed to read audit log: %w", err)
+	}
+	return n, nil
+}
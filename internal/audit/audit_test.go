@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestLog(t *testing.T) (*Log, string, []byte) {
+	dir := t.TempDir()
+	keyFile := filepath.Join(dir, "key")
+	require.NoError(t, os.WriteFile(keyFile, []byte("s3cret\n"), 0o600))
+	path := filepath.Join(dir, "audit.jsonl")
+	l, err := New(config.AuditConfig{Path: path, HMACKeyFile: keyFile})
+	require.NoError(t, err)
+	return l, path, []byte("s3cret")
+}
+
+func TestWriteAndVerify(t *testing.T) {
+	l, path, key := newTestLog(t)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			e := NewEntry(ActionCreateInstance, fmt.Sprintf("runner-%d", i))
+			e.HostConfig = SummarizeHostConfig(&container.HostConfig{
+				Privileged: true,
+				Binds:      []string{"/cache:/cache:ro"},
+				Mounts:     []mount.Mount{{Type: mount.TypeTmpfs, Target: "/tmp"}},
+			})
+			e.SetOutcome(nil)
+			assert.NoError(t, l.Write(e))
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 20, strings.Count(string(data), "\n"))
+	assert.Contains(t, string(data), `"privileged":true`)
+	assert.Contains(t, string(data), `"mounts":[{"type":"tmpfs","target":"/tmp"}]`)
+
+	n, err := Verify(bytes.NewReader(data), key)
+	require.NoError(t, err)
+	assert.Equal(t, 20, n)
+
+	_, err = Verify(bytes.NewReader(data), []byte("wrong"))
+	assert.ErrorContains(t, err, "entry 1")
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	l, path, key := newTestLog(t)
+	for _, name := range []string{"a", "b", "c"} {
+		e := NewEntry(ActionDeleteInstance, name)
+		e.SetOutcome(errors.New("boom"))
+		require.NoError(t, l.Write(e))
+	}
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+
+	edited := strings.Replace(string(data), `"instance":"b"`, `"instance":"x"`, 1)
+	n, err := Verify(strings.NewReader(edited), key)
+	assert.ErrorContains(t, err, "entry 2")
+	assert.Equal(t, 1, n)
+
+	removed := lines[0] + lines[2]
+	_, err = Verify(strings.NewReader(removed), key)
+	assert.ErrorContains(t, err, "entry 2")
+}
+
+func TestNewDisabled(t *testing.T) {
+	l, err := New(config.AuditConfig{})
+	assert.NoError(t, err)
+	assert.Nil(t, l)
+}
@@ -0,0 +1,149 @@
+// Package dind implements the strategies that give runner containers access
+// to a Docker daemon.
+package dind
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/mercedes-benz/garm-provider-docker/internal/sockproxy"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// SocketProxyDir is where the per-runner proxy socket volume is mounted in
+// both the runner and the proxy sidecar.
+const SocketProxyDir = "/run/garm-docker-proxy"
+
+// ImagePrefixEnv tells jobs behind the socket proxy the repository prefix
+// their image tags must have.
+const ImagePrefixEnv = "GARM_DOCKER_IMAGE_PREFIX"
+
+// SocketProxyName returns the name of the proxy sidecar and its socket volume
+// for the given runner.
+func SocketProxyName(instanceName string) string {
+	return instanceName + "-docker-proxy"
+}
+
+// Strategy adjusts a runner container for one Docker-in-Docker mode.
+type Strategy interface {
+	// Apply adjusts the container and host config of a runner before it is created.
+	Apply(containerConfig *container.Config, hostConfig *container.HostConfig)
+	// DataRoot returns the path of the volume that holds the inner Docker
+	// daemon's data root, or an empty string if the strategy has none.
+	DataRoot() string
+}
+
+// New returns the strategy for the configured dind_mode, for the runner with
+// the given name.
+func New(cfg *config.ProviderConfig, instanceName string) (Strategy, error) {
+	switch cfg.DinDMode {
+	case config.DinDModeSysbox:
+		return sysbox{}, nil
+	case config.DinDModePrivileged:
+		return privileged{}, nil
+	case config.DinDModeRootless:
+		return rootless{dataRoot: cfg.RootlessDataRoot}, nil
+	case config.DinDModeSocket:
+		if cfg.SocketProxy.Enabled {
+			return socket{proxyVolume: SocketProxyName(instanceName), imagePrefix: sockproxy.ImagePrefix(instanceName)}, nil
+		}
+		return socket{hostPath: cfg.DockerSocketPath}, nil
+	case config.DinDModeNone:
+		return none{}, nil
+	default:
+		return nil, fmt.Errorf("unknown dind_mode %q", cfg.DinDMode)
+	}
+}
+
+// sysbox relies on the Sysbox runtime to run an unprivileged inner daemon.
+// Sysbox takes care of /var/lib/docker on its own.
+type sysbox struct{}
+
+func (sysbox) Apply(_ *container.Config, hostConfig *container.HostConfig) {
+	hostConfig.Runtime = config.SysboxRuntime
+}
+
+func (sysbox) DataRoot() string { return "" }
+
+// privileged runs the inner daemon in a privileged container.
+type privileged struct{}
+
+func (privileged) Apply(_ *container.Config, hostConfig *container.HostConfig) {
+	hostConfig.Privileged = true
+	// Use host cgroup namespace so systemd/KIND can work properly
+	hostConfig.CgroupnsMode = container.CgroupnsModeHost
+	// Mount /var/lib/docker as a volume so inner Docker can use overlayfs
+	// (avoids overlay-on-overlay issues when host uses overlayfs)
+	hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+		Type:   mount.TypeVolume,
+		Target: "/var/lib/docker",
+		// Anonymous volume - will be cleaned up with RemoveVolumes: true
+	})
+}
+
+func (privileged) DataRoot() string { return "/var/lib/docker" }
+
+// rootless runs a rootless inner daemon, which uses user namespaces instead
+// of a privileged container. The image has to ship a rootless dockerd, like
+// docker:dind-rootless does.
+type rootless struct {
+	dataRoot string
+}
+
+func (r rootless) Apply(_ *container.Config, hostConfig *container.HostConfig) {
+	// rootlesskit needs to set up its own mounts and namespaces, which the
+	// default seccomp and AppArmor profiles and masked /proc paths prevent.
+	hostConfig.SecurityOpt = append(hostConfig.SecurityOpt,
+		"seccomp=unconfined",
+		"apparmor=unconfined",
+		"systempaths=unconfined",
+	)
+	// fuse-overlayfs is the storage driver of choice without a privileged container
+	hostConfig.Devices = append(hostConfig.Devices, container.DeviceMapping{
+		PathOnHost:        "/dev/fuse",
+		PathInContainer:   "/dev/fuse",
+		CgroupPermissions: "rwm",
+	})
+	hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+		Type:   mount.TypeVolume,
+		Target: r.dataRoot,
+	})
+}
+
+func (r rootless) DataRoot() string { return r.dataRoot }
+
+// socket gives the runner the host Docker daemon, either by binding the host
+// socket or through the socket of its proxy sidecar.
+type socket struct {
+	hostPath    string
+	proxyVolume string
+	imagePrefix string
+}
+
+func (s socket) Apply(containerConfig *container.Config, hostConfig *container.HostConfig) {
+	if s.proxyVolume == "" {
+		hostConfig.Binds = append(hostConfig.Binds, s.hostPath+":/var/run/docker.sock")
+		return
+	}
+	hostConfig.Mounts = append(hostConfig.Mounts, mount.Mount{
+		Type:     mount.TypeVolume,
+		Source:   s.proxyVolume,
+		Target:   SocketProxyDir,
+		ReadOnly: true,
+	})
+	containerConfig.Env = append(containerConfig.Env,
+		"DOCKER_HOST=unix://"+SocketProxyDir+"/docker.sock",
+		// The proxy doesn't allow BuildKit's session endpoints
+		"DOCKER_BUILDKIT=0",
+		ImagePrefixEnv+"="+s.imagePrefix)
+}
+
+func (socket) DataRoot() string { return "" }
+
+// none gives the runner no access to Docker.
+type none struct{}
+
+func (none) Apply(*container.Config, *container.HostConfig) {}
+
+func (none) DataRoot() string { return "" }
@@ -0,0 +1,97 @@
+package dind
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrategies(t *testing.T) {
+	cfg := &config.ProviderConfig{
+		DockerSocketPath: "/run/docker.sock",
+		RootlessDataRoot: "/home/rootless/.local/share/docker",
+	}
+
+	tests := []struct {
+		mode     config.DinDMode
+		dataRoot string
+		check    func(t *testing.T, h *container.HostConfig)
+	}{
+		{
+			mode: config.DinDModeSysbox,
+			check: func(t *testing.T, h *container.HostConfig) {
+				assert.Equal(t, "sysbox-runc", h.Runtime)
+				assert.False(t, h.Privileged)
+			},
+		},
+		{
+			mode:     config.DinDModePrivileged,
+			dataRoot: "/var/lib/docker",
+			check: func(t *testing.T, h *container.HostConfig) {
+				assert.True(t, h.Privileged)
+				assert.Equal(t, container.CgroupnsModeHost, h.CgroupnsMode)
+				assert.Equal(t, []mount.Mount{{Type: mount.TypeVolume, Target: "/var/lib/docker"}}, h.Mounts)
+			},
+		},
+		{
+			mode:     config.DinDModeRootless,
+			dataRoot: "/home/rootless/.local/share/docker",
+			check: func(t *testing.T, h *container.HostConfig) {
+				assert.False(t, h.Privileged)
+				assert.Contains(t, h.SecurityOpt, "seccomp=unconfined")
+				assert.Equal(t, "/dev/fuse", h.Devices[0].PathOnHost)
+				assert.Equal(t, "/home/rootless/.local/share/docker", h.Mounts[0].Target)
+			},
+		},
+		{
+			mode: config.DinDModeSocket,
+			check: func(t *testing.T, h *container.HostConfig) {
+				assert.Equal(t, []string{"/run/docker.sock:/var/run/docker.sock"}, h.Binds)
+			},
+		},
+		{
+			mode: config.DinDModeNone,
+			check: func(t *testing.T, h *container.HostConfig) {
+				assert.Equal(t, &container.HostConfig{}, h)
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			cfg.DinDMode = tc.mode
+			strategy, err := New(cfg, "runner")
+			require.NoError(t, err)
+
+			hostConfig := &container.HostConfig{}
+			strategy.Apply(&container.Config{}, hostConfig)
+			tc.check(t, hostConfig)
+			assert.Equal(t, tc.dataRoot, strategy.DataRoot())
+		})
+	}
+
+	cfg.DinDMode = "docker-in-docker"
+	_, err := New(cfg, "runner")
+	assert.Error(t, err)
+}
+
+func TestSocketStrategyWithProxy(t *testing.T) {
+	cfg := &config.ProviderConfig{
+		DinDMode:    config.DinDModeSocket,
+		SocketProxy: config.SocketProxyConfig{Enabled: true},
+	}
+	strategy, err := New(cfg, "runner")
+	require.NoError(t, err)
+
+	containerConfig := &container.Config{}
+	hostConfig := &container.HostConfig{}
+	strategy.Apply(containerConfig, hostConfig)
+
+	assert.Empty(t, hostConfig.Binds)
+	assert.Equal(t, []mount.Mount{{Type: mount.TypeVolume, Source: "runner-docker-proxy", Target: SocketProxyDir, ReadOnly: true}}, hostConfig.Mounts)
+	assert.Equal(t, []string{"DOCKER_HOST=unix:///run/garm-docker-proxy/docker.sock", "DOCKER_BUILDKIT=0", "GARM_DOCKER_IMAGE_PREFIX=runner/"}, containerConfig.Env)
+}
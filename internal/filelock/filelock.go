@@ -0,0 +1,15 @@
+// Package filelock serializes access to files shared by concurrent provider
+// processes, using advisory locks.
+package filelock
+
+// Lock takes an exclusive lock on path, creating the file if needed, and
+// blocks until it gets it. The returned function releases the lock.
+func Lock(path string) (func(), error) {
+	return lock(path, true)
+}
+
+// LockShared takes a shared lock on path, which any number of processes can
+// hold at once, but not together with an exclusive lock.
+func LockShared(path string) (func(), error) {
+	return lock(path, false)
+}
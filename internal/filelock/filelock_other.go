@@ -0,0 +1,12 @@
+//go:build !unix && !windows
+
+package filelock
+
+import (
+	"errors"
+	"fmt"
+)
+
+func lock(path string, _ bool) (func(), error) {
+	return nil, fmt.Errorf("failed to lock %s: %w", path, errors.ErrUnsupported)
+}
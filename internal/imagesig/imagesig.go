@@ -0,0 +1,197 @@
+// Package imagesig verifies cosign signatures of container images against a
+// public key.
+//
+// cosign stores the signature of an image with digest "sha256:<hex>" as the
+// tag "sha256-<hex>.sig" in the image's repository. Each layer of that
+// manifest is a simple signing payload naming the signed digest, with the
+// base64 signature of the payload in an annotation. Verification only talks
+// to the registry: there is no transparency log or certificate lookup, as
+// with "cosign verify --key <key> --insecure-ignore-tlog".
+package imagesig
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+const (
+	// SimpleSigningMediaType is the media type of cosign signature payloads.
+	SimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// SignatureAnnotation holds the base64 signature of a payload layer.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+	// SignatureType is the type of cosign simple signing payloads.
+	SignatureType = "cosign container image signature"
+)
+
+// ErrNoSignature is returned if an image has no signature at all.
+var ErrNoSignature = errors.New("no signature found")
+
+// CredentialsFunc returns the registry credentials for an image, or an empty
+// AuthConfig if there are none.
+type CredentialsFunc func(image string) (registry.AuthConfig, error)
+
+// Verifier checks image signatures against a public key.
+type Verifier struct {
+	key         crypto.PublicKey
+	insecure    []string
+	credentials CredentialsFunc
+	client      *http.Client
+}
+
+// New returns a verifier for the configured public key.
+func New(cfg config.ImageSignatureConfig, credentials CredentialsFunc) (*Verifier, error) {
+	key, err := LoadPublicKey(cfg.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Verifier{
+		key:         key,
+		insecure:    cfg.InsecureRegistries,
+		credentials: credentials,
+		client:      &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+// LoadPublicKey reads a PEM-encoded ECDSA, RSA or Ed25519 public key, as
+// written by "cosign generate-key-pair".
+func LoadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read public key: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, fmt.Errorf("%s does not contain a PEM public key", path)
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse public key %s: %w", path, err)
+	}
+	switch key.(type) {
+	case *ecdsa.PublicKey, *rsa.PublicKey, ed25519.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T in %s", key, path)
+	}
+}
+
+// payload is a cosign simple signing payload.
+type payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// Verify checks that the image with the given digest in repository name
+// carries at least one signature made with the verifier's key.
+func (v *Verifier) Verify(ctx context.Context, name, digest string) error {
+	named, err := reference.ParseNormalizedNamed(name)
+	if err != nil {
+		return fmt.Errorf("invalid repository %q: %w", name, err)
+	}
+	algorithm, hex, ok := strings.Cut(digest, ":")
+	if !ok || algorithm != "sha256" {
+		return fmt.Errorf("unsupported digest %q", digest)
+	}
+
+	auth, err := v.credentials(named.Name())
+	if err != nil {
+		return fmt.Errorf("failed to get registry credentials: %w", err)
+	}
+	reg := newRegistryClient(v.client, named, auth, v.insecure)
+
+	m, err := reg.manifest(ctx, "sha256-"+hex+".sig")
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, layer := range m.Layers {
+		if layer.MediaType != SimpleSigningMediaType {
+			continue
+		}
+		if err := v.verifyLayer(ctx, reg, layer, digest); err != nil {
+			errs = append(errs, fmt.Errorf("layer %s: %w", layer.Digest, err))
+			continue
+		}
+		return nil
+	}
+	if len(errs) == 0 {
+		return fmt.Errorf("%w for %s@%s", ErrNoSignature, named.Name(), digest)
+	}
+	return fmt.Errorf("no valid signature for %s@%s: %w", named.Name(), digest, errors.Join(errs...))
+}
+
+// verifyLayer checks one signature layer for the given image digest.
+func (v *Verifier) verifyLayer(ctx context.Context, reg *registryClient, layer descriptor, digest string) error {
+	sig, err := base64.StdEncoding.DecodeString(layer.Annotations[SignatureAnnotation])
+	if err != nil || len(sig) == 0 {
+		return fmt.Errorf("missing or invalid %s annotation", SignatureAnnotation)
+	}
+	data, err := reg.blob(ctx, layer.Digest)
+	if err != nil {
+		return err
+	}
+	if err := verifySignature(v.key, data, sig); err != nil {
+		return err
+	}
+
+	// The payload is only trusted once its signature checked out
+	var p payload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return fmt.Errorf("invalid payload: %w", err)
+	}
+	if p.Critical.Type != SignatureType {
+		return fmt.Errorf("unexpected payload type %q", p.Critical.Type)
+	}
+	if p.Critical.Image.DockerManifestDigest != digest {
+		return fmt.Errorf("signature is for digest %s", p.Critical.Image.DockerManifestDigest)
+	}
+	return nil
+}
+
+// verifySignature checks sig over data with key, the way cosign signs:
+// ECDSA and RSA PKCS #1 v1.5 over the SHA-256 of data, Ed25519 over data.
+func verifySignature(key crypto.PublicKey, data, sig []byte) error {
+	sum := sha256.Sum256(data)
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(k, sum[:], sig) {
+			return errors.New("invalid signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(k, crypto.SHA256, sum[:], sig); err != nil {
+			return errors.New("invalid signature")
+		}
+	case ed25519.PublicKey:
+		if !ed25519.Verify(k, data, sig) {
+			return errors.New("invalid signature")
+		}
+	default:
+		return fmt.Errorf("unsupported public key type %T", key)
+	}
+	return nil
+}
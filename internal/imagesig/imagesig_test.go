@@ -0,0 +1,218 @@
+package imagesig
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/registry"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testRegistry is a local stand-in for a registry serving cosign signatures.
+// If token is set, it requires a bearer token from its /token endpoint,
+// which is handed out for the given basic auth credentials.
+type testRegistry struct {
+	*httptest.Server
+	username, password, token string
+
+	mu        sync.Mutex
+	manifests map[string][]byte
+	blobs     map[string][]byte
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	r := &testRegistry{manifests: map[string][]byte{}, blobs: map[string][]byte{}}
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	return r
+}
+
+// host returns the registry as it appears in image references.
+func (r *testRegistry) host() string {
+	return strings.TrimPrefix(r.URL, "http://")
+}
+
+func (r *testRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	if r.token != "" {
+		if req.URL.Path == "/token" {
+			if user, pass, ok := req.BasicAuth(); !ok || user != r.username || pass != r.password {
+				http.Error(w, "bad credentials", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprintf(w, `{"token":%q}`, r.token)
+			return
+		}
+		if req.Header.Get("Authorization") != "Bearer "+r.token {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:x:pull,push"`, r.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	repo, ref, ok := strings.Cut(strings.TrimPrefix(req.URL.Path, "/v2/"), "/manifests/")
+	if ok {
+		if data, found := r.manifests[repo+":"+ref]; found {
+			w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+			_, _ = w.Write(data)
+			return
+		}
+	}
+	if _, digest, ok := strings.Cut(req.URL.Path, "/blobs/"); ok {
+		if data, found := r.blobs[digest]; found {
+			_, _ = w.Write(data)
+			return
+		}
+	}
+	http.NotFound(w, req)
+}
+
+// sign stores a signature of digest in repo, made with key over a payload
+// naming signedDigest.
+func (r *testRegistry) sign(t *testing.T, key *ecdsa.PrivateKey, repo, digest, signedDigest string) {
+	payload := fmt.Sprintf(`{"critical":{"identity":{"docker-reference":%q},"image":{"docker-manifest-digest":%q},"type":%q},"optional":null}`,
+		r.host()+"/"+repo, signedDigest, SignatureType)
+	sum := sha256.Sum256([]byte(payload))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	require.NoError(t, err)
+	payloadDigest := "sha256:" + hex.EncodeToString(sum[:])
+
+	m, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"layers": []descriptor{{
+			MediaType:   SimpleSigningMediaType,
+			Digest:      payloadDigest,
+			Size:        int64(len(payload)),
+			Annotations: map[string]string{SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+		}},
+	})
+	require.NoError(t, err)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.blobs[payloadDigest] = []byte(payload)
+	r.manifests[repo+":"+strings.Replace(digest, ":", "-", 1)+".sig"] = m
+}
+
+// writeKey generates a key pair and writes its public key as PEM.
+func writeKey(t *testing.T) (*ecdsa.PrivateKey, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "cosign.pub")
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644))
+	return key, path
+}
+
+func noCredentials(string) (registry.AuthConfig, error) {
+	return registry.AuthConfig{}, nil
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+	const digest = "sha256:1111111111111111111111111111111111111111111111111111111111111111"
+	const other = "sha256:2222222222222222222222222222222222222222222222222222222222222222"
+	key, keyPath := writeKey(t)
+	otherKey, _ := writeKey(t)
+
+	reg := newTestRegistry(t)
+	reg.sign(t, key, "org/runner", digest, digest)
+	reg.sign(t, otherKey, "org/foreign", digest, digest)
+	reg.sign(t, key, "org/replayed", digest, other)
+
+	verifier, err := New(config.ImageSignatureConfig{PublicKey: keyPath, Timeout: 10 * time.Second}, noCredentials)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	require.NoError(t, verifier.Verify(ctx, reg.host()+"/org/runner", digest))
+
+	err = verifier.Verify(ctx, reg.host()+"/org/runner", other)
+	assert.ErrorIs(t, err, ErrNoSignature)
+
+	err = verifier.Verify(ctx, reg.host()+"/org/foreign", digest)
+	assert.ErrorContains(t, err, "invalid signature")
+
+	err = verifier.Verify(ctx, reg.host()+"/org/replayed", digest)
+	assert.ErrorContains(t, err, "signature is for digest "+other)
+}
+
+func TestVerifyWithTokenAuth(t *testing.T) {
+	t.Parallel()
+	const digest = "sha256:3333333333333333333333333333333333333333333333333333333333333333"
+	key, keyPath := writeKey(t)
+
+	reg := newTestRegistry(t)
+	reg.username, reg.password, reg.token = "garm", "secret", "pull-token"
+	reg.sign(t, key, "runner", digest, digest)
+
+	cfg := config.ImageSignatureConfig{PublicKey: keyPath, Timeout: 10 * time.Second}
+	verifier, err := New(cfg, func(image string) (registry.AuthConfig, error) {
+		assert.Equal(t, reg.host()+"/runner", image)
+		return registry.AuthConfig{Username: "garm", Password: "secret"}, nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, verifier.Verify(context.Background(), reg.host()+"/runner", digest))
+
+	anonymous, err := New(cfg, noCredentials)
+	require.NoError(t, err)
+	assert.ErrorContains(t, anonymous.Verify(context.Background(), reg.host()+"/runner", digest), "failed to get registry token: 401")
+}
+
+func TestLoadPublicKey(t *testing.T) {
+	t.Parallel()
+	_, keyPath := writeKey(t)
+	key, err := LoadPublicKey(keyPath)
+	require.NoError(t, err)
+	assert.IsType(t, &ecdsa.PublicKey{}, key)
+
+	notKey := filepath.Join(t.TempDir(), "not-a-key")
+	require.NoError(t, os.WriteFile(notKey, []byte("hello"), 0o644))
+	_, err = LoadPublicKey(notKey)
+	assert.ErrorContains(t, err, "does not contain a PEM public key")
+}
+
+func TestParseChallenge(t *testing.T) {
+	t.Parallel()
+	scheme, params := parseChallenge(`Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/ubuntu:pull,push"`)
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.docker.io/token",
+		"service": "registry.docker.io",
+		"scope":   "repository:library/ubuntu:pull,push",
+	}, params)
+
+	scheme, params = parseChallenge(`Basic realm=registry`)
+	assert.Equal(t, "Basic", scheme)
+	assert.Equal(t, map[string]string{"realm": "registry"}, params)
+}
+
+func TestIsInsecure(t *testing.T) {
+	t.Parallel()
+	assert.True(t, isInsecure("localhost:5000", nil))
+	assert.True(t, isInsecure("127.0.0.1:5000", nil))
+	assert.True(t, isInsecure("[::1]:5000", nil))
+	assert.True(t, isInsecure("registry.lan:5000", []string{"registry.lan:5000"}))
+	assert.False(t, isInsecure("ghcr.io", nil))
+}
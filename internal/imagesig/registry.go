@@ -0,0 +1,262 @@
+package imagesig
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+)
+
+const (
+	// maxManifestSize and maxBlobSize bound what is read from the registry.
+	// Signature manifests and payloads are a few KiB.
+	maxManifestSize = 4 << 20
+	maxBlobSize     = 4 << 20
+
+	manifestAccept = "application/vnd.oci.image.manifest.v1+json, application/vnd.docker.distribution.manifest.v2+json"
+)
+
+// manifest is the part of an OCI image manifest holding the signatures.
+type manifest struct {
+	Layers []descriptor `json:"layers"`
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// registryClient reads from one repository through the registry HTTP API.
+type registryClient struct {
+	client *http.Client
+	base   string
+	repo   string
+	auth   registry.AuthConfig
+	// authorization is the Authorization header, once the registry asked
+	// for one.
+	authorization string
+}
+
+func newRegistryClient(client *http.Client, named reference.Named, auth registry.AuthConfig, insecure []string) *registryClient {
+	host := reference.Domain(named)
+	scheme := "https"
+	if isInsecure(host, insecure) {
+		scheme = "http"
+	}
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+	}
+	return &registryClient{
+		client: client,
+		base:   scheme + "://" + host,
+		repo:   reference.Path(named),
+		auth:   auth,
+	}
+}
+
+// isInsecure reports whether a registry is reached over plain HTTP.
+func isInsecure(host string, insecure []string) bool {
+	if slices.Contains(insecure, host) {
+		return true
+	}
+	hostname := host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		hostname = h
+	}
+	if hostname == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(hostname)
+	return ip != nil && ip.IsLoopback()
+}
+
+// manifest fetches the manifest of a tag. A missing tag is ErrNoSignature.
+func (r *registryClient) manifest(ctx context.Context, tag string) (*manifest, error) {
+	resp, err := r.get(ctx, "/manifests/"+tag, manifestAccept)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("%w in %s", ErrNoSignature, r.repo)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get signature manifest %s: %s", tag, resp.Status)
+	}
+	var m manifest
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&m); err != nil {
+		return nil, fmt.Errorf("failed to decode signature manifest %s: %w", tag, err)
+	}
+	return &m, nil
+}
+
+// blob fetches a blob and checks it against its digest.
+func (r *registryClient) blob(ctx context.Context, digest string) ([]byte, error) {
+	algorithm, want, ok := strings.Cut(digest, ":")
+	if !ok || algorithm != "sha256" {
+		return nil, fmt.Errorf("unsupported blob digest %q", digest)
+	}
+	resp, err := r.get(ctx, "/blobs/"+digest, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get blob %s: %s", digest, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxBlobSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read blob %s: %w", digest, err)
+	}
+	sum := sha256.Sum256(data)
+	if hex.EncodeToString(sum[:]) != want {
+		return nil, fmt.Errorf("blob %s does not match its digest", digest)
+	}
+	return data, nil
+}
+
+// get requests a path below the repository. If the registry asks for
+// authentication, it authenticates and retries once.
+func (r *registryClient) get(ctx context.Context, path, accept string) (*http.Response, error) {
+	resp, err := r.do(ctx, path, accept)
+	if err != nil || resp.StatusCode != http.StatusUnauthorized || r.authorization != "" {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	resp.Body.Close()
+	if err := r.authenticate(ctx, challenge); err != nil {
+		return nil, err
+	}
+	return r.do(ctx, path, accept)
+}
+
+func (r *registryClient) do(ctx context.Context, path, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, r.base+"/v2/"+r.repo+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if r.authorization != "" {
+		req.Header.Set("Authorization", r.authorization)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach registry: %w", err)
+	}
+	return resp, nil
+}
+
+// authenticate answers a WWW-Authenticate challenge with the credentials of
+// the registry, getting a bearer token from the token service if needed.
+func (r *registryClient) authenticate(ctx context.Context, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if r.auth.Username == "" {
+			return fmt.Errorf("registry requires credentials for %s", r.repo)
+		}
+		r.authorization = "Basic " + base64.StdEncoding.EncodeToString([]byte(r.auth.Username+":"+r.auth.Password))
+		return nil
+	case "bearer":
+		if r.auth.RegistryToken != "" {
+			r.authorization = "Bearer " + r.auth.RegistryToken
+			return nil
+		}
+		token, err := r.fetchToken(ctx, params)
+		if err != nil {
+			return err
+		}
+		r.authorization = "Bearer " + token
+		return nil
+	default:
+		return fmt.Errorf("unsupported registry authentication %q", scheme)
+	}
+}
+
+// fetchToken gets a pull token for the repository from the token service
+// named in a bearer challenge, anonymously if there are no credentials.
+func (r *registryClient) fetchToken(ctx context.Context, params map[string]string) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Scheme == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", "repository:"+r.repo+":pull")
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if r.auth.Username != "" {
+		req.SetBasicAuth(r.auth.Username, r.auth.Password)
+	}
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to get registry token: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get registry token: %s", resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxManifestSize)).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to decode registry token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("registry token response has no token")
+}
+
+// parseChallenge splits a WWW-Authenticate header such as
+// `Bearer realm="https://auth.example/token",service="registry"` into its
+// scheme and parameters.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var key string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, " ,"), "=")
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			// Quoted values may contain commas, e.g. in scopes
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		if key = strings.ToLower(strings.TrimSpace(key)); key != "" {
+			params[key] = value
+		}
+	}
+	return scheme, params
+}
@@ -0,0 +1,94 @@
+package logarchive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirSink writes logs to files in a local directory and removes old ones.
+type DirSink struct {
+	Dir string
+	// MaxFiles is the number of log files kept. 0 keeps all.
+	MaxFiles int
+	// MaxAge is how long log files are kept. 0 keeps them forever.
+	MaxAge time.Duration
+}
+
+func (s *DirSink) Store(ctx context.Context, key string, r io.Reader) error {
+	name := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0o750); err != nil {
+		return fmt.Errorf("failed to create log directory: %w", err)
+	}
+
+	// Write to a temporary file first, so retention never sees partial logs
+	tmp, err := os.CreateTemp(filepath.Dir(name), ".archive-*")
+	if err != nil {
+		return fmt.Errorf("failed to create log file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, r); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write log file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write log file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return fmt.Errorf("failed to write log file: %w", err)
+	}
+
+	if err := s.prune(); err != nil {
+		slog.Warn("failed to remove old log files", "dir", s.Dir, "error", err)
+	}
+	return nil
+}
+
+// prune removes log files older than MaxAge, then the oldest ones beyond
+// MaxFiles.
+func (s *DirSink) prune() error {
+	if s.MaxFiles == 0 && s.MaxAge == 0 {
+		return nil
+	}
+
+	type logFile struct {
+		path    string
+		modTime time.Time
+	}
+	var files []logFile
+	err := filepath.WalkDir(s.Dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(d.Name(), ".log") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, logFile{path: p, modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	for i, f := range files {
+		expired := s.MaxAge > 0 && time.Since(f.modTime) > s.MaxAge
+		if expired || (s.MaxFiles > 0 && i >= s.MaxFiles) {
+			if err := os.Remove(f.path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+// Package logarchive stores the logs of runner containers before they are
+// removed, in a local directory or an S3-compatible bucket.
+package logarchive
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// Sink stores archived logs.
+type Sink interface {
+	// Store writes the logs read from r under the given key.
+	Store(ctx context.Context, key string, r io.Reader) error
+}
+
+// New returns the sink for the log archive config, or nil if archiving is
+// disabled.
+func New(cfg config.LogArchiveConfig) (Sink, error) {
+	switch {
+	case cfg.Directory != "":
+		return &DirSink{Dir: cfg.Directory, MaxFiles: cfg.MaxFiles, MaxAge: cfg.MaxAge}, nil
+	case cfg.S3.Bucket != "":
+		s3 := cfg.S3
+		if s3.AccessKeyID == "" {
+			s3.AccessKeyID = os.Getenv("AWS_ACCESS_KEY_ID")
+		}
+		if s3.SecretAccessKey == "" {
+			s3.SecretAccessKey = config.Secret(os.Getenv("AWS_SECRET_ACCESS_KEY"))
+		}
+		if s3.SessionToken == "" {
+			s3.SessionToken = config.Secret(os.Getenv("AWS_SESSION_TOKEN"))
+		}
+		if s3.AccessKeyID == "" || s3.SecretAccessKey == "" {
+			return nil, fmt.Errorf("s3: access key ID and secret access key are required")
+		}
+		return NewS3Sink(s3)
+	default:
+		return nil, nil
+	}
+}
+
+// Key returns the key logs of an instance are archived under:
+// "<pool>/<instance>-<UTC timestamp>.log".
+func Key(poolID, instanceName string, t time.Time) string {
+	if poolID == "" {
+		poolID = "unknown-pool"
+	}
+	return path.Join(sanitize(poolID), fmt.Sprintf("%s-%s.log", sanitize(instanceName), t.UTC().Format("20060102T150405Z")))
+}
+
+// sanitize keeps a name from escaping its directory.
+func sanitize(name string) string {
+	return strings.NewReplacer("/", "_", "\\", "_", "..", "_").Replace(name)
+}
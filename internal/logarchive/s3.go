@@ -0,0 +1,120 @@
+package logarchive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// S3Sink uploads logs to an S3-compatible bucket.
+type S3Sink struct {
+	cfg      config.S3Config
+	endpoint *url.URL
+	client   *http.Client
+	// now is replaced in tests.
+	now func() time.Time
+}
+
+// NewS3Sink returns a sink that uploads to the configured bucket.
+func NewS3Sink(cfg config.S3Config) (*S3Sink, error) {
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid s3 endpoint: %w", err)
+	}
+	return &S3Sink{
+		cfg:      cfg,
+		endpoint: endpoint,
+		client:   &http.Client{Timeout: 5 * time.Minute},
+		now:      time.Now,
+	}, nil
+}
+
+func (s *S3Sink) Store(ctx context.Context, key string, r io.Reader) error {
+	// The payload is hashed for the signature and S3 needs its length, so
+	// it is spooled to a temporary file rather than held in memory
+	body, err := os.CreateTemp("", "garm-log-*")
+	if err != nil {
+		return fmt.Errorf("failed to spool logs: %w", err)
+	}
+	defer func() {
+		body.Close()
+		os.Remove(body.Name())
+	}()
+	hash := sha256.New()
+	size, err := spool(io.MultiWriter(body, hash), r, int64(s.cfg.MaxSizeMB)<<20)
+	if err != nil {
+		return fmt.Errorf("failed to spool logs: %w", err)
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to spool logs: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(s.cfg.Prefix+key), io.NopCloser(body))
+	if err != nil {
+		return err
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", s.cfg.SessionToken.Value())
+	}
+	signV4(req, hex.EncodeToString(hash.Sum(nil)), credentials{
+		accessKeyID:     s.cfg.AccessKeyID,
+		secretAccessKey: s.cfg.SecretAccessKey.Value(),
+		region:          s.cfg.Region,
+		service:         "s3",
+	}, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload logs: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("failed to upload logs: %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// spool copies at most limit bytes of r to w, followed by a note if r was
+// longer, and returns the number of bytes written. A limit of 0 copies all.
+func spool(w io.Writer, r io.Reader, limit int64) (int64, error) {
+	if limit <= 0 {
+		return io.Copy(w, r)
+	}
+	n, err := io.Copy(w, io.LimitReader(r, limit))
+	if err != nil || n < limit {
+		return n, err
+	}
+	// Only check for more, the rest of the logs isn't read
+	if m, _ := io.ReadFull(r, make([]byte, 1)); m == 0 {
+		return n, nil
+	}
+	note, err := fmt.Fprintf(w, "\n[logs truncated at %d bytes]\n", limit)
+	return n + int64(note), err
+}
+
+// objectURL returns the URL of an object, in path or virtual-host style.
+func (s *S3Sink) objectURL(key string) string {
+	u := *s.endpoint
+	base := strings.TrimSuffix(u.Path, "/")
+	if s.cfg.PathStyle {
+		base += "/" + s.cfg.Bucket
+	} else {
+		u.Host = s.cfg.Bucket + "." + u.Host
+	}
+	u.Path = base + "/" + key
+	// Keys are encoded the way they are signed
+	u.RawPath = uriEncode(u.Path, false)
+	return u.String()
+}
@@ -0,0 +1,79 @@
+// Package logging sets up the provider's logger from the log config.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// New returns a logger for the log config, with attrs added to every line.
+// The returned closer releases the log file or syslog connection.
+func New(cfg config.LogConfig, attrs ...any) (*slog.Logger, io.Closer, error) {
+	level, err := cfg.SlogLevel()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		out     io.Writer = os.Stderr
+		closer  io.Closer = io.NopCloser(nil)
+		syslogW *syslogWriter
+	)
+	switch cfg.Output {
+	case "", config.LogOutputStderr:
+	case config.LogOutputFile:
+		file, err := NewRotatingFile(cfg.File.Path, int64(cfg.File.MaxSizeMB)<<20, cfg.File.MaxBackups)
+		if err != nil {
+			return nil, nil, err
+		}
+		out, closer = file, file
+	case config.LogOutputSyslog:
+		w, err := dialSyslog(cfg.Syslog)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to connect to syslog: %w", err)
+		}
+		syslogW = w
+		out, closer = w, w
+	default:
+		return nil, nil, fmt.Errorf("unknown log output %q", cfg.Output)
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if cfg.Format == "json" {
+		handler = slog.NewJSONHandler(out, opts)
+	} else {
+		handler = slog.NewTextHandler(out, opts)
+	}
+	if syslogW != nil {
+		handler = &syslogHandler{Handler: handler, w: syslogW}
+	}
+	return slog.New(handler).With(attrs...), closer, nil
+}
+
+// syslogHandler tells the syslogWriter the level of the record its handler
+// is about to write.
+type syslogHandler struct {
+	slog.Handler
+	w *syslogWriter
+}
+
+func (h *syslogHandler) Handle(ctx context.Context, r slog.Record) error {
+	h.w.mu.Lock()
+	defer h.w.mu.Unlock()
+	h.w.level = r.Level
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *syslogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithAttrs(attrs), w: h.w}
+}
+
+func (h *syslogHandler) WithGroup(name string) slog.Handler {
+	return &syslogHandler{Handler: h.Handler.WithGroup(name), w: h.w}
+}
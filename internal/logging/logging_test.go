@@ -0,0 +1,106 @@
+package logging
+
+import (
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileOutputWithAttrs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "provider.log")
+	logger, closer, err := New(config.LogConfig{
+		Level:  "debug",
+		Format: "json",
+		Output: config.LogOutputFile,
+		File:   config.LogFileConfig{Path: path},
+	}, "controller_id", "controller-1", "command", "CreateInstance")
+	require.NoError(t, err)
+
+	logger.Debug("using local image", "image", "ubuntu:latest")
+	require.NoError(t, closer.Close())
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(data, &line))
+	assert.Equal(t, "DEBUG", line["level"])
+	assert.Equal(t, "controller-1", line["controller_id"])
+	assert.Equal(t, "CreateInstance", line["command"])
+	assert.Equal(t, "ubuntu:latest", line["image"])
+}
+
+func TestRotatingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "provider.log")
+	file, err := NewRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer file.Close()
+
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := file.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	for name, want := range map[string]string{path: "fourth\n", path + ".1": "third\n", path + ".2": "second\n"} {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	}
+	assert.NoFileExists(t, path+".3")
+}
+
+func TestSyslogOutput(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "log")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	require.NoError(t, err)
+	defer conn.Close()
+
+	logger, closer, err := New(config.LogConfig{
+		Output: config.LogOutputSyslog,
+		Syslog: config.LogSyslogConfig{Network: "unixgram", Address: socket, Tag: "garm-provider-docker"},
+	}, "pool_id", "pool-1")
+	require.NoError(t, err)
+	defer closer.Close()
+
+	logger.Warn("runner did not drain in time")
+
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	msg := string(buf[:n])
+	// LOG_DAEMON|LOG_WARNING
+	assert.True(t, strings.HasPrefix(msg, "<28>"), msg)
+	assert.Contains(t, msg, "garm-provider-docker")
+	assert.Contains(t, msg, `msg="runner did not drain in time" pool_id=pool-1`)
+}
+
+func TestRotatingFileSharedByProcesses(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "provider.log")
+	first, err := NewRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer first.Close()
+	second, err := NewRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	defer second.Close()
+
+	for _, w := range []struct {
+		file *RotatingFile
+		line string
+	}{{first, "first\n"}, {second, "second\n"}, {first, "third\n"}} {
+		_, err := w.file.Write([]byte(w.line))
+		require.NoError(t, err)
+	}
+
+	// Each writer sees the other's writes and rotation
+	for name, want := range map[string]string{path: "third\n", path + ".1": "second\n", path + ".2": "first\n"} {
+		data, err := os.ReadFile(name)
+		require.NoError(t, err)
+		assert.Equal(t, want, string(data))
+	}
+}
@@ -0,0 +1,29 @@
+//go:build !unix
+
+package logging
+
+import (
+	"errors"
+	"log/slog"
+	"sync"
+
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// syslogWriter is never created where log/syslog isn't available.
+type syslogWriter struct {
+	mu    sync.Mutex
+	level slog.Level
+}
+
+func dialSyslog(config.LogSyslogConfig) (*syslogWriter, error) {
+	return nil, errors.ErrUnsupported
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	return 0, errors.ErrUnsupported
+}
+
+func (s *syslogWriter) Close() error {
+	return nil
+}
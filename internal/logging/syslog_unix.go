@@ -0,0 +1,48 @@
+//go:build unix
+
+package logging
+
+import (
+	"log/slog"
+	"log/syslog"
+	"strings"
+	"sync"
+
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// syslogWriter sends each log line to syslog with the priority of the
+// record being written.
+type syslogWriter struct {
+	mu    sync.Mutex
+	w     *syslog.Writer
+	level slog.Level
+}
+
+func dialSyslog(cfg config.LogSyslogConfig) (*syslogWriter, error) {
+	w, err := syslog.Dial(cfg.Network, cfg.Address, syslog.LOG_INFO|syslog.LOG_DAEMON, cfg.Tag)
+	if err != nil {
+		return nil, err
+	}
+	return &syslogWriter{w: w}, nil
+}
+
+func (s *syslogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSuffix(string(p), "\n")
+	var err error
+	switch {
+	case s.level >= slog.LevelError:
+		err = s.w.Err(msg)
+	case s.level >= slog.LevelWarn:
+		err = s.w.Warning(msg)
+	case s.level >= slog.LevelInfo:
+		err = s.w.Info(msg)
+	default:
+		err = s.w.Debug(msg)
+	}
+	return len(p), err
+}
+
+func (s *syslogWriter) Close() error {
+	return s.w.Close()
+}
@@ -0,0 +1,174 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/mercedes-benz/garm-provider-docker/internal/filelock"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// Emit writes the recorded metrics to the textfile and pushes them to the
+// Pushgateway configured in cfg. It does nothing if neither is configured.
+func Emit(ctx context.Context, cfg config.MetricsConfig, r *Recorder, command string) error {
+	if r == nil {
+		return nil
+	}
+	var errs []string
+	if cfg.TextfilePath != "" {
+		if err := WriteTextfile(cfg.TextfilePath, r); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if cfg.PushgatewayURL != "" {
+		ctx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+		defer cancel()
+		if err := Push(ctx, cfg.PushgatewayURL, cfg.Job, cfg.Instance, command, r); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to emit metrics: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// WriteTextfile adds the recorded metrics to those already in the
+// node_exporter textfile at path, and replaces it atomically. Concurrent
+// provider processes are serialized with a lock file next to it.
+func WriteTextfile(path string, r *Recorder) error {
+	unlock, err := filelock.Lock(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	previous := map[string]float64{}
+	data, err := os.ReadFile(path)
+	if err == nil {
+		previous = parse(string(data))
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read metrics textfile: %w", err)
+	}
+
+	// node_exporter only reads files ending in .prom, so the temp file
+	// can't be picked up half-written.
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create metrics textfile: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(render(r.merge(previous))); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics textfile: %w", err)
+	}
+	if err := tmp.Chmod(0o644); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write metrics textfile: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write metrics textfile: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace metrics textfile: %w", err)
+	}
+	return nil
+}
+
+// Push adds the recorded metrics to those of their job, instance and command
+// group on a Pushgateway, and replaces the group. The Pushgateway only keeps
+// the last push of a group, so the previous values are read back first to
+// keep running totals. Concurrent pushes on a host are serialized with a lock
+// file in the temp directory.
+func Push(ctx context.Context, gatewayURL, job, instance, command string, r *Recorder) error {
+	gatewayURL = strings.TrimSuffix(gatewayURL, "/")
+	target := gatewayURL + "/metrics/job/" + url.PathEscape(job)
+	if instance != "" {
+		target += "/instance/" + url.PathEscape(instance)
+	}
+	if command != "" {
+		target += "/command/" + url.PathEscape(command)
+	}
+
+	unlock, err := filelock.Lock(filepath.Join(os.TempDir(), "garm-provider-docker-pushgateway.lock"))
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	group := Labels{"job": job, "instance": instance, "command": command}
+	previous, err := pulled(ctx, gatewayURL, group)
+	if err != nil {
+		return err
+	}
+	// The Pushgateway sets the grouping labels on every series itself
+	body := render(r.merge(previous, "job", "instance", "command"))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, target, bytes.NewBufferString(body))
+	if err != nil {
+		return fmt.Errorf("failed to create pushgateway request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to push metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// pulled returns the series of this provider the Pushgateway holds for a
+// group, as it exposes them on its own metrics endpoint.
+func pulled(ctx context.Context, gatewayURL string, group Labels) (map[string]float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, gatewayURL+"/metrics", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create pushgateway request: %w", err)
+	}
+	req.Header.Set("Accept", "text/plain; version=0.0.4")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pushed metrics: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read pushed metrics: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("pushgateway returned %s: %s", resp.Status, strings.TrimSpace(string(data[:min(len(data), 1024)])))
+	}
+
+	series := map[string]float64{}
+	for key, v := range parse(string(data)) {
+		if _, ok := families[familyOf(key)]; !ok {
+			continue
+		}
+		_, labels, ok := splitKey(key)
+		if !ok {
+			continue
+		}
+		inGroup := true
+		for k, want := range group {
+			// Empty labels aren't exposed
+			inGroup = inGroup && labels[k] == want
+		}
+		if inGroup {
+			series[key] = v
+		}
+	}
+	return series, nil
+}
@@ -0,0 +1,270 @@
+// Package metrics records Prometheus metrics of a provider invocation and
+// emits them to a node_exporter textfile or a Pushgateway. The provider runs
+// as a short-lived process per Garm call, so there is nothing to scrape.
+package metrics
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const namespace = "garm_provider_docker_"
+
+// Metric names.
+const (
+	CommandsTotal           = namespace + "commands_total"
+	CommandDuration         = namespace + "command_duration_seconds"
+	LastCommandTimestamp    = namespace + "last_command_timestamp_seconds"
+	ImagePullDuration       = namespace + "image_pull_duration_seconds"
+	ImagePullBytes          = namespace + "image_pull_bytes_total"
+	ContainerCreateDuration = namespace + "container_create_duration_seconds"
+	ContainerStartDuration  = namespace + "container_start_duration_seconds"
+)
+
+type family struct {
+	typ  string
+	help string
+}
+
+var families = map[string]family{
+	CommandsTotal:           {"counter", "Provider commands run, by command and outcome."},
+	CommandDuration:         {"summary", "Duration of provider commands."},
+	LastCommandTimestamp:    {"gauge", "Unix time the last provider command finished."},
+	ImagePullDuration:       {"summary", "Duration of image pulls."},
+	ImagePullBytes:          {"counter", "Bytes downloaded by image pulls."},
+	ContainerCreateDuration: {"summary", "Latency of Docker container create calls."},
+	ContainerStartDuration:  {"summary", "Latency of Docker container start calls."},
+}
+
+// Labels of a series.
+type Labels map[string]string
+
+// Recorder collects the metrics of one invocation. A nil Recorder discards
+// everything.
+type Recorder struct {
+	mu sync.Mutex
+	// series maps a rendered series to its value. Counters and summary
+	// parts are added to previous values, gauges replace them.
+	series map[string]float64
+	gauges map[string]bool
+}
+
+// NewRecorder returns an empty recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{series: map[string]float64{}, gauges: map[string]bool{}}
+}
+
+// ObserveCommand records a finished provider command.
+func (r *Recorder) ObserveCommand(command string, d time.Duration, err error) {
+	outcome := "success"
+	if err != nil {
+		outcome = "failure"
+	}
+	labels := Labels{"command": command, "outcome": outcome}
+	r.add(CommandsTotal, labels, 1)
+	r.observe(CommandDuration, labels, d.Seconds())
+	r.set(LastCommandTimestamp, labels, float64(time.Now().Unix()))
+}
+
+// ObserveImagePull records an image pull and the bytes it downloaded.
+func (r *Recorder) ObserveImagePull(d time.Duration, bytes int64) {
+	r.observe(ImagePullDuration, nil, d.Seconds())
+	r.add(ImagePullBytes, nil, float64(bytes))
+}
+
+// ObserveContainerCreate records the latency of a container create call.
+func (r *Recorder) ObserveContainerCreate(d time.Duration) {
+	r.observe(ContainerCreateDuration, nil, d.Seconds())
+}
+
+// ObserveContainerStart records the latency of a container start call.
+func (r *Recorder) ObserveContainerStart(d time.Duration) {
+	r.observe(ContainerStartDuration, nil, d.Seconds())
+}
+
+func (r *Recorder) add(name string, labels Labels, v float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series[seriesKey(name, labels)] += v
+}
+
+func (r *Recorder) set(name string, labels Labels, v float64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	key := seriesKey(name, labels)
+	r.series[key] = v
+	r.gauges[key] = true
+}
+
+// observe records a value of a summary, as its _sum and _count series.
+func (r *Recorder) observe(name string, labels Labels, v float64) {
+	r.add(name+"_sum", labels, v)
+	r.add(name+"_count", labels, 1)
+}
+
+// merge applies the recorded values on top of previous ones. Labels named in
+// drop are removed from both first.
+func (r *Recorder) merge(previous map[string]float64, drop ...string) map[string]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	merged := make(map[string]float64, len(previous)+len(r.series))
+	for k, v := range previous {
+		merged[dropLabels(k, drop)] = v
+	}
+	for k, v := range r.series {
+		if r.gauges[k] {
+			merged[dropLabels(k, drop)] = v
+		} else {
+			merged[dropLabels(k, drop)] += v
+		}
+	}
+	return merged
+}
+
+// seriesKey renders a series as in the exposition format, with sorted labels.
+func seriesKey(name string, labels Labels) string {
+	if len(labels) == 0 {
+		return name
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", k, labels[k]))
+	}
+	return name + "{" + strings.Join(pairs, ",") + "}"
+}
+
+// splitKey is the inverse of seriesKey. It returns false if key isn't a
+// valid series.
+func splitKey(key string) (string, Labels, bool) {
+	name, rest, found := strings.Cut(key, "{")
+	if !found {
+		return name, Labels{}, true
+	}
+	labels := Labels{}
+	rest, ok := strings.CutSuffix(rest, "}")
+	for ok && rest != "" {
+		var label string
+		label, rest, ok = strings.Cut(rest, "=")
+		if !ok || !strings.HasPrefix(rest, `"`) {
+			return "", nil, false
+		}
+		// The value is quoted, find its end while skipping escaped quotes
+		end := 1
+		for end < len(rest) && rest[end] != '"' {
+			if rest[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(rest) {
+			return "", nil, false
+		}
+		value, err := strconv.Unquote(rest[:end+1])
+		if err != nil {
+			return "", nil, false
+		}
+		labels[strings.TrimSpace(label)] = value
+		rest = strings.TrimPrefix(rest[end+1:], ",")
+	}
+	return name, labels, ok
+}
+
+// dropLabels removes the named labels from a series.
+func dropLabels(key string, names []string) string {
+	if len(names) == 0 || !strings.Contains(key, "{") {
+		return key
+	}
+	name, labels, ok := splitKey(key)
+	if !ok {
+		return key
+	}
+	for _, n := range names {
+		delete(labels, n)
+	}
+	return seriesKey(name, labels)
+}
+
+// familyOf returns the metric family a series belongs to.
+func familyOf(key string) string {
+	name, _, _ := strings.Cut(key, "{")
+	if _, ok := families[name]; ok {
+		return name
+	}
+	for _, suffix := range []string{"_sum", "_count"} {
+		if trimmed := strings.TrimSuffix(name, suffix); trimmed != name {
+			if f, ok := families[trimmed]; ok && f.typ == "summary" {
+				return trimmed
+			}
+		}
+	}
+	return name
+}
+
+// render writes series in the Prometheus text exposition format, grouped by
+// family.
+func render(series map[string]float64) string {
+	keys := make([]string, 0, len(series))
+	for k := range series {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		fi, fj := familyOf(keys[i]), familyOf(keys[j])
+		if fi != fj {
+			return fi < fj
+		}
+		return keys[i] < keys[j]
+	})
+
+	var b strings.Builder
+	current := ""
+	for _, k := range keys {
+		if name := familyOf(k); name != current {
+			current = name
+			if f, ok := families[name]; ok {
+				fmt.Fprintf(&b, "# HELP %s %s\n# TYPE %s %s\n", name, f.help, name, f.typ)
+			}
+		}
+		fmt.Fprintf(&b, "%s %s\n", k, formatValue(series[k]))
+	}
+	return b.String()
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// parse reads series from the text exposition format, skipping comments.
+func parse(text string) map[string]float64 {
+	series := map[string]float64{}
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			continue
+		}
+		v, err := strconv.ParseFloat(line[i+1:], 64)
+		if err != nil {
+			continue
+		}
+		series[line[:i]] = v
+	}
+	return series
+}
@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTextfileAccumulates(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "garm.prom")
+
+	for _, err := range []error{nil, errors.New("boom"), nil} {
+		r := NewRecorder()
+		r.ObserveCommand("CreateInstance", 2*time.Second, err)
+		r.ObserveImagePull(time.Second, 1024)
+		require.NoError(t, WriteTextfile(path, r))
+	}
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	series := parse(string(data))
+	assert.Equal(t, 2.0, series[`garm_provider_docker_commands_total{command="CreateInstance",outcome="success"}`])
+	assert.Equal(t, 1.0, series[`garm_provider_docker_commands_total{command="CreateInstance",outcome="failure"}`])
+	assert.Equal(t, 4.0, series[`garm_provider_docker_command_duration_seconds_sum{command="CreateInstance",outcome="success"}`])
+	assert.Equal(t, 3072.0, series["garm_provider_docker_image_pull_bytes_total"])
+	assert.Equal(t, 3.0, series["garm_provider_docker_image_pull_duration_seconds_count"])
+	assert.Equal(t, 1, strings.Count(string(data), "# TYPE garm_provider_docker_command_duration_seconds summary"))
+
+	// No temp files are left behind for node_exporter to trip over
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	for _, e := range entries {
+		assert.False(t, strings.Contains(e.Name(), ".tmp-"), e.Name())
+	}
+}
+
+// fakePushgateway keeps the last push of each group and exposes them with
+// their grouping labels, like a Pushgateway.
+type fakePushgateway struct {
+	mu     sync.Mutex
+	paths  []string
+	groups map[string]map[string]float64
+}
+
+func (f *fakePushgateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if r.Method == http.MethodGet && r.URL.Path == "/metrics" {
+		all := map[string]float64{"push_time_seconds{job=\"garm\"}": 1}
+		for _, series := range f.groups {
+			maps.Copy(all, series)
+		}
+		io.WriteString(w, render(all))
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/metrics/"), "/")
+	group := Labels{}
+	for i := 0; i+1 < len(parts); i += 2 {
+		group[parts[i]] = parts[i+1]
+	}
+	body, _ := io.ReadAll(r.Body)
+	series := map[string]float64{}
+	for key, v := range parse(string(body)) {
+		name, labels, _ := splitKey(key)
+		maps.Copy(labels, group)
+		series[seriesKey(name, labels)] = v
+	}
+	f.paths = append(f.paths, r.URL.Path)
+	f.groups[r.URL.Path] = series
+}
+
+func TestPush(t *testing.T) {
+	fake := &fakePushgateway{groups: map[string]map[string]float64{}}
+	gateway := httptest.NewServer(fake)
+	defer gateway.Close()
+
+	cfg := config.MetricsConfig{PushgatewayURL: gateway.URL + "/", Job: "garm", Instance: "runner-host-1", Timeout: time.Second}
+	for _, command := range []string{"DeleteInstance", "DeleteInstance", "GetInstance"} {
+		r := NewRecorder()
+		r.ObserveCommand(command, 500*time.Millisecond, nil)
+		r.ObserveContainerCreate(250 * time.Millisecond)
+		require.NoError(t, Emit(context.Background(), cfg, r, command))
+	}
+
+	// Pushes of the same group add up, other groups are left alone
+	assert.Equal(t, "/metrics/job/garm/instance/runner-host-1/command/DeleteInstance", fake.paths[0])
+	deletes := fake.groups["/metrics/job/garm/instance/runner-host-1/command/DeleteInstance"]
+	assert.Equal(t, 2.0, deletes[`garm_provider_docker_commands_total{command="DeleteInstance",instance="runner-host-1",job="garm",outcome="success"}`])
+	assert.Equal(t, 0.5, deletes[`garm_provider_docker_container_create_duration_seconds_sum{command="DeleteInstance",instance="runner-host-1",job="garm"}`])
+	gets := fake.groups["/metrics/job/garm/instance/runner-host-1/command/GetInstance"]
+	assert.Equal(t, 1.0, gets[`garm_provider_docker_commands_total{command="GetInstance",instance="runner-host-1",job="garm",outcome="success"}`])
+	assert.Len(t, gets, len(deletes))
+}
+
+func TestSplitKey(t *testing.T) {
+	key := seriesKey("m", Labels{"a": `quoted "x", y`, "b": ""})
+	name, labels, ok := splitKey(key)
+	require.True(t, ok)
+	assert.Equal(t, "m", name)
+	assert.Equal(t, Labels{"a": `quoted "x", y`, "b": ""}, labels)
+
+	_, _, ok = splitKey(`m{a="unterminated}`)
+	assert.False(t, ok)
+}
+
+func TestPushError(t *testing.T) {
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "bad metrics", http.StatusBadRequest)
+	}))
+	defer gateway.Close()
+
+	err := Push(context.Background(), gateway.URL, "garm", "", "", NewRecorder())
+	assert.ErrorContains(t, err, "bad metrics")
+}
+
+func TestNilRecorder(t *testing.T) {
+	var r *Recorder
+	r.ObserveCommand("GetInstance", time.Second, nil)
+	r.ObserveContainerStart(time.Second)
+	assert.NoError(t, Emit(context.Background(), config.MetricsConfig{TextfilePath: "/nonexistent/x.prom"}, r, "GetInstance"))
+}
@@ -0,0 +1,59 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/mercedes-benz/garm-provider-docker/internal/logarchive"
+	"github.com/mercedes-benz/garm-provider-docker/internal/spec"
+)
+
+// archiveLogs streams the logs of a runner into the configured log archive,
+// named after its pool and instance name.
+func (p *Provider) archiveLogs(ctx context.Context, containerID string, inspect types.ContainerJSON, name string) error {
+	sink, err := logarchive.New(p.Config.LogArchive)
+	if err != nil || sink == nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, p.Config.LogArchive.Timeout)
+	defer cancel()
+
+	reader, err := p.DockerClient.ContainerLogs(ctx, containerID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get logs of container %s: %w", containerID, err)
+	}
+	defer reader.Close()
+
+	logs := io.Reader(reader)
+	if inspect.Config == nil || !inspect.Config.Tty {
+		// Without a TTY, stdout and stderr are multiplexed
+		pr, pw := io.Pipe()
+		defer pr.Close()
+		go func() {
+			_, err := stdcopy.StdCopy(pw, pw, reader)
+			pw.CloseWithError(err)
+		}()
+		logs = pr
+	}
+
+	poolID := ""
+	if inspect.Config != nil {
+		poolID = inspect.Config.Labels[spec.GarmPoolIDLabel]
+	}
+	key := logarchive.Key(poolID, name, time.Now())
+	if err := sink.Store(ctx, key, logs); err != nil {
+		return fmt.Errorf("failed to archive logs of container %s: %w", containerID, err)
+	}
+	slog.Info("archived runner logs", "instance", name, "key", key)
+	return nil
+}
@@ -0,0 +1,55 @@
+package provider
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/docker/docker/api/types"
+	"github.com/mercedes-benz/garm-provider-docker/internal/audit"
+)
+
+// audit records the outcome of an action in the audit log, if enabled.
+// Failures are logged, as the action has already happened.
+func (p *Provider) audit(ctx context.Context, entry audit.Entry, err error) {
+	log, logErr := audit.New(p.Config.Audit)
+	if logErr != nil || log == nil {
+		if logErr != nil {
+			slog.Error("failed to open audit log", "action", entry.Action, "instance", entry.Instance, "error", logErr)
+		}
+		return
+	}
+
+	if entry.Env.ControllerID == "" {
+		entry.Env.ControllerID = p.ControllerID
+	}
+	entry.SetOutcome(err)
+	if ref := entry.ImageID; ref != "" || entry.Image != "" {
+		if ref == "" {
+			ref = entry.Image
+		}
+		// The image may be gone already, the ID is recorded either way
+		if img, _, err := p.DockerClient.ImageInspectWithRaw(ctx, ref); err == nil {
+			entry.ImageID = img.ID
+			entry.ImageDigests = img.RepoDigests
+		}
+	}
+
+	if err := log.Write(entry); err != nil {
+		slog.Error("failed to write audit log", "action", entry.Action, "instance", entry.Instance, "error", err)
+	}
+}
+
+// auditEntry returns an audit entry for an action on an inspected runner.
+func auditEntry(action, instance string, inspect types.ContainerJSON) audit.Entry {
+	entry := audit.NewEntry(action, instance)
+	if inspect.ContainerJSONBase == nil {
+		return entry
+	}
+	entry.ContainerID = inspect.ID
+	entry.ImageID = inspect.Image
+	entry.HostConfig = audit.SummarizeHostConfig(inspect.HostConfig)
+	if inspect.Config != nil {
+		entry.Image = inspect.Config.Image
+	}
+	return entry
+}
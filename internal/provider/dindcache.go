@@ -0,0 +1,256 @@
+package provider
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"path"
+	"slices"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/client"
+	"github.com/mercedes-benz/garm-provider-docker/internal/spec"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+const (
+	// seederDataRoot is where the seeder container mounts the runner's data root volume.
+	seederDataRoot = "/var/lib/docker"
+	// dindDaemonConfig is the inner Docker daemon's config file, relative to /.
+	dindDaemonConfig = "etc/docker/daemon.json"
+	// rootlessDaemonConfig is the rootless inner Docker daemon's config file,
+	// relative to the home directory of its user.
+	rootlessDaemonConfig = ".config/docker/daemon.json"
+	// maxDaemonConfigSize caps how much of an existing daemon.json is read.
+	maxDaemonConfigSize = 1 << 20
+)
+
+// seedDinDCache prepares the inner Docker daemon of a created, but not yet
+// started, runner container. It writes the registry mirror config and copies
+// the configured seed into the volume mounted at dataRoot, if any. The
+// seeder container gets the runner's labels, so that DeleteInstance and gc
+// find it if the provider dies while seeding.
+func (p *Provider) seedDinDCache(ctx context.Context, containerID, name, dataRoot string, labels map[string]string) error {
+	cacheCfg := p.Config.DinDCache
+
+	if len(cacheCfg.RegistryMirrors) > 0 {
+		if err := p.writeDaemonConfig(ctx, containerID, cacheCfg.RegistryMirrors); err != nil {
+			return err
+		}
+	}
+
+	if cacheCfg.SeedVolume == "" && cacheCfg.SeedTarball == "" {
+		return nil
+	}
+	if dataRoot == "" {
+		slog.Debug("skipping docker cache seeding, runner has no data root volume", "name", name)
+		return nil
+	}
+
+	inspect, err := p.DockerClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %w", containerID, err)
+	}
+
+	volumeName := ""
+	for _, m := range inspect.Mounts {
+		if m.Type == mount.TypeVolume && m.Destination == dataRoot {
+			volumeName = m.Name
+			break
+		}
+	}
+	if volumeName == "" {
+		return fmt.Errorf("container %s has no volume mounted at %s", containerID, dataRoot)
+	}
+
+	seederLabels := maps.Clone(labels)
+	seederLabels[spec.GarmRoleLabel] = spec.RoleSeeder
+	return p.runSeeder(ctx, name+"-seed", volumeName, seederLabels)
+}
+
+// writeDaemonConfig adds the given registry mirrors to the inner Docker
+// daemon's daemon.json in the container, keeping the other settings and
+// mirrors of a daemon.json shipped in the image.
+func (p *Provider) writeDaemonConfig(ctx context.Context, containerID string, mirrors []string) error {
+	// A rootful daemon reads /etc/docker/daemon.json. A rootless one reads
+	// ~/.config/docker/daemon.json, which is copied with the container
+	// user's ownership, along with its parent directories.
+	root, dirs, file := "/", []string(nil), dindDaemonConfig
+	opts := types.CopyToContainerOptions{}
+	if p.Config.DinDMode == config.DinDModeRootless {
+		home, ok := p.Config.RootlessHome()
+		if !ok {
+			return fmt.Errorf("can't derive the rootless daemon's home from rootless_data_root %s", p.Config.RootlessDataRoot)
+		}
+		root, dirs, file = home, []string{".config/", ".config/docker/"}, rootlessDaemonConfig
+		opts.CopyUIDGID = true
+	}
+
+	daemonCfg, mode, err := p.readDaemonConfig(ctx, containerID, path.Join(root, file))
+	if err != nil {
+		return err
+	}
+	existing, _ := daemonCfg["registry-mirrors"].([]any)
+	merged := slices.Clone(mirrors)
+	for _, m := range existing {
+		if m, ok := m.(string); ok && !slices.Contains(merged, m) {
+			merged = append(merged, m)
+		}
+	}
+	daemonCfg["registry-mirrors"] = merged
+
+	daemonJSON, err := json.MarshalIndent(daemonCfg, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode daemon config: %w", err)
+	}
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, dir := range dirs {
+		if err := tw.WriteHeader(&tar.Header{Typeflag: tar.TypeDir, Name: dir, Mode: 0o755}); err != nil {
+			return fmt.Errorf("failed to write daemon config archive: %w", err)
+		}
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name: file,
+		Mode: mode,
+		Size: int64(len(daemonJSON)),
+	}); err != nil {
+		return fmt.Errorf("failed to write daemon config archive: %w", err)
+	}
+	if _, err := tw.Write(daemonJSON); err != nil {
+		return fmt.Errorf("failed to write daemon config archive: %w", err)
+	}
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write daemon config archive: %w", err)
+	}
+
+	if err := p.DockerClient.CopyToContainer(ctx, containerID, root, &buf, opts); err != nil {
+		return fmt.Errorf("failed to copy daemon config to container %s: %w", containerID, err)
+	}
+	return nil
+}
+
+// readDaemonConfig reads the daemon.json at path from the container and
+// returns its settings and file mode. A missing file yields no settings.
+func (p *Provider) readDaemonConfig(ctx context.Context, containerID, path string) (map[string]any, int64, error) {
+	daemonCfg := map[string]any{}
+	content, _, err := p.DockerClient.CopyFromContainer(ctx, containerID, path)
+	if err != nil {
+		if client.IsErrNotFound(err) {
+			return daemonCfg, 0o644, nil
+		}
+		return nil, 0, fmt.Errorf("failed to read %s from container %s: %w", path, containerID, err)
+	}
+	defer content.Close()
+
+	tr := tar.NewReader(content)
+	hdr, err := tr.Next()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s from container %s: %w", path, containerID, err)
+	}
+	if hdr.Typeflag != tar.TypeReg {
+		return nil, 0, fmt.Errorf("%s in container %s is not a regular file", path, containerID)
+	}
+	data, err := io.ReadAll(io.LimitReader(tr, maxDaemonConfigSize))
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to read %s from container %s: %w", path, containerID, err)
+	}
+	if len(bytes.TrimSpace(data)) > 0 {
+		if err := json.Unmarshal(data, &daemonCfg); err != nil {
+			return nil, 0, fmt.Errorf("invalid %s in container %s: %w", path, containerID, err)
+		}
+	}
+	return daemonCfg, hdr.Mode & 0o7777, nil
+}
+
+// runSeeder runs a helper container that fills the given volume from the
+// configured seed volume or tarball and waits for it to finish.
+func (p *Provider) runSeeder(ctx context.Context, name, volumeName string, labels map[string]string) error {
+	cacheCfg := p.Config.DinDCache
+
+	image := p.Config.MirrorImage(cacheCfg.SeederImage)
+	if _, err := p.ensureImage(ctx, image); err != nil {
+		return err
+	}
+
+	mounts := []mount.Mount{
+		{
+			Type:   mount.TypeVolume,
+			Source: volumeName,
+			Target: seederDataRoot,
+		},
+	}
+	var cmd []string
+	if cacheCfg.SeedVolume != "" {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeVolume,
+			Source:   cacheCfg.SeedVolume,
+			Target:   "/seed",
+			ReadOnly: true,
+		})
+		cmd = []string{"cp", "-a", "/seed/.", seederDataRoot + "/"}
+	} else {
+		mounts = append(mounts, mount.Mount{
+			Type:     mount.TypeBind,
+			Source:   cacheCfg.SeedTarball,
+			Target:   "/seed.tar",
+			ReadOnly: true,
+		})
+		cmd = []string{"tar", "-xf", "/seed.tar", "-C", seederDataRoot}
+	}
+
+	resp, err := p.DockerClient.ContainerCreate(ctx, &container.Config{
+		Image:  image,
+		Cmd:    cmd,
+		Labels: labels,
+	}, &container.HostConfig{
+		Mounts: mounts,
+	}, nil, nil, name)
+	if err != nil {
+		return fmt.Errorf("failed to create seeder container: %w", err)
+	}
+	defer func() {
+		if err := p.DockerClient.ContainerRemove(ctx, resp.ID, types.ContainerRemoveOptions{Force: true}); err != nil {
+			slog.Error("failed to remove seeder container", "id", resp.ID, "error", err)
+		}
+	}()
+
+	slog.Info("seeding docker cache", "volume", volumeName, "seed_volume", cacheCfg.SeedVolume, "seed_tarball", cacheCfg.SeedTarball)
+	if err := p.DockerClient.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("failed to start seeder container: %w", err)
+	}
+
+	// A hung seeder would otherwise block CreateInstance forever. The
+	// caller removes the runner container when seeding fails.
+	waitCtx, cancel := context.WithTimeout(ctx, cacheCfg.SeedTimeout)
+	defer cancel()
+	waitCh, errCh := p.DockerClient.ContainerWait(waitCtx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case result := <-waitCh:
+		if result.Error != nil {
+			return fmt.Errorf("seeder container failed: %s", result.Error.Message)
+		}
+		if result.StatusCode != 0 {
+			return fmt.Errorf("seeder container exited with status %d", result.StatusCode)
+		}
+		return nil
+	case err := <-errCh:
+		if waitCtx.Err() == nil {
+			return fmt.Errorf("failed to wait for seeder container: %w", err)
+		}
+	case <-waitCtx.Done():
+	}
+	if errors.Is(waitCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("seeder container did not finish within %s", cacheCfg.SeedTimeout)
+	}
+	return fmt.Errorf("failed to wait for seeder container: %w", waitCtx.Err())
+}
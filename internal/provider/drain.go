@@ -0,0 +1,77 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/client"
+	"github.com/mercedes-benz/garm-provider-docker/internal/spec"
+)
+
+// drainPollInterval is how often the runner's state is checked while it drains.
+var drainPollInterval = time.Second
+
+// drain asks a running runner to finish its job, using the drain settings
+// recorded in its labels, and waits up to the drain timeout for it to exit.
+// Runners that aren't running or have no drain settings are left alone.
+func (p *Provider) drain(ctx context.Context, inspect types.ContainerJSON) error {
+	if inspect.ContainerJSONBase == nil || inspect.State == nil || !inspect.State.Running || inspect.Config == nil {
+		return nil
+	}
+	drain, err := spec.DrainFromLabels(inspect.Config.Labels)
+	if err != nil {
+		return err
+	}
+	timeout := drain.DrainTimeout()
+	if timeout == 0 {
+		return nil
+	}
+
+	slog.Info("draining runner", "id", inspect.ID, "timeout", timeout)
+	switch {
+	case drain.Signal != "":
+		if err := p.DockerClient.ContainerKill(ctx, inspect.ID, drain.Signal); err != nil {
+			return fmt.Errorf("failed to send %s to container %s: %w", drain.Signal, inspect.ID, err)
+		}
+	case len(drain.Command) > 0:
+		exec, err := p.DockerClient.ContainerExecCreate(ctx, inspect.ID, types.ExecConfig{
+			Cmd:    drain.Command,
+			Detach: true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to create drain command in container %s: %w", inspect.ID, err)
+		}
+		if err := p.DockerClient.ContainerExecStart(ctx, exec.ID, types.ExecStartCheck{Detach: true}); err != nil {
+			return fmt.Errorf("failed to start drain command in container %s: %w", inspect.ID, err)
+		}
+	}
+
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(drainPollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-deadline.C:
+			slog.Warn("runner did not drain in time", "id", inspect.ID, "timeout", timeout)
+			return nil
+		case <-ticker.C:
+			state, err := p.DockerClient.ContainerInspect(ctx, inspect.ID)
+			if err != nil {
+				if client.IsErrNotFound(err) {
+					return nil
+				}
+				return fmt.Errorf("failed to inspect container %s: %w", inspect.ID, err)
+			}
+			if state.ContainerJSONBase == nil || state.State == nil || !state.State.Running {
+				slog.Info("runner drained", "id", inspect.ID)
+				return nil
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/mercedes-benz/garm-provider-docker/internal/audit"
+	"github.com/mercedes-benz/garm-provider-docker/internal/sockproxy"
+	"github.com/mercedes-benz/garm-provider-docker/internal/spec"
+)
+
+// Kinds of Docker objects handled by the garbage collector.
+const (
+	GCKindContainer = "container"
+	GCKindVolume    = "volume"
+	GCKindNetwork   = "network"
+)
+
+// GCOptions controls a garbage collection pass.
+type GCOptions struct {
+	// LiveControllers are the IDs of the Garm controllers still in use.
+	// Objects of any other controller are removed.
+	LiveControllers []string
+	// LivePools are the IDs of the pools still in use. If empty, pools are not
+	// checked and only objects of dead controllers are removed.
+	LivePools []string
+	// DryRun only reports what would be removed.
+	DryRun bool
+}
+
+// GCObject is a Garm-labelled Docker object, or an object a job created
+// through a runner's Docker socket proxy.
+type GCObject struct {
+	Kind    string `json:"kind"`
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Orphan  bool   `json:"orphan"`
+	Removed bool   `json:"removed"`
+	Error   string `json:"error,omitempty"`
+
+	// runner is set for runner containers, which are removed like
+	// DeleteInstance does
+	runner bool
+}
+
+// GCGroup holds the objects of one controller and pool.
+type GCGroup struct {
+	ControllerID string     `json:"controller_id"`
+	PoolID       string     `json:"pool_id"`
+	Objects      []GCObject `json:"objects"`
+}
+
+// GarbageCollect finds all Garm-labelled containers, volumes and networks,
+// and those jobs created through a socket proxy, groups them by controller
+// and pool, and removes those that don't belong to a live controller and
+// pool. Objects created through a proxy belong to the controller and pool of
+// the runner owning them, and are orphans once that runner is gone.
+func (p *Provider) GarbageCollect(ctx context.Context, opts GCOptions) ([]GCGroup, error) {
+	if len(opts.LiveControllers) == 0 {
+		return nil, fmt.Errorf("at least one live controller ID is required")
+	}
+
+	var (
+		containers []types.Container
+		volumes    []*volume.Volume
+		networks   []types.NetworkResource
+	)
+	for _, label := range []string{spec.GarmControllerIDLabel, sockproxy.OwnerLabel} {
+		filtersArgs := filters.NewArgs(filters.Arg("label", label))
+		c, err := p.DockerClient.ContainerList(ctx, types.ContainerListOptions{
+			Filters: filtersArgs,
+			All:     true,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list containers: %w", err)
+		}
+		containers = append(containers, c...)
+		v, err := p.DockerClient.VolumeList(ctx, volume.ListOptions{Filters: filtersArgs})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list volumes: %w", err)
+		}
+		volumes = append(volumes, v.Volumes...)
+		n, err := p.DockerClient.NetworkList(ctx, types.NetworkListOptions{Filters: filtersArgs})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list networks: %w", err)
+		}
+		networks = append(networks, n...)
+	}
+
+	// Runners by name, to find the owners of objects created through a proxy
+	runners := map[string]map[string]string{}
+	for _, c := range containers {
+		if name := c.Labels[spec.GarmInstanceNameLabel]; name != "" && c.Labels[spec.GarmControllerIDLabel] != "" && isRunner(c.Labels) {
+			runners[name] = c.Labels
+		}
+	}
+
+	groups := map[[2]string]*GCGroup{}
+	seen := map[[2]string]bool{}
+	add := func(kind, id, name string, labels map[string]string) {
+		if seen[[2]string{kind, id}] {
+			return
+		}
+		seen[[2]string{kind, id}] = true
+
+		controllerID, poolID := labels[spec.GarmControllerIDLabel], labels[spec.GarmPoolIDLabel]
+		owned := controllerID == ""
+		if owned {
+			runner := runners[labels[sockproxy.OwnerLabel]]
+			controllerID, poolID = runner[spec.GarmControllerIDLabel], runner[spec.GarmPoolIDLabel]
+		}
+		key := [2]string{controllerID, poolID}
+		if groups[key] == nil {
+			groups[key] = &GCGroup{ControllerID: controllerID, PoolID: poolID}
+		}
+		orphan := !slices.Contains(opts.LiveControllers, controllerID) ||
+			(len(opts.LivePools) > 0 && poolID != "" && !slices.Contains(opts.LivePools, poolID))
+		groups[key].Objects = append(groups[key].Objects, GCObject{
+			Kind:   kind,
+			ID:     id,
+			Name:   name,
+			Orphan: orphan,
+			runner: kind == GCKindContainer && !owned && isRunner(labels),
+		})
+	}
+
+	for _, c := range containers {
+		name := ""
+		if len(c.Names) > 0 {
+			name = strings.TrimPrefix(c.Names[0], "/")
+		}
+		add(GCKindContainer, c.ID, name, c.Labels)
+	}
+	for _, v := range volumes {
+		add(GCKindVolume, v.Name, v.Name, v.Labels)
+	}
+	for _, n := range networks {
+		add(GCKindNetwork, n.ID, n.Name, n.Labels)
+	}
+
+	result := make([]GCGroup, 0, len(groups))
+	for _, g := range groups {
+		result = append(result, *g)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ControllerID != result[j].ControllerID {
+			return result[i].ControllerID < result[j].ControllerID
+		}
+		return result[i].PoolID < result[j].PoolID
+	})
+
+	if opts.DryRun {
+		return result, nil
+	}
+
+	// Runners go first, together with their sidecars, volumes and the
+	// objects their jobs created. Other containers follow, volumes and
+	// networks can't be removed while in use.
+	passes := []func(obj GCObject) bool{
+		func(obj GCObject) bool { return obj.runner },
+		func(obj GCObject) bool { return obj.Kind == GCKindContainer },
+		func(obj GCObject) bool { return obj.Kind == GCKindVolume },
+		func(obj GCObject) bool { return obj.Kind == GCKindNetwork },
+	}
+	for _, pass := range passes {
+		for i := range result {
+			for j := range result[i].Objects {
+				obj := &result[i].Objects[j]
+				if !obj.Orphan || obj.Removed || obj.Error != "" || !pass(*obj) {
+					continue
+				}
+				if err := p.removeGCObject(ctx, result[i].ControllerID, *obj); err != nil && !client.IsErrNotFound(err) {
+					obj.Error = err.Error()
+				} else {
+					obj.Removed = true
+				}
+			}
+		}
+	}
+	return result, nil
+}
+
+// removeGCObject removes an orphaned object. Runners go through the same
+// path as DeleteInstance, with hooks, log archive and audit entry.
+func (p *Provider) removeGCObject(ctx context.Context, controllerID string, obj GCObject) error {
+	switch obj.Kind {
+	case GCKindContainer:
+		if obj.runner {
+			return p.deleteInstance(ctx, audit.ActionGarbageCollect, controllerID, obj.ID)
+		}
+		return p.DockerClient.ContainerRemove(ctx, obj.ID, types.ContainerRemoveOptions{
+			Force:         true,
+			RemoveVolumes: true,
+		})
+	case GCKindVolume:
+		return p.DockerClient.VolumeRemove(ctx, obj.ID, true)
+	case GCKindNetwork:
+		return p.DockerClient.NetworkRemove(ctx, obj.ID)
+	default:
+		return fmt.Errorf("unknown object kind %q", obj.Kind)
+	}
+}
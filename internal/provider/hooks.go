@@ -0,0 +1,167 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/docker/docker/api/types"
+	"github.com/mercedes-benz/garm-provider-docker/internal/spec"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// hookPollInterval is how often an exec hook is checked for completion.
+var hookPollInterval = 100 * time.Millisecond
+
+// runHooks runs the hooks of an event for an instance. containerID is the
+// runner container exec hooks run in. If it is empty, because the container
+// doesn't exist, exec hooks are skipped. It returns an error only if a hook
+// with the "abort" policy failed, which pre_delete hooks can't have.
+func (p *Provider) runHooks(ctx context.Context, event config.HookEvent, containerID string, instance params.ProviderInstance) error {
+	hooks := p.Config.Hooks.Hooks(event)
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	instanceJSON, err := json.Marshal(instance)
+	if err != nil {
+		return fmt.Errorf("failed to encode instance: %w", err)
+	}
+
+	for i, hook := range hooks {
+		if len(hook.Exec) > 0 && containerID == "" {
+			slog.Debug("skipping exec hook without container", "event", event, "hook", i, "instance", instance.Name)
+			continue
+		}
+		timeout := hook.Timeout
+		if timeout == 0 {
+			timeout = config.DefaultHookTimeout
+		}
+		hookCtx, cancel := context.WithTimeout(ctx, timeout)
+		if len(hook.Exec) > 0 {
+			err = p.runExecHook(hookCtx, hook, event, containerID, instanceJSON)
+		} else {
+			err = runCommandHook(hookCtx, hook, event, instanceJSON)
+		}
+		cancel()
+		if err == nil {
+			continue
+		}
+
+		switch hook.OnFailure {
+		case config.HookFailureAbort:
+			return fmt.Errorf("%s hook %d failed: %w", event, i, err)
+		case config.HookFailureIgnore:
+			slog.Debug("hook failed", "event", event, "hook", i, "instance", instance.Name, "error", err)
+		default:
+			slog.Warn("hook failed", "event", event, "hook", i, "instance", instance.Name, "error", err)
+		}
+	}
+	return nil
+}
+
+// hookEnv returns the environment variables passed to hooks.
+func hookEnv(event config.HookEvent, instanceJSON []byte) []string {
+	return []string{
+		"GARM_HOOK=" + string(event),
+		"GARM_INSTANCE=" + string(instanceJSON),
+	}
+}
+
+// hostEnvAllowList are the variables of the provider's environment passed on
+// to host command hooks. The rest of it can hold resolved secrets and the
+// GARM_* variables of the provider call, so it is not passed on.
+var hostEnvAllowList = []string{"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "TZ", "TMPDIR"}
+
+// hostEnv returns the allow-listed variables of the provider's environment,
+// and the locale variables.
+func hostEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		name, _, _ := strings.Cut(kv, "=")
+		if slices.Contains(hostEnvAllowList, name) || strings.HasPrefix(name, "LC_") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// runCommandHook runs a hook on the host, with the instance's JSON on stdin.
+func runCommandHook(ctx context.Context, hook config.HookConfig, event config.HookEvent, instanceJSON []byte) error {
+	cmd := exec.CommandContext(ctx, hook.Command[0], hook.Command[1:]...)
+	cmd.Env = append(hostEnv(), hookEnv(event, instanceJSON)...)
+	cmd.Stdin = bytes.NewReader(instanceJSON)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if ctx.Err() != nil {
+			return fmt.Errorf("%s timed out", hook.Command[0])
+		}
+		if out := strings.TrimSpace(string(output)); out != "" {
+			return fmt.Errorf("%s: %w: %s", hook.Command[0], err, out)
+		}
+		return fmt.Errorf("%s: %w", hook.Command[0], err)
+	}
+	return nil
+}
+
+// runExecHook runs a hook inside the runner container and waits for it to
+// exit. A hook that times out keeps running in the container.
+func (p *Provider) runExecHook(ctx context.Context, hook config.HookConfig, event config.HookEvent, containerID string, instanceJSON []byte) error {
+	resp, err := p.DockerClient.ContainerExecCreate(ctx, containerID, types.ExecConfig{
+		Cmd:    hook.Exec,
+		Env:    hookEnv(event, instanceJSON),
+		Detach: true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create exec in container %s: %w", containerID, err)
+	}
+	if err := p.DockerClient.ContainerExecStart(ctx, resp.ID, types.ExecStartCheck{Detach: true}); err != nil {
+		return fmt.Errorf("failed to start exec in container %s: %w", containerID, err)
+	}
+
+	ticker := time.NewTicker(hookPollInterval)
+	defer ticker.Stop()
+	for {
+		inspect, err := p.DockerClient.ContainerExecInspect(ctx, resp.ID)
+		if err != nil {
+			if ctx.Err() != nil {
+				return fmt.Errorf("%s timed out", hook.Exec[0])
+			}
+			return fmt.Errorf("failed to inspect exec %s: %w", resp.ID, err)
+		}
+		if !inspect.Running {
+			if inspect.ExitCode != 0 {
+				return fmt.Errorf("%s exited with code %d", hook.Exec[0], inspect.ExitCode)
+			}
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%s timed out", hook.Exec[0])
+		case <-ticker.C:
+		}
+	}
+}
+
+// hookInstance returns the instance passed to hooks for an inspected runner.
+// name is used if the container couldn't be inspected.
+func hookInstance(inspect types.ContainerJSON, name string) params.ProviderInstance {
+	if inspect.ContainerJSONBase == nil || inspect.Config == nil {
+		return params.ProviderInstance{Name: name}
+	}
+	instance := containerToInstance(inspect)
+	if labelName := inspect.Config.Labels[spec.GarmInstanceNameLabel]; labelName != "" {
+		instance.Name = labelName
+	}
+	instance.Addresses = containerToAddresses(inspect)
+	return instance
+}
@@ -0,0 +1,292 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/client"
+	"github.com/mercedes-benz/garm-provider-docker/internal/filelock"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// ImageGCOptions controls an image garbage collection pass.
+type ImageGCOptions struct {
+	// Images are the patterns of the repositories to collect.
+	Images []string
+	// Retention is how long after their creation images are kept.
+	// 0 disables the check.
+	Retention time.Duration
+	// KeepDigests is how many of the newest images are always kept per
+	// repository. 0 disables the check.
+	KeepDigests int
+	// LockPath is the lock file shared with CreateInstance. Empty disables
+	// locking.
+	LockPath string
+	// DryRun only reports what would be removed.
+	DryRun bool
+}
+
+// ImageGCOptionsFromConfig returns the image garbage collector options from
+// the provider config.
+func ImageGCOptionsFromConfig(cfg *config.ProviderConfig) ImageGCOptions {
+	return ImageGCOptions{
+		Images:      cfg.ImageGC.Images,
+		Retention:   cfg.ImageGC.Retention,
+		KeepDigests: cfg.ImageGC.KeepDigests,
+		LockPath:    cfg.ImageGC.LockPath,
+	}
+}
+
+// ImageGCImage is a local image of a collected repository.
+type ImageGCImage struct {
+	ID string `json:"id"`
+	// Repositories the image is tagged or pulled by digest in.
+	Repositories []string `json:"repositories"`
+	// References are the tags and digests that point to the image.
+	References []string  `json:"references"`
+	Created    time.Time `json:"created"`
+	// Size is the disk space used by the image alone, without the layers it
+	// shares with other images.
+	Size  int64 `json:"size"`
+	InUse bool  `json:"in_use"`
+	// Reason is why the image is removed, empty if it is kept.
+	Reason  string `json:"reason,omitempty"`
+	Removed bool   `json:"removed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// ImageGCReport is the outcome of an image garbage collection pass.
+type ImageGCReport struct {
+	Images []ImageGCImage `json:"images"`
+	// Reclaimed is the disk space freed by the removed images. In a dry run,
+	// it is the space the removal would free at least.
+	Reclaimed int64 `json:"reclaimed"`
+}
+
+// CollectImages removes local images of the configured repositories that no
+// container uses. The newest KeepDigests images of each repository are
+// always kept; the others are removed once they are older than the
+// retention, or right away without one. Images that also belong to a
+// repository outside the patterns are kept.
+func (p *Provider) CollectImages(ctx context.Context, opts ImageGCOptions) (ImageGCReport, error) {
+	gc := config.ImageGCConfig{Images: opts.Images}
+	if !gc.Enabled() {
+		return ImageGCReport{}, fmt.Errorf("no image patterns to collect")
+	}
+	if opts.Retention == 0 && opts.KeepDigests == 0 {
+		return ImageGCReport{}, fmt.Errorf("a retention or a number of images to keep is required")
+	}
+
+	// Wait for CreateInstance calls between pulling an image and creating
+	// their container
+	unlock, err := lockImages(opts.LockPath, filelock.Lock)
+	if err != nil {
+		return ImageGCReport{}, err
+	}
+	defer unlock()
+
+	images, err := p.DockerClient.ImageList(ctx, types.ImageListOptions{SharedSize: true})
+	if err != nil {
+		return ImageGCReport{}, fmt.Errorf("failed to list images: %w", err)
+	}
+	containers, err := p.DockerClient.ContainerList(ctx, types.ContainerListOptions{All: true})
+	if err != nil {
+		return ImageGCReport{}, fmt.Errorf("failed to list containers: %w", err)
+	}
+	inUse := map[string]bool{}
+	for _, c := range containers {
+		inUse[c.ImageID] = true
+	}
+
+	report := ImageGCReport{Images: []ImageGCImage{}}
+	byRepo := map[string][]int{}
+	for _, img := range images {
+		refs, repos := imageReferences(img)
+		if len(repos) == 0 || !allMatch(gc, repos) {
+			continue
+		}
+		size := img.Size
+		if img.SharedSize > 0 {
+			size -= img.SharedSize
+		}
+		for _, repo := range repos {
+			byRepo[repo] = append(byRepo[repo], len(report.Images))
+		}
+		report.Images = append(report.Images, ImageGCImage{
+			ID:           img.ID,
+			Repositories: repos,
+			References:   refs,
+			Created:      time.Unix(img.Created, 0),
+			Size:         size,
+			InUse:        inUse[img.ID],
+		})
+	}
+
+	// The newest images of each repository are kept, whether they are in use
+	// or not, and however old they are
+	keep := map[int]bool{}
+	for _, idx := range byRepo {
+		sort.Slice(idx, func(i, j int) bool {
+			return report.Images[idx[i]].Created.After(report.Images[idx[j]].Created)
+		})
+		for rank, i := range idx {
+			if rank < opts.KeepDigests {
+				keep[i] = true
+			}
+		}
+	}
+	for i := range report.Images {
+		img := &report.Images[i]
+		switch {
+		case img.InUse, keep[i]:
+		case opts.Retention == 0:
+			img.Reason = fmt.Sprintf("older than the %d newest images", opts.KeepDigests)
+		case time.Since(img.Created) > opts.Retention:
+			img.Reason = fmt.Sprintf("created more than %s ago", opts.Retention)
+		}
+	}
+	sort.Slice(report.Images, func(i, j int) bool {
+		a, b := report.Images[i], report.Images[j]
+		if a.Repositories[0] != b.Repositories[0] {
+			return a.Repositories[0] < b.Repositories[0]
+		}
+		return a.Created.After(b.Created)
+	})
+
+	if opts.DryRun {
+		for _, img := range report.Images {
+			if img.Reason != "" {
+				report.Reclaimed += img.Size
+			}
+		}
+		return report, nil
+	}
+
+	before, err := p.DockerClient.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.ImageObject}})
+	if err != nil {
+		return ImageGCReport{}, fmt.Errorf("failed to get disk usage: %w", err)
+	}
+	var removedSize int64
+	for i := range report.Images {
+		img := &report.Images[i]
+		if img.Reason == "" {
+			continue
+		}
+		if err := p.removeImage(ctx, *img); err != nil {
+			img.Error = err.Error()
+			continue
+		}
+		img.Removed = true
+		removedSize += img.Size
+	}
+
+	after, err := p.DockerClient.DiskUsage(ctx, types.DiskUsageOptions{Types: []types.DiskUsageObject{types.ImageObject}})
+	if err != nil {
+		// The images are gone either way, fall back to their own sizes
+		slog.Warn("failed to get disk usage after removing images", "error", err)
+		report.Reclaimed = removedSize
+	} else {
+		report.Reclaimed = max(before.LayersSize-after.LayersSize, 0)
+	}
+	return report, nil
+}
+
+// collectImagesAfterPull runs an image garbage collection pass after
+// CreateInstance pulled a runner image. Failures are only logged, as the
+// runner is up already.
+func (p *Provider) collectImagesAfterPull(ctx context.Context) {
+	report, err := p.CollectImages(ctx, ImageGCOptionsFromConfig(p.Config))
+	if err != nil {
+		slog.Error("failed to collect runner images", "error", err)
+		return
+	}
+	removed := 0
+	for _, img := range report.Images {
+		if img.Removed {
+			removed++
+		} else if img.Error != "" {
+			slog.Error("failed to remove runner image", "id", img.ID, "error", img.Error)
+		}
+	}
+	slog.Info("collected runner images", "removed", removed, "reclaimed_bytes", report.Reclaimed)
+}
+
+// removeImage removes each reference of an image, so that Docker deletes it
+// with the last one. Images that a container uses are left alone, rather than
+// losing all but their last reference before Docker refuses to delete them.
+func (p *Provider) removeImage(ctx context.Context, img ImageGCImage) error {
+	filtersArgs := filters.NewArgs()
+	filtersArgs.Add("ancestor", img.ID)
+	containers, err := p.DockerClient.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filtersArgs,
+		All:     true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to list containers of image: %w", err)
+	}
+	if len(containers) > 0 {
+		return fmt.Errorf("image is in use by container %s", containers[0].ID)
+	}
+	for _, ref := range img.References {
+		_, err := p.DockerClient.ImageRemove(ctx, ref, types.ImageRemoveOptions{PruneChildren: true})
+		if err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to remove %s: %w", ref, err)
+		}
+	}
+	slog.Info("removed runner image", "id", img.ID, "references", img.References, "size", img.Size)
+	return nil
+}
+
+// lockImages takes the image garbage collector lock with lock, or does
+// nothing if no lock file is configured. CreateInstance holds it shared from
+// pulling an image until its container is created, a pass holds it
+// exclusively.
+func lockImages(path string, lock func(string) (func(), error)) (func(), error) {
+	if path == "" {
+		return func() {}, nil
+	}
+	unlock, err := lock(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock images: %w", err)
+	}
+	return unlock, nil
+}
+
+// imageReferences returns the tags and digests of an image, and the
+// repositories they belong to.
+func imageReferences(img types.ImageSummary) ([]string, []string) {
+	var refs, repos []string
+	for _, ref := range append(append([]string{}, img.RepoTags...), img.RepoDigests...) {
+		if strings.HasPrefix(ref, "<none>") {
+			continue
+		}
+		named, err := reference.ParseNormalizedNamed(ref)
+		if err != nil {
+			continue
+		}
+		refs = append(refs, ref)
+		if name := named.Name(); !slices.Contains(repos, name) {
+			repos = append(repos, name)
+		}
+	}
+	sort.Strings(repos)
+	return refs, repos
+}
+
+// allMatch reports whether all repositories match the collected patterns.
+func allMatch(gc config.ImageGCConfig, repos []string) bool {
+	for _, repo := range repos {
+		if !gc.Matches(repo) {
+			return false
+		}
+	}
+	return true
+}
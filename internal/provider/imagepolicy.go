@@ -0,0 +1,73 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/mercedes-benz/garm-provider-docker/internal/imagesig"
+)
+
+// verifyImage checks the signature of a pulled runner image and returns the
+// image pinned to the verified digest, so that the container runs exactly
+// what was verified even if the tag moves in the meantime.
+func (p *Provider) verifyImage(ctx context.Context, image string) (string, error) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return "", fmt.Errorf("invalid image %q: %w", image, err)
+	}
+
+	digest, err := p.imageDigest(ctx, image, named)
+	if err != nil {
+		return "", err
+	}
+
+	verifier, err := imagesig.New(p.Config.ImagePolicy.Signature, p.registryCredentials)
+	if err != nil {
+		return "", fmt.Errorf("failed to set up signature verification: %w", err)
+	}
+	if err := verifier.Verify(ctx, named.Name(), digest); err != nil {
+		return "", fmt.Errorf("image %s failed signature verification: %w", image, err)
+	}
+	slog.Info("verified image signature", "image", image, "digest", digest)
+	return named.Name() + "@" + digest, nil
+}
+
+// imageDigest returns the registry digest of a local image: the one it is
+// pinned to, or the one it was pulled with.
+func (p *Provider) imageDigest(ctx context.Context, image string, named reference.Named) (string, error) {
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical.Digest().String(), nil
+	}
+
+	inspect, _, err := p.DockerClient.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", fmt.Errorf("failed to inspect image %s: %w", image, err)
+	}
+	for _, repoDigest := range inspect.RepoDigests {
+		ref, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+		if canonical, ok := ref.(reference.Canonical); ok && ref.Name() == named.Name() {
+			return canonical.Digest().String(), nil
+		}
+	}
+	return "", fmt.Errorf("image %s has no digest from %s, it was not pulled from there and can't be verified", image, reference.Domain(named))
+}
+
+// registryCredentials returns the credentials used to pull an image, to read
+// its signature with.
+func (p *Provider) registryCredentials(image string) (registry.AuthConfig, error) {
+	auth, err := p.registryAuth(image)
+	if err != nil || auth == "" {
+		return registry.AuthConfig{}, err
+	}
+	cfg, err := registry.DecodeAuthConfig(auth)
+	if err != nil {
+		return registry.AuthConfig{}, err
+	}
+	return *cfg, nil
+}
@@ -0,0 +1,51 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/stdcopy"
+)
+
+// LogsOptions selects the logs of a runner written by Logs.
+type LogsOptions struct {
+	// Follow keeps streaming new lines until ctx is done.
+	Follow bool
+	// Tail is the number of lines from the end, or "all".
+	Tail string
+	// Timestamps prefixes each line with Docker's timestamp.
+	Timestamps bool
+}
+
+// Logs writes the stdout and stderr of a runner container to w.
+func (p *Provider) Logs(ctx context.Context, instance string, w io.Writer, opts LogsOptions) error {
+	inspect, err := p.DockerClient.ContainerInspect(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %w", instance, err)
+	}
+
+	reader, err := p.DockerClient.ContainerLogs(ctx, inspect.ID, types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Follow:     opts.Follow,
+		Tail:       opts.Tail,
+		Timestamps: opts.Timestamps,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get logs of container %s: %w", instance, err)
+	}
+	defer reader.Close()
+
+	if inspect.Config != nil && inspect.Config.Tty {
+		_, err = io.Copy(w, reader)
+	} else {
+		// Without a TTY, stdout and stderr are multiplexed
+		_, err = stdcopy.StdCopy(w, w, reader)
+	}
+	if err != nil && ctx.Err() == nil {
+		return fmt.Errorf("failed to read logs of container %s: %w", instance, err)
+	}
+	return nil
+}
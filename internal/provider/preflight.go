@@ -0,0 +1,201 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/versions"
+	"github.com/mercedes-benz/garm-provider-docker/internal/imagesig"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// MinAPIVersion is the oldest Docker API version the provider works with.
+const MinAPIVersion = "1.41"
+
+// imageMountAPIVersion is the Docker API version that added image mounts.
+const imageMountAPIVersion = "1.48"
+
+// Statuses of a preflight check.
+const (
+	CheckOK     = "ok"
+	CheckFailed = "failed"
+)
+
+// Check is the result of a preflight check of the Docker daemon.
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// CheckDaemon checks that the Docker daemon can run runners with the loaded
+// config: the API version is recent enough, the runtime and network exist,
+// registry credentials can be resolved for images, in addition to the
+// images the config itself refers to, and the runner images pass the image
+// policy.
+func (p *Provider) CheckDaemon(ctx context.Context, images []string) []Check {
+	return []Check{
+		p.checkAPIVersion(ctx),
+		p.checkRuntime(ctx),
+		p.checkNetwork(ctx),
+		p.checkRegistryAuth(append(p.configImages(), images...)),
+		p.checkImagePolicy(images),
+	}
+}
+
+func (p *Provider) checkAPIVersion(ctx context.Context) Check {
+	check := Check{Name: "api_version"}
+	version, err := p.DockerClient.ServerVersion(ctx)
+	if err != nil {
+		check.Status, check.Detail = CheckFailed, fmt.Sprintf("failed to get server version: %s", err)
+		return check
+	}
+
+	minVersion, reason := MinAPIVersion, ""
+	for _, m := range p.Config.Mounts {
+		if m.Type == config.MountTypeImage {
+			minVersion, reason = imageMountAPIVersion, ", needed for image mounts"
+			break
+		}
+	}
+	if versions.LessThan(version.APIVersion, minVersion) {
+		check.Status = CheckFailed
+		check.Detail = fmt.Sprintf("Docker %s has API version %s, at least %s is required%s", version.Version, version.APIVersion, minVersion, reason)
+		return check
+	}
+	check.Status, check.Detail = CheckOK, fmt.Sprintf("Docker %s, API version %s", version.Version, version.APIVersion)
+	return check
+}
+
+func (p *Provider) checkRuntime(ctx context.Context) Check {
+	check := Check{Name: "runtime"}
+	info, err := p.DockerClient.Info(ctx)
+	if err != nil {
+		check.Status, check.Detail = CheckFailed, fmt.Sprintf("failed to get daemon info: %s", err)
+		return check
+	}
+	if _, ok := info.Runtimes[p.Config.Runtime]; !ok {
+		available := make([]string, 0, len(info.Runtimes))
+		for name := range info.Runtimes {
+			available = append(available, name)
+		}
+		sort.Strings(available)
+		check.Status = CheckFailed
+		check.Detail = fmt.Sprintf("runtime %q is not configured in the daemon, available: %s", p.Config.Runtime, strings.Join(available, ", "))
+		return check
+	}
+	check.Status, check.Detail = CheckOK, p.Config.Runtime
+	return check
+}
+
+func (p *Provider) checkNetwork(ctx context.Context) Check {
+	check := Check{Name: "network"}
+	name := p.Config.Network
+	if name == "host" || name == "none" || strings.HasPrefix(name, "container:") {
+		check.Status, check.Detail = CheckOK, fmt.Sprintf("network mode %q", name)
+		return check
+	}
+
+	networks, err := p.DockerClient.NetworkList(ctx, types.NetworkListOptions{
+		Filters: filters.NewArgs(filters.Arg("name", name)),
+	})
+	if err != nil {
+		check.Status, check.Detail = CheckFailed, fmt.Sprintf("failed to list networks: %s", err)
+		return check
+	}
+	// The name filter matches substrings
+	for _, n := range networks {
+		if n.Name == name || n.ID == name {
+			check.Status, check.Detail = CheckOK, fmt.Sprintf("%s (%s driver)", n.Name, n.Driver)
+			return check
+		}
+	}
+	check.Status, check.Detail = CheckFailed, fmt.Sprintf("network %q does not exist", name)
+	return check
+}
+
+// configImages returns the images the config makes the provider pull.
+func (p *Provider) configImages() []string {
+	var images []string
+	if p.Config.SocketProxy.Enabled {
+		images = append(images, p.Config.SocketProxy.Image)
+	}
+	if p.Config.DinDCache.SeedVolume != "" || p.Config.DinDCache.SeedTarball != "" {
+		images = append(images, p.Config.DinDCache.SeederImage)
+	}
+	for _, m := range p.Config.Mounts {
+		if m.Type == config.MountTypeImage {
+			images = append(images, m.Source)
+		}
+	}
+	return images
+}
+
+func (p *Provider) checkRegistryAuth(images []string) Check {
+	check := Check{Name: "registry_auth", Status: CheckOK}
+	if len(images) == 0 {
+		// Still catch a broken Docker config
+		if _, err := p.registryAuth(""); err != nil {
+			check.Status, check.Detail = CheckFailed, err.Error()
+		} else {
+			check.Detail = "no images to check"
+		}
+		return check
+	}
+
+	var details []string
+	for _, image := range images {
+		// Credentials are looked up for the image that is actually pulled
+		pulled := p.Config.MirrorImage(image)
+		if pulled != image {
+			image = fmt.Sprintf("%s (via %s)", image, pulled)
+		}
+		auth, err := p.registryAuth(pulled)
+		switch {
+		case err != nil:
+			check.Status = CheckFailed
+			details = append(details, fmt.Sprintf("%s: %s", image, err))
+		case auth == "":
+			details = append(details, fmt.Sprintf("%s: no credentials for %s, pulling anonymously", image, registryHost(pulled)))
+		default:
+			if reg, ok := p.Config.RegistryCredentials(pulled); ok {
+				details = append(details, fmt.Sprintf("%s: using credentials of registries entry %q", image, reg.Match))
+			} else {
+				details = append(details, fmt.Sprintf("%s: using credentials for %s", image, registryHost(pulled)))
+			}
+		}
+	}
+	check.Detail = strings.Join(details, "; ")
+	return check
+}
+
+// checkImagePolicy checks that the signature public key loads and that the
+// given runner images pass the image policy. Signatures themselves are only
+// verified once an image is pulled.
+func (p *Provider) checkImagePolicy(images []string) Check {
+	check := Check{Name: "image_policy", Status: CheckOK}
+	var details []string
+	if sig := p.Config.ImagePolicy.Signature; sig.Enabled() {
+		if _, err := imagesig.LoadPublicKey(sig.PublicKey); err != nil {
+			check.Status = CheckFailed
+			details = append(details, err.Error())
+		}
+	}
+	for _, image := range images {
+		if err := p.Config.CheckImage(image, p.Config.Security, nil); err != nil {
+			check.Status = CheckFailed
+			details = append(details, err.Error())
+		} else {
+			details = append(details, image+": allowed")
+		}
+	}
+	if len(images) == 0 {
+		details = append(details, "no images to check")
+	}
+	check.Detail = strings.Join(details, "; ")
+	return check
+}
@@ -7,17 +7,27 @@ import (
 	"fmt"
 	"io"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/cloudbase/garm-provider-common/params"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/filters"
-	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/jsonmessage"
+	"github.com/mercedes-benz/garm-provider-docker/internal/audit"
+	"github.com/mercedes-benz/garm-provider-docker/internal/dind"
+	"github.com/mercedes-benz/garm-provider-docker/internal/filelock"
+	"github.com/mercedes-benz/garm-provider-docker/internal/metrics"
+	"github.com/mercedes-benz/garm-provider-docker/internal/sockproxy"
 	"github.com/mercedes-benz/garm-provider-docker/internal/spec"
 	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
@@ -26,120 +36,230 @@ import (
 type DockerClient interface {
 	ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error)
 	ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error)
+	ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error)
+	ImageRemove(ctx context.Context, imageID string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error)
 	ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error)
 	ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error
 	ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error
 	ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error)
 	ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error)
 	ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
+	ContainerKill(ctx context.Context, containerID, signal string) error
+	ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error)
+	ContainerExecStart(ctx context.Context, execID string, config types.ExecStartCheck) error
+	ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error)
+	ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error)
+	CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options types.CopyToContainerOptions) error
+	CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error)
+	NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error)
+	NetworkRemove(ctx context.Context, networkID string) error
+	VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error)
+	VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error)
+	VolumeRemove(ctx context.Context, volumeID string, force bool) error
+	Info(ctx context.Context) (types.Info, error)
+	ServerVersion(ctx context.Context) (types.Version, error)
+	DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error)
 }
 
 type Provider struct {
 	ControllerID string
 	PoolID       string
+	// Config is the provider config. It must not be modified while the
+	// provider is in use.
+	Config       *config.ProviderConfig
 	DockerClient DockerClient
+	// Metrics records pull and container latencies. It may be nil.
+	Metrics *metrics.Recorder
 }
 
-func NewDockerProvider(controllerID, poolID string) (*Provider, error) {
-	cli, err := client.NewClientWithOpts(client.WithHost(config.Config.DockerHost), client.WithAPIVersionNegotiation())
+func NewDockerProvider(cfg *config.ProviderConfig, controllerID, poolID string) (*Provider, error) {
+	cli, err := client.NewClientWithOpts(client.WithHost(cfg.DockerHost), client.WithAPIVersionNegotiation())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create docker client: %w", err)
 	}
 
+	var dockerClient DockerClient = cli
+	if cfg.Tracing.Enabled() {
+		dockerClient = newTracedClient(cli)
+	}
+
 	return &Provider{
 		ControllerID: controllerID,
 		PoolID:       poolID,
-		DockerClient: cli,
+		Config:       cfg,
+		DockerClient: dockerClient,
 	}, nil
 }
 
 func (p *Provider) CreateInstance(ctx context.Context, bootstrapParams params.BootstrapInstance) (params.ProviderInstance, error) {
-	// 1. Check/Pull Image
-	needsPull := config.Config.AlwaysPull
-	if !needsPull {
-		_, _, err := p.DockerClient.ImageInspectWithRaw(ctx, bootstrapParams.Image)
-		if err != nil {
-			if client.IsErrNotFound(err) {
-				needsPull = true
-			} else {
-				return params.ProviderInstance{}, fmt.Errorf("failed to inspect image %s: %w", bootstrapParams.Image, err)
-			}
-		}
-	}
+	entry := audit.NewEntry(audit.ActionCreateInstance, bootstrapParams.Name)
+	entry.Image = bootstrapParams.Image
+	instance, err := p.createInstance(ctx, bootstrapParams, &entry)
+	p.audit(ctx, entry, err)
+	return instance, err
+}
 
-	if needsPull {
-		slog.Info("pulling image", "image", bootstrapParams.Image, "always_pull", config.Config.AlwaysPull)
-		pullOpts := types.ImagePullOptions{}
-		if authStr := getRegistryAuth(bootstrapParams.Image); authStr != "" {
-			pullOpts.RegistryAuth = authStr
-		}
-		reader, err := p.DockerClient.ImagePull(ctx, bootstrapParams.Image, pullOpts)
+// createInstance creates and starts a runner, filling in the audit entry as
+// it goes.
+func (p *Provider) createInstance(ctx context.Context, bootstrapParams params.BootstrapInstance, entry *audit.Entry) (params.ProviderInstance, error) {
+	// 1. Check the image against the image policy and pull it, through a
+	// mirror if one is configured. Whether it must be pinned depends on the
+	// pool's security settings and mounts.
+	extraSpecs, err := spec.ParseExtraSpecs(bootstrapParams.ExtraSpecs)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+	security, err := spec.GetSecurityConfig(p.Config, extraSpecs)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+	if err := p.Config.CheckImage(bootstrapParams.Image, security, extraSpecs.Mounts); err != nil {
+		return params.ProviderInstance{}, err
+	}
+	image := p.Config.MirrorImage(bootstrapParams.Image)
+	entry.Image = image
+	// Keep image garbage collection passes of other processes from removing
+	// the image until the container is created from it
+	unlockImages, err := lockImages(p.Config.ImageGC.LockPath, filelock.LockShared)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+	unlockImages = sync.OnceFunc(unlockImages)
+	defer unlockImages()
+	pulled, err := p.ensureImage(ctx, image)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+	if p.Config.ImagePolicy.Signature.Enabled() {
+		verified, err := p.verifyImage(ctx, image)
 		if err != nil {
-			return params.ProviderInstance{}, fmt.Errorf("failed to pull image %s: %w", bootstrapParams.Image, err)
+			return params.ProviderInstance{}, err
 		}
-		defer reader.Close()
-		io.Copy(io.Discard, reader)
-	} else {
-		slog.Info("using local image", "image", bootstrapParams.Image)
+		image = verified
+		entry.Image = image
 	}
 
 	// 2. Prepare Config
-	envs, err := spec.GetRunnerEnvs(bootstrapParams)
+	lifecycle, err := spec.GetLifecycleConfig(p.Config, extraSpecs, bootstrapParams)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+
+	envs, err := spec.GetRunnerEnvs(bootstrapParams, lifecycle.IsEphemeral())
 	if err != nil {
 		return params.ProviderInstance{}, fmt.Errorf("failed to generate envs: %w", err)
 	}
 
+	binds, mounts, err := spec.GetMounts(p.Config, extraSpecs.Mounts)
+	if err != nil {
+		return params.ProviderInstance{}, fmt.Errorf("failed to prepare mounts: %w", err)
+	}
+
 	labels := spec.GetContainerLabels(p.ControllerID, bootstrapParams)
 
 	containerConfig := &container.Config{
-		Image: bootstrapParams.Image,
-		Env:   envs,
+		Image:  image,
+		Env:    envs,
 		Labels: labels,
-		// Ensure entrypoint/cmd is correct for the image. 
+		// Ensure entrypoint/cmd is correct for the image.
 		// Garm runner images usually have an entrypoint that handles the bootstrap.
 	}
 
 	hostConfig := &container.HostConfig{
-		Runtime:     spec.GetHostConfigRuntime(),
-		NetworkMode: container.NetworkMode(config.Config.Network),
-		Privileged:  config.Config.Privileged,
-		Binds:       config.Config.Binds,
-	}
-
-	// For privileged containers running Docker-in-Docker:
-	// - Use host cgroup namespace so systemd/KIND can work properly
-	// - Mount /var/lib/docker as a volume so inner Docker can use overlayfs
-	//   (avoids overlay-on-overlay issues when host uses overlayfs)
-	if config.Config.Privileged {
-		hostConfig.CgroupnsMode = container.CgroupnsModeHost
-		hostConfig.Mounts = []mount.Mount{
-			{
-				Type:   mount.TypeVolume,
-				Target: "/var/lib/docker",
-				// Anonymous volume - will be cleaned up with RemoveVolumes: true
-			},
+		Runtime:     spec.GetHostConfigRuntime(p.Config),
+		NetworkMode: container.NetworkMode(p.Config.Network),
+		Binds:       append(append([]string{}, p.Config.Binds...), binds...),
+		Mounts:      mounts,
+	}
+
+	dindStrategy, err := dind.New(p.Config, bootstrapParams.Name)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+	dindStrategy.Apply(containerConfig, hostConfig)
+
+	if err := spec.ApplySecurity(security, containerConfig, hostConfig); err != nil {
+		return params.ProviderInstance{}, err
+	}
+
+	drain, err := spec.GetDrainConfig(p.Config, extraSpecs)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+	if err := spec.ApplyDrain(drain, containerConfig); err != nil {
+		return params.ProviderInstance{}, err
+	}
+
+	spec.ApplyLifecycle(lifecycle, containerConfig, hostConfig)
+
+	healthcheck, err := spec.GetHealthConfig(p.Config, extraSpecs)
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+	containerConfig.Healthcheck = healthcheck
+
+	err = p.runHooks(ctx, config.HookPreCreate, "", params.ProviderInstance{
+		Name:   bootstrapParams.Name,
+		Status: params.InstancePendingCreate,
+		OSType: bootstrapParams.OSType,
+		OSArch: bootstrapParams.OSArch,
+	})
+	if err != nil {
+		return params.ProviderInstance{}, err
+	}
+
+	if p.Config.DinDMode == config.DinDModeSocket && p.Config.SocketProxy.Enabled {
+		if err := p.startSocketProxy(ctx, bootstrapParams); err != nil {
+			p.cleanupFailedCreate(ctx, "", bootstrapParams.Name)
+			return params.ProviderInstance{}, fmt.Errorf("failed to start docker socket proxy: %w", err)
 		}
 	}
 
 	// 3. Create Container
+	entry.HostConfig = audit.SummarizeHostConfig(hostConfig)
+	createStart := time.Now()
 	resp, err := p.DockerClient.ContainerCreate(ctx, containerConfig, hostConfig, nil, nil, bootstrapParams.Name)
+	p.Metrics.ObserveContainerCreate(time.Since(createStart))
+	unlockImages()
 	if err != nil {
+		p.cleanupFailedCreate(ctx, "", bootstrapParams.Name)
 		return params.ProviderInstance{}, fmt.Errorf("failed to create container: %w", err)
 	}
+	entry.ContainerID = resp.ID
+
+	// 4. Warm up the inner Docker daemon before the runner starts
+	if err := p.seedDinDCache(ctx, resp.ID, bootstrapParams.Name, dindStrategy.DataRoot(), labels); err != nil {
+		p.cleanupFailedCreate(ctx, resp.ID, bootstrapParams.Name)
+		return params.ProviderInstance{}, fmt.Errorf("failed to seed docker cache: %w", err)
+	}
 
-	// 4. Start Container
-	if err := p.DockerClient.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+	// 5. Start Container
+	startStart := time.Now()
+	err = p.DockerClient.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{})
+	p.Metrics.ObserveContainerStart(time.Since(startStart))
+	if err != nil {
+		p.cleanupFailedCreate(ctx, resp.ID, bootstrapParams.Name)
 		return params.ProviderInstance{}, fmt.Errorf("failed to start container: %w", err)
 	}
 
-	// 5. Get Container Info (for IP)
+	if p.Config.Readiness.Enabled() {
+		if err := p.waitReady(ctx, resp.ID); err != nil {
+			p.cleanupFailedCreate(ctx, resp.ID, bootstrapParams.Name)
+			return params.ProviderInstance{}, fmt.Errorf("runner %s did not become ready: %w", bootstrapParams.Name, err)
+		}
+	}
+
+	// 6. Get Container Info (for IP)
 	inspect, err := p.DockerClient.ContainerInspect(ctx, resp.ID)
 	if err != nil {
+		p.cleanupFailedCreate(ctx, resp.ID, bootstrapParams.Name)
 		return params.ProviderInstance{}, fmt.Errorf("failed to inspect container after start: %w", err)
 	}
+	entry.ImageID = inspect.Image
 
-	// 6. Return Instance
-	return params.ProviderInstance{
+	// 7. Return Instance
+	instance := params.ProviderInstance{
 		ProviderID: inspect.ID,
 		Name:       bootstrapParams.Name,
 		Status:     params.InstanceRunning,
@@ -148,7 +268,96 @@ func (p *Provider) CreateInstance(ctx context.Context, bootstrapParams params.Bo
 		OSName:     "linux",
 		OSVersion:  "unknown",
 		Addresses:  containerToAddresses(inspect),
-	}, nil
+	}
+	if err := p.runHooks(ctx, config.HookPostStart, resp.ID, instance); err != nil {
+		p.cleanupFailedCreate(ctx, resp.ID, bootstrapParams.Name)
+		return params.ProviderInstance{}, err
+	}
+
+	// Remove old runner images now that the new one is in use
+	if pulled && p.Config.ImageGC.AfterPull {
+		p.collectImagesAfterPull(ctx)
+	}
+	return instance, nil
+}
+
+// ensureImage makes sure the image is available locally, pulling it if it is
+// missing or if always_pull is set. It reports whether the image was pulled.
+func (p *Provider) ensureImage(ctx context.Context, image string) (bool, error) {
+	needsPull := p.Config.AlwaysPull
+	if !needsPull {
+		_, _, err := p.DockerClient.ImageInspectWithRaw(ctx, image)
+		if err != nil {
+			if client.IsErrNotFound(err) {
+				needsPull = true
+			} else {
+				return false, fmt.Errorf("failed to inspect image %s: %w", image, err)
+			}
+		}
+	}
+
+	if !needsPull {
+		slog.Info("using local image", "image", image)
+		return false, nil
+	}
+
+	slog.Info("pulling image", "image", image, "always_pull", p.Config.AlwaysPull)
+	pullOpts := types.ImagePullOptions{}
+	if authStr := p.getRegistryAuth(image); authStr != "" {
+		pullOpts.RegistryAuth = authStr
+	}
+	pullStart := time.Now()
+	reader, err := p.DockerClient.ImagePull(ctx, image, pullOpts)
+	if err != nil {
+		return false, fmt.Errorf("failed to pull image %s: %w", image, err)
+	}
+	defer reader.Close()
+	pulled := pulledBytes(reader)
+	p.Metrics.ObserveImagePull(time.Since(pullStart), pulled)
+	slog.Debug("pulled image", "image", image, "bytes", pulled, "duration", time.Since(pullStart))
+	return true, nil
+}
+
+// pulledBytes reads an image pull progress stream to the end and returns
+// the number of bytes downloaded, as reported for each layer.
+func pulledBytes(r io.Reader) int64 {
+	layers := map[string]int64{}
+	dec := json.NewDecoder(r)
+	for {
+		var msg jsonmessage.JSONMessage
+		if err := dec.Decode(&msg); err != nil {
+			// Drain whatever can't be decoded so the pull still completes
+			io.Copy(io.Discard, io.MultiReader(dec.Buffered(), r))
+			break
+		}
+		if msg.Status == "Downloading" && msg.Progress != nil && msg.Progress.Current > layers[msg.ID] {
+			layers[msg.ID] = msg.Progress.Current
+		}
+	}
+	var total int64
+	for _, n := range layers {
+		total += n
+	}
+	return total
+}
+
+// cleanupFailedCreate force-removes a runner that was only partially set up,
+// along with its sidecars and volumes. containerID may be empty if the runner
+// container wasn't created. Errors are logged, as the caller is already
+// returning the original failure.
+func (p *Provider) cleanupFailedCreate(ctx context.Context, containerID, name string) {
+	if containerID != "" {
+		err := p.DockerClient.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{
+			Force:         true,
+			RemoveVolumes: p.Config.RemoveVolumes,
+		})
+		if err != nil && !client.IsErrNotFound(err) {
+			slog.Error("failed to clean up container", "id", containerID, "error", err)
+		}
+	}
+	if err := p.removeInstanceResources(ctx, p.ControllerID, name); err != nil {
+		slog.Error("failed to clean up instance resources", "name", name, "error", err)
+	}
 }
 
 func containerToAddresses(c types.ContainerJSON) []params.Address {
@@ -176,19 +385,136 @@ func containerToAddresses(c types.ContainerJSON) []params.Address {
 }
 
 func (p *Provider) DeleteInstance(ctx context.Context, instance string) error {
-	// Instance arg here is the ProviderID (Container ID) or Name. 
+	return p.deleteInstance(ctx, audit.ActionDeleteInstance, p.ControllerID, instance)
+}
+
+// deleteInstance drains and removes a runner of the given controller, with
+// its hooks, log archive, audit entry, sidecars and volumes. It is shared by
+// DeleteInstance and the reaper.
+func (p *Provider) deleteInstance(ctx context.Context, action, controllerID, instance string) (err error) {
+	// Instance arg here is the ProviderID (Container ID) or Name.
 	// Garm usually passes the ProviderID if available, or Name if not.
-	// We can try to find by ID first, then name. But ContainerRemove handles both usually.
-	
-	err := p.DockerClient.ContainerRemove(ctx, instance, types.ContainerRemoveOptions{
+	// ContainerRemove handles both, but the sidecars and volumes of the
+	// runner are found by its name label.
+	containerID := instance
+	inspect, err := p.DockerClient.ContainerInspect(ctx, instance)
+	if err != nil {
+		// Exec hooks are skipped for containers that are already gone
+		inspect, containerID = types.ContainerJSON{}, ""
+	}
+	hookInst := hookInstance(inspect, instance)
+	name := hookInst.Name
+	entry := auditEntry(action, name, inspect)
+	defer func() { p.audit(ctx, entry, err) }()
+
+	if err := p.runHooks(ctx, config.HookPreDelete, containerID, hookInst); err != nil {
+		return err
+	}
+	if err := p.drain(ctx, inspect); err != nil {
+		slog.Warn("failed to drain runner, removing it anyway", "instance", instance, "error", err)
+	}
+	if containerID != "" && p.Config.LogArchive.Enabled() {
+		if err := p.archiveLogs(ctx, containerID, inspect, name); err != nil {
+			slog.Warn("failed to archive runner logs", "instance", instance, "error", err)
+		}
+	}
+
+	err = p.DockerClient.ContainerRemove(ctx, instance, types.ContainerRemoveOptions{
 		Force:         true,
-		RemoveVolumes: config.Config.RemoveVolumes,
+		RemoveVolumes: p.Config.RemoveVolumes,
 	})
+	if err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove container %s: %w", instance, err)
+	}
+
+	if err := p.removeInstanceResources(ctx, controllerID, name); err != nil {
+		return fmt.Errorf("failed to remove resources of instance %s: %w", name, err)
+	}
+	return nil
+}
+
+// removeInstanceResources removes the sidecar containers and volumes created
+// for a runner of the given controller, but not the runner container itself.
+// It also removes the containers, networks and volumes the runner's jobs
+// created through its Docker socket proxy, which only carry the proxy's
+// owner label.
+func (p *Provider) removeInstanceResources(ctx context.Context, controllerID, name string) error {
+	if name == "" {
+		return nil
+	}
+	filtersArgs := filters.NewArgs()
+	filtersArgs.Add("label", fmt.Sprintf("%s=%s", spec.GarmControllerIDLabel, controllerID))
+	filtersArgs.Add("label", fmt.Sprintf("%s=%s", spec.GarmInstanceNameLabel, name))
+	ownedArgs := filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", sockproxy.OwnerLabel, name)))
+
+	for _, args := range []filters.Args{filtersArgs, ownedArgs} {
+		containers, err := p.DockerClient.ContainerList(ctx, types.ContainerListOptions{
+			Filters: args,
+			All:     true,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to list containers: %w", err)
+		}
+		for _, c := range containers {
+			if c.Labels[sockproxy.OwnerLabel] == "" && isRunner(c.Labels) {
+				continue
+			}
+			err := p.DockerClient.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true})
+			if err != nil && !client.IsErrNotFound(err) {
+				return fmt.Errorf("failed to remove container %s: %w", c.ID, err)
+			}
+		}
+	}
+
+	networks, err := p.DockerClient.NetworkList(ctx, types.NetworkListOptions{Filters: ownedArgs})
 	if err != nil {
-		if client.IsErrNotFound(err) {
-			return nil
+		return fmt.Errorf("failed to list networks: %w", err)
+	}
+	for _, n := range networks {
+		if err := p.DockerClient.NetworkRemove(ctx, n.ID); err != nil && !client.IsErrNotFound(err) {
+			return fmt.Errorf("failed to remove network %s: %w", n.Name, err)
 		}
-		return fmt.Errorf("failed to remove container %s: %w", instance, err)
+	}
+
+	for _, args := range []filters.Args{filtersArgs, ownedArgs} {
+		volumes, err := p.DockerClient.VolumeList(ctx, volume.ListOptions{Filters: args})
+		if err != nil {
+			return fmt.Errorf("failed to list volumes: %w", err)
+		}
+		for _, v := range volumes.Volumes {
+			if err := p.DockerClient.VolumeRemove(ctx, v.Name, true); err != nil && !client.IsErrNotFound(err) {
+				return fmt.Errorf("failed to remove volume %s: %w", v.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// isRunner reports whether a container with the given labels is a runner,
+// as opposed to a sidecar.
+func isRunner(labels map[string]string) bool {
+	role := labels[spec.GarmRoleLabel]
+	return role == "" || role == spec.RoleRunner
+}
+
+// CheckController returns an error unless the instance is a runner of the
+// provider's controller. The operator commands use it, so that a name or ID
+// can't reach the runners of another controller or unrelated containers.
+func (p *Provider) CheckController(ctx context.Context, instance string) error {
+	inspect, err := p.DockerClient.ContainerInspect(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %w", instance, err)
+	}
+	var labels map[string]string
+	if inspect.Config != nil {
+		labels = inspect.Config.Labels
+	}
+	controllerID, ok := labels[spec.GarmControllerIDLabel]
+	if !ok || !isRunner(labels) {
+		return fmt.Errorf("container %s is not a garm runner", instance)
+	}
+	if controllerID != p.ControllerID {
+		return fmt.Errorf("container %s belongs to controller %q, not %q", instance, controllerID, p.ControllerID)
 	}
 	return nil
 }
@@ -217,11 +543,22 @@ func (p *Provider) ListInstances(ctx context.Context, poolID string) ([]params.P
 		return nil, fmt.Errorf("failed to list containers: %w", err)
 	}
 
-	instances := make([]params.ProviderInstance, len(containers))
-	for i, c := range containers {
+	instances := make([]params.ProviderInstance, 0, len(containers))
+	for _, c := range containers {
+		if !isRunner(c.Labels) {
+			continue
+		}
 		// List returns a summary, not full inspect. We need to map what we have.
 		// Or we can inspect each one if needed, but summary usually has labels and status.
-		instances[i] = containerSummaryToInstance(c)
+		instance := containerSummaryToInstance(c)
+		if instance.Status == params.InstanceError && instance.ProviderFault == nil {
+			// Only inspect shows why a container is unhealthy
+			if inspect, err := p.DockerClient.ContainerInspect(ctx, c.ID); err == nil && inspect.ContainerJSONBase != nil &&
+				inspect.State != nil && inspect.State.Health != nil {
+				instance.ProviderFault = healthFault(inspect.State.Health)
+			}
+		}
+		instances = append(instances, instance)
 	}
 
 	return instances, nil
@@ -238,51 +575,92 @@ func (p *Provider) RemoveAllInstances(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to list containers for removal: %w", err)
 	}
+	volumes, err := p.DockerClient.VolumeList(ctx, volume.ListOptions{Filters: filtersArgs})
+	if err != nil {
+		return fmt.Errorf("failed to list volumes for removal: %w", err)
+	}
 
+	// Objects a job created through the socket proxy only carry the owner
+	// label of its runner, so they are found by the runners' names
+	names := map[string]bool{}
 	for _, c := range containers {
 		err := p.DockerClient.ContainerRemove(ctx, c.ID, types.ContainerRemoveOptions{
 			Force:         true,
-			RemoveVolumes: config.Config.RemoveVolumes,
+			RemoveVolumes: p.Config.RemoveVolumes,
 		})
 		if err != nil {
 			slog.Error("failed to remove container", "id", c.ID, "error", err)
 		}
+		entry := audit.NewEntry(audit.ActionRemoveAllInstances, containerSummaryToInstance(c).Name)
+		entry.ContainerID = c.ID
+		entry.Image = c.Image
+		entry.ImageID = c.ImageID
+		p.audit(ctx, entry, err)
+		if name := c.Labels[spec.GarmInstanceNameLabel]; name != "" {
+			names[name] = true
+		}
+	}
+	for _, v := range volumes.Volumes {
+		if name := v.Labels[spec.GarmInstanceNameLabel]; name != "" {
+			names[name] = true
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(names)) {
+		if err := p.removeInstanceResources(ctx, p.ControllerID, name); err != nil {
+			slog.Error("failed to remove instance resources", "name", name, "error", err)
+		}
+	}
+
+	for _, v := range volumes.Volumes {
+		if err := p.DockerClient.VolumeRemove(ctx, v.Name, true); err != nil && !client.IsErrNotFound(err) {
+			slog.Error("failed to remove volume", "name", v.Name, "error", err)
+		}
 	}
 	return nil
 }
 
-func (p *Provider) Stop(ctx context.Context, instance string, force bool) error {
-	// Garm calls this.
-	timeout := 10 // seconds
+func (p *Provider) Stop(ctx context.Context, instance string, force bool) (err error) {
+	entry := audit.NewEntry(audit.ActionStop, instance)
+	defer func() { p.audit(ctx, entry, err) }()
+
+	inspect, err := p.DockerClient.ContainerInspect(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %w", instance, err)
+	}
+	entry = auditEntry(audit.ActionStop, hookInstance(inspect, instance).Name, inspect)
+	if err := p.runHooks(ctx, config.HookPreStop, instance, hookInstance(inspect, instance)); err != nil {
+		return err
+	}
+
+	// Without a timeout, Docker uses the stop signal and timeout of the
+	// container, which are set from the drain settings on create.
+	stopOptions := container.StopOptions{}
 	if force {
-		timeout = 0
-	}
-	
-	// ContainerStop expects *int for timeout in newer SDKs, or just int in older.
-	// In v24 it's ContainerStop(ctx, containerID, ContainerStopOptions)
-	// But let's check the signature for the version we imported.
-	// Since we are using `github.com/docker/docker/client` v24.0.7:
-	// interface: ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error
-	
-	// Wait, checking the exact signature for v24.0.7...
-	// It seems to be `ContainerStop(ctx context.Context, containerID string, timeout container.StopOptions) error`
-	
-	stopOptions := container.StopOptions{
-		Timeout: &timeout,
-	}
-
-	err := p.DockerClient.ContainerStop(ctx, instance, stopOptions)
+		timeout := 0
+		stopOptions.Timeout = &timeout
+	} else if err := p.drain(ctx, inspect); err != nil {
+		slog.Warn("failed to drain runner, stopping it anyway", "instance", instance, "error", err)
+	}
+
+	err = p.DockerClient.ContainerStop(ctx, instance, stopOptions)
 	if err != nil {
 		return fmt.Errorf("failed to stop container: %w", err)
 	}
+	if err := p.markStopped(ctx, inspect); err != nil {
+		slog.Warn("failed to mark runner as stopped, the reaper may remove it", "instance", instance, "error", err)
+	}
 	return nil
 }
 
 func (p *Provider) Start(ctx context.Context, instance string) error {
 	err := p.DockerClient.ContainerStart(ctx, instance, types.ContainerStartOptions{})
+	p.audit(ctx, audit.NewEntry(audit.ActionStart, instance), err)
 	if err != nil {
 		return fmt.Errorf("failed to start container: %w", err)
 	}
+	if err := p.clearStopped(ctx, instance); err != nil {
+		slog.Warn("failed to clear stop marker of runner", "instance", instance, "error", err)
+	}
 	return nil
 }
 
@@ -290,8 +668,16 @@ func (p *Provider) Start(ctx context.Context, instance string) error {
 
 func containerToInstance(c types.ContainerJSON) params.ProviderInstance {
 	status := params.InstanceStatusUnknown
+	var fault []byte
 	if c.State != nil {
-		if c.State.Running {
+		if c.State.Health != nil && c.State.Health.Status == types.Unhealthy {
+			// Lets Garm replace runners that hang
+			status = params.InstanceError
+			fault = healthFault(c.State.Health)
+		} else if maxLifetime, exceeded := inspectLifetimeExceeded(c); c.State.Running && exceeded {
+			status = params.InstanceError
+			fault = []byte(fmt.Sprintf("runner exceeded its max lifetime of %s", maxLifetime))
+		} else if c.State.Running {
 			status = params.InstanceRunning
 		} else if c.State.Paused {
 			status = params.InstanceStopped // or paused? Garm doesn't have paused.
@@ -303,17 +689,34 @@ func containerToInstance(c types.ContainerJSON) params.ProviderInstance {
 	}
 
 	return params.ProviderInstance{
-		ProviderID: c.ID,
-		Name:       c.Name, // This usually has a slash /name
-		Status:     status,
-		OSType:     params.OSType(c.Config.Labels[spec.GarmOSTypeLabel]),
-		OSArch:     params.OSArch(c.Config.Labels[spec.GarmOSArchLabel]),
+		ProviderID:    c.ID,
+		Name:          c.Name, // This usually has a slash /name
+		Status:        status,
+		OSType:        params.OSType(c.Config.Labels[spec.GarmOSTypeLabel]),
+		OSArch:        params.OSArch(c.Config.Labels[spec.GarmOSArchLabel]),
+		ProviderFault: fault,
+	}
+}
+
+// healthFault describes the last failed healthcheck of a container.
+func healthFault(health *types.Health) []byte {
+	if len(health.Log) == 0 {
+		return []byte("container is unhealthy")
 	}
+	last := health.Log[len(health.Log)-1]
+	return []byte(fmt.Sprintf("healthcheck failed %d times, last exit code %d: %s",
+		health.FailingStreak, last.ExitCode, strings.TrimSpace(last.Output)))
 }
 
 func containerSummaryToInstance(c types.Container) params.ProviderInstance {
 	status := params.InstanceStatusUnknown
-	if c.State == "running" {
+	var fault []byte
+	if strings.Contains(c.Status, "(unhealthy)") {
+		status = params.InstanceError
+	} else if maxLifetime, exceeded := spec.LifetimeExceeded(c.Labels, time.Unix(c.Created, 0)); c.State == "running" && exceeded {
+		status = params.InstanceError
+		fault = []byte(fmt.Sprintf("runner exceeded its max lifetime of %s", maxLifetime))
+	} else if c.State == "running" {
 		status = params.InstanceRunning
 	} else if c.State == "exited" {
 		status = params.InstanceStopped
@@ -330,14 +733,25 @@ func containerSummaryToInstance(c types.Container) params.ProviderInstance {
 	}
 
 	return params.ProviderInstance{
-		ProviderID: c.ID,
-		Name:       name,
-		Status:     status,
-		OSType:     params.OSType(c.Labels[spec.GarmOSTypeLabel]),
-		OSArch:     params.OSArch(c.Labels[spec.GarmOSArchLabel]),
+		ProviderID:    c.ID,
+		Name:          name,
+		Status:        status,
+		OSType:        params.OSType(c.Labels[spec.GarmOSTypeLabel]),
+		OSArch:        params.OSArch(c.Labels[spec.GarmOSArchLabel]),
+		ProviderFault: fault,
 	}
 }
 
+// inspectLifetimeExceeded reports whether an inspected runner has outlived
+// its max lifetime.
+func inspectLifetimeExceeded(c types.ContainerJSON) (time.Duration, bool) {
+	created, err := time.Parse(time.RFC3339Nano, c.Created)
+	if err != nil || c.Config == nil {
+		return 0, false
+	}
+	return spec.LifetimeExceeded(c.Config.Labels, created)
+}
+
 // dockerConfig represents the structure of ~/.docker/config.json
 type dockerConfig struct {
 	Auths map[string]dockerAuthEntry `json:"auths"`
@@ -348,52 +762,67 @@ type dockerAuthEntry struct {
 }
 
 // getRegistryAuth returns the base64-encoded auth string for the registry of the given image.
-// It reads from the Docker config file specified in config.Config.DockerConfigPath,
+// It uses the registries config, then the Docker config file specified in DockerConfigPath,
 // or ~/.docker/config.json if not specified.
-func getRegistryAuth(image string) string {
-	configPath := config.Config.DockerConfigPath
+func (p *Provider) getRegistryAuth(image string) string {
+	auth, err := p.registryAuth(image)
+	if err != nil {
+		slog.Debug("failed to get registry auth", "image", image, "error", err)
+		return ""
+	}
+	return auth
+}
+
+// registryAuth returns the auth string for the registry of image, or "" if
+// neither the registries config nor the Docker config has credentials for
+// it. A missing default config file is not an error.
+func (p *Provider) registryAuth(image string) (string, error) {
+	if reg, ok := p.Config.RegistryCredentials(image); ok {
+		slog.Debug("using registry credentials from config", "image", image, "match", reg.Match)
+		auth, err := registry.EncodeAuthConfig(registry.AuthConfig{
+			Username:      reg.Username,
+			Password:      reg.Password.Value(),
+			RegistryToken: reg.Token.Value(),
+			ServerAddress: registryHost(image),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to encode auth config: %w", err)
+		}
+		return auth, nil
+	}
+
+	configPath := p.Config.DockerConfigPath
 	if configPath == "" {
 		home, err := os.UserHomeDir()
 		if err != nil {
-			slog.Debug("failed to get home dir for docker config", "error", err)
-			return ""
+			return "", fmt.Errorf("failed to get home dir for docker config: %w", err)
 		}
 		configPath = home + "/.docker/config.json"
 	}
 
 	data, err := os.ReadFile(configPath)
+	if os.IsNotExist(err) && p.Config.DockerConfigPath == "" {
+		return "", nil
+	}
 	if err != nil {
-		slog.Debug("failed to read docker config", "path", configPath, "error", err)
-		return ""
+		return "", fmt.Errorf("failed to read docker config: %w", err)
 	}
 
 	var cfg dockerConfig
 	if err := json.Unmarshal(data, &cfg); err != nil {
-		slog.Debug("failed to parse docker config", "error", err)
-		return ""
+		return "", fmt.Errorf("failed to parse docker config %s: %w", configPath, err)
 	}
 
-	// Extract registry from image (e.g., "ghcr.io/user/image:tag" -> "ghcr.io")
-	registryHost := "docker.io" // default
-	if strings.Contains(image, "/") {
-		parts := strings.SplitN(image, "/", 2)
-		if strings.Contains(parts[0], ".") || strings.Contains(parts[0], ":") {
-			registryHost = parts[0]
-		}
-	}
-
-	if entry, ok := cfg.Auths[registryHost]; ok {
+	if entry, ok := cfg.Auths[registryHost(image)]; ok {
 		// The auth in config.json is already base64(username:password)
 		// Docker API expects base64(json(AuthConfig)), so we need to re-encode
 		decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
 		if err != nil {
-			slog.Debug("failed to decode auth from docker config", "error", err)
-			return ""
+			return "", fmt.Errorf("failed to decode auth of %s: %w", registryHost(image), err)
 		}
 		parts := strings.SplitN(string(decoded), ":", 2)
 		if len(parts) != 2 {
-			slog.Debug("invalid auth format in docker config")
-			return ""
+			return "", fmt.Errorf("invalid auth format for %s", registryHost(image))
 		}
 		authConfig := registry.AuthConfig{
 			Username: parts[0],
@@ -401,11 +830,22 @@ func getRegistryAuth(image string) string {
 		}
 		authJSON, err := json.Marshal(authConfig)
 		if err != nil {
-			slog.Debug("failed to encode auth config", "error", err)
-			return ""
+			return "", fmt.Errorf("failed to encode auth config: %w", err)
 		}
-		return base64.URLEncoding.EncodeToString(authJSON)
+		return base64.URLEncoding.EncodeToString(authJSON), nil
 	}
 
-	return ""
+	return "", nil
+}
+
+// registryHost returns the registry of an image reference
+// (e.g., "ghcr.io/user/image:tag" -> "ghcr.io").
+func registryHost(image string) string {
+	if strings.Contains(image, "/") {
+		parts := strings.SplitN(image, "/", 2)
+		if strings.Contains(parts[0], ".") || strings.Contains(parts[0], ":") {
+			return parts[0]
+		}
+	}
+	return "docker.io"
 }
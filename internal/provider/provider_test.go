@@ -1,22 +1,54 @@
 package provider
 
 import (
+	"archive/tar"
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/cloudbase/garm-provider-common/params"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/registry"
+	"github.com/docker/docker/api/types/volume"
 	"github.com/docker/docker/errdefs"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/mercedes-benz/garm-provider-docker/internal/audit"
+	"github.com/mercedes-benz/garm-provider-docker/internal/filelock"
+	"github.com/mercedes-benz/garm-provider-docker/internal/imagesig"
+	"github.com/mercedes-benz/garm-provider-docker/internal/sockproxy"
 	"github.com/mercedes-benz/garm-provider-docker/internal/spec"
 	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
 	v1 "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 // MockDockerClient is a mock of the DockerClient interface
@@ -34,6 +66,16 @@ func (m *MockDockerClient) ImageInspectWithRaw(ctx context.Context, imageID stri
 	return args.Get(0).(types.ImageInspect), args.Get(1).([]byte), args.Error(2)
 }
 
+func (m *MockDockerClient) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	args := m.Called(ctx, options)
+	return args.Get(0).([]types.ImageSummary), args.Error(1)
+}
+
+func (m *MockDockerClient) ImageRemove(ctx context.Context, imageID string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	args := m.Called(ctx, imageID, options)
+	return args.Get(0).([]types.ImageDeleteResponseItem), args.Error(1)
+}
+
 func (m *MockDockerClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
 	args := m.Called(ctx, config, hostConfig, networkingConfig, platform, containerName)
 	return args.Get(0).(container.CreateResponse), args.Error(1)
@@ -64,25 +106,104 @@ func (m *MockDockerClient) ContainerStop(ctx context.Context, containerID string
 	return args.Error(0)
 }
 
+func (m *MockDockerClient) ContainerKill(ctx context.Context, containerID, signal string) error {
+	args := m.Called(ctx, containerID, signal)
+	return args.Error(0)
+}
+
+func (m *MockDockerClient) ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error) {
+	args := m.Called(ctx, container, config)
+	return args.Get(0).(types.IDResponse), args.Error(1)
+}
+
+func (m *MockDockerClient) ContainerExecStart(ctx context.Context, execID string, config types.ExecStartCheck) error {
+	args := m.Called(ctx, execID, config)
+	return args.Error(0)
+}
+
+func (m *MockDockerClient) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	args := m.Called(ctx, execID)
+	return args.Get(0).(types.ContainerExecInspect), args.Error(1)
+}
+
+func (m *MockDockerClient) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	args := m.Called(ctx, containerID, options)
+	return args.Get(0).(io.ReadCloser), args.Error(1)
+}
+
+func (m *MockDockerClient) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	args := m.Called(ctx, containerID, condition)
+	return args.Get(0).(<-chan container.WaitResponse), args.Get(1).(<-chan error)
+}
+
+func (m *MockDockerClient) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options types.CopyToContainerOptions) error {
+	args := m.Called(ctx, containerID, dstPath, content, options)
+	return args.Error(0)
+}
+
+func (m *MockDockerClient) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+	args := m.Called(ctx, containerID, srcPath)
+	content, _ := args.Get(0).(io.ReadCloser)
+	return content, args.Get(1).(types.ContainerPathStat), args.Error(2)
+}
+
+func (m *MockDockerClient) NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error) {
+	args := m.Called(ctx, options)
+	return args.Get(0).([]types.NetworkResource), args.Error(1)
+}
+
+func (m *MockDockerClient) Info(ctx context.Context) (types.Info, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(types.Info), args.Error(1)
+}
+
+func (m *MockDockerClient) ServerVersion(ctx context.Context) (types.Version, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(types.Version), args.Error(1)
+}
+
+func (m *MockDockerClient) DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error) {
+	args := m.Called(ctx, options)
+	return args.Get(0).(types.DiskUsage), args.Error(1)
+}
+
+func (m *MockDockerClient) NetworkRemove(ctx context.Context, networkID string) error {
+	args := m.Called(ctx, networkID)
+	return args.Error(0)
+}
+
+func (m *MockDockerClient) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	args := m.Called(ctx, options)
+	return args.Get(0).(volume.Volume), args.Error(1)
+}
+
+func (m *MockDockerClient) VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error) {
+	args := m.Called(ctx, options)
+	return args.Get(0).(volume.ListResponse), args.Error(1)
+}
+
+func (m *MockDockerClient) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	args := m.Called(ctx, volumeID, force)
+	return args.Error(0)
+}
+
 func TestCreateInstance(t *testing.T) {
+	t.Parallel()
 	mockClient := new(MockDockerClient)
 	p := &Provider{
 		ControllerID: "test-controller",
 		PoolID:       "test-pool",
+		Config:       &config.ProviderConfig{Runtime: "sysbox-runc", Network: "bridge", DinDMode: config.DinDModeSysbox},
 		DockerClient: mockClient,
 	}
 
 	bootstrapParams := params.BootstrapInstance{
-		Name:  "test-runner",
-		Image: "ubuntu:latest",
+		Name:    "test-runner",
+		Image:   "ubuntu:latest",
 		RepoURL: "https://github.com/org/repo",
-		PoolID: "test-pool",
-		Labels: []string{"label1"},
+		PoolID:  "test-pool",
+		Labels:  []string{"label1"},
 	}
-	
-	// Set up config defaults
-	config.Config.Runtime = "sysbox-runc"
-	config.Config.Network = "bridge"
 
 	// Mock ImageInspect (simulate not found)
 	mockClient.On("ImageInspectWithRaw", mock.Anything, "ubuntu:latest").Return(types.ImageInspect{}, []byte{}, errdefs.NotFound(errors.New("image not found")))
@@ -124,19 +245,25 @@ func TestCreateInstance(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "container-id", instance.ProviderID)
 	assert.Equal(t, params.InstanceRunning, instance.Status)
-	
+
 	mockClient.AssertExpectations(t)
 }
 
 func TestDeleteInstance(t *testing.T) {
+	t.Parallel()
 	mockClient := new(MockDockerClient)
 	p := &Provider{
+		Config:       &config.ProviderConfig{RemoveVolumes: true},
 		DockerClient: mockClient,
 	}
-	
-	config.Config.RemoveVolumes = true
 
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+		Config: &container.Config{Labels: map[string]string{spec.GarmInstanceNameLabel: "test-runner"}},
+	}, nil)
 	mockClient.On("ContainerRemove", mock.Anything, "container-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+	mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+	mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{}, nil)
 
 	err := p.DeleteInstance(context.Background(), "container-id")
 	assert.NoError(t, err)
@@ -144,9 +271,11 @@ func TestDeleteInstance(t *testing.T) {
 }
 
 func TestListInstances(t *testing.T) {
+	t.Parallel()
 	mockClient := new(MockDockerClient)
 	p := &Provider{
 		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{},
 		DockerClient: mockClient,
 	}
 
@@ -154,7 +283,7 @@ func TestListInstances(t *testing.T) {
 		return opts.All == true // We ask for all
 	})).Return([]types.Container{
 		{
-			ID: "container-1",
+			ID:    "container-1",
 			Names: []string{"/test-runner"},
 			State: "running",
 			Labels: map[string]string{
@@ -169,6 +298,1557 @@ func TestListInstances(t *testing.T) {
 	assert.Len(t, instances, 1)
 	assert.Equal(t, "container-1", instances[0].ProviderID)
 	assert.Equal(t, params.InstanceRunning, instances[0].Status)
-	
+
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceSeedsDinDCache(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		PoolID:       "test-pool",
+		Config: &config.ProviderConfig{
+			Runtime:  "runc",
+			Network:  "bridge",
+			DinDMode: config.DinDModePrivileged,
+			DinDCache: config.DinDCacheConfig{
+				SeedVolume:      "dind-template",
+				SeederImage:     "busybox:latest",
+				SeedTimeout:     time.Minute,
+				RegistryMirrors: []string{"https://mirror.internal"},
+			},
+		},
+		DockerClient: mockClient,
+	}
+
+	bootstrapParams := params.BootstrapInstance{
+		Name:    "test-runner",
+		Image:   "ubuntu:latest",
+		RepoURL: "https://github.com/org/repo",
+		PoolID:  "test-pool",
+	}
+
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "ubuntu:latest").Return(types.ImageInspect{}, []byte{}, nil)
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "busybox:latest").Return(types.ImageInspect{}, []byte{}, nil)
+
+	mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, (*network.NetworkingConfig)(nil), (*v1.Platform)(nil), "test-runner").Return(container.CreateResponse{ID: "container-id"}, nil)
+	mockClient.On("CopyFromContainer", mock.Anything, "container-id", "/etc/docker/daemon.json").Return(nil, types.ContainerPathStat{}, errdefs.NotFound(errors.New("not found")))
+	mockClient.On("CopyToContainer", mock.Anything, "container-id", "/", mock.Anything, mock.Anything).Return(nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "container-id"},
+		Mounts: []types.MountPoint{
+			{Type: mount.TypeVolume, Name: "anon-volume", Destination: "/var/lib/docker"},
+		},
+	}, nil)
+
+	mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+		return c.Image == "busybox:latest" && c.Cmd[0] == "cp" &&
+			c.Labels[spec.GarmRoleLabel] == spec.RoleSeeder && c.Labels[spec.GarmInstanceNameLabel] == "test-runner"
+	}), mock.MatchedBy(func(h *container.HostConfig) bool {
+		return len(h.Mounts) == 2 &&
+			h.Mounts[0].Source == "anon-volume" && h.Mounts[0].Target == "/var/lib/docker" &&
+			h.Mounts[1].Source == "dind-template" && h.Mounts[1].ReadOnly
+	}), (*network.NetworkingConfig)(nil), (*v1.Platform)(nil), "test-runner-seed").Return(container.CreateResponse{ID: "seed-id"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "seed-id", mock.Anything).Return(nil)
+	waitCh := make(chan container.WaitResponse, 1)
+	waitCh <- container.WaitResponse{StatusCode: 0}
+	mockClient.On("ContainerWait", mock.Anything, "seed-id", container.WaitConditionNotRunning).Return((<-chan container.WaitResponse)(waitCh), (<-chan error)(make(chan error)))
+	mockClient.On("ContainerRemove", mock.Anything, "seed-id", types.ContainerRemoveOptions{Force: true}).Return(nil)
+
+	mockClient.On("ContainerStart", mock.Anything, "container-id", mock.Anything).Return(nil)
+
+	instance, err := p.CreateInstance(context.Background(), bootstrapParams)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "container-id", instance.ProviderID)
+	mockClient.AssertExpectations(t)
+}
+
+func TestWriteDaemonConfigMergesRootlessConfig(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		Config: &config.ProviderConfig{
+			DinDMode:         config.DinDModeRootless,
+			RootlessDataRoot: "/home/rootless/.local/share/docker",
+		},
+		DockerClient: mockClient,
+	}
+
+	var shipped bytes.Buffer
+	tw := tar.NewWriter(&shipped)
+	data := []byte(`{"registry-mirrors": ["https://image.mirror", "https://mirror.internal"], "features": {"buildkit": true}}`)
+	require.NoError(t, tw.WriteHeader(&tar.Header{Name: "daemon.json", Mode: 0o600, Size: int64(len(data))}))
+	_, err := tw.Write(data)
+	require.NoError(t, err)
+	require.NoError(t, tw.Close())
+
+	mockClient.On("CopyFromContainer", mock.Anything, "container-id", "/home/rootless/.config/docker/daemon.json").
+		Return(io.NopCloser(&shipped), types.ContainerPathStat{}, nil)
+	var written bytes.Buffer
+	mockClient.On("CopyToContainer", mock.Anything, "container-id", "/home/rootless", mock.Anything, types.CopyToContainerOptions{CopyUIDGID: true}).
+		Run(func(args mock.Arguments) {
+			_, _ = io.Copy(&written, args.Get(3).(io.Reader))
+		}).Return(nil)
+
+	require.NoError(t, p.writeDaemonConfig(context.Background(), "container-id", []string{"https://mirror.internal"}))
+
+	tr := tar.NewReader(&written)
+	var names []string
+	var daemonCfg map[string]any
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		names = append(names, hdr.Name)
+		if hdr.Typeflag == tar.TypeReg {
+			assert.Equal(t, int64(0o600), hdr.Mode)
+			require.NoError(t, json.NewDecoder(tr).Decode(&daemonCfg))
+		}
+	}
+	assert.Equal(t, []string{".config/", ".config/docker/", ".config/docker/daemon.json"}, names)
+	assert.Equal(t, map[string]any{
+		"registry-mirrors": []any{"https://mirror.internal", "https://image.mirror"},
+		"features":         map[string]any{"buildkit": true},
+	}, daemonCfg)
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceSeedFailureRemovesContainer(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config: &config.ProviderConfig{
+			DinDMode:      config.DinDModePrivileged,
+			RemoveVolumes: true,
+			DinDCache: config.DinDCacheConfig{
+				SeedTarball: "/srv/cache.tar",
+				SeederImage: "busybox:latest",
+				SeedTimeout: time.Minute,
+			},
+		},
+		DockerClient: mockClient,
+	}
+
+	bootstrapParams := params.BootstrapInstance{
+		Name:    "test-runner",
+		Image:   "ubuntu:latest",
+		RepoURL: "https://github.com/org/repo",
+	}
+
+	mockClient.On("ImageInspectWithRaw", mock.Anything, mock.Anything).Return(types.ImageInspect{}, []byte{}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "test-runner").Return(container.CreateResponse{ID: "container-id"}, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+		Mounts: []types.MountPoint{
+			{Type: mount.TypeVolume, Name: "anon-volume", Destination: "/var/lib/docker"},
+		},
+	}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+		return c.Cmd[0] == "tar"
+	}), mock.Anything, mock.Anything, mock.Anything, "test-runner-seed").Return(container.CreateResponse{ID: "seed-id"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "seed-id", mock.Anything).Return(nil)
+	waitCh := make(chan container.WaitResponse, 1)
+	waitCh <- container.WaitResponse{StatusCode: 2}
+	mockClient.On("ContainerWait", mock.Anything, "seed-id", mock.Anything).Return((<-chan container.WaitResponse)(waitCh), (<-chan error)(make(chan error)))
+	mockClient.On("ContainerRemove", mock.Anything, "seed-id", mock.Anything).Return(nil)
+	mockClient.On("ContainerRemove", mock.Anything, "container-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+	mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+	mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{}, nil)
+
+	_, err := p.CreateInstance(context.Background(), bootstrapParams)
+
+	assert.ErrorContains(t, err, "exited with status 2")
+	mockClient.AssertNotCalled(t, "ContainerStart", mock.Anything, "container-id", mock.Anything)
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceSeedTimeoutRemovesContainer(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config: &config.ProviderConfig{
+			DinDMode:      config.DinDModePrivileged,
+			RemoveVolumes: true,
+			DinDCache: config.DinDCacheConfig{
+				SeedTarball: "/srv/cache.tar",
+				SeederImage: "busybox:latest",
+				SeedTimeout: 10 * time.Millisecond,
+			},
+		},
+		DockerClient: mockClient,
+	}
+
+	bootstrapParams := params.BootstrapInstance{
+		Name:    "test-runner",
+		Image:   "ubuntu:latest",
+		RepoURL: "https://github.com/org/repo",
+	}
+
+	mockClient.On("ImageInspectWithRaw", mock.Anything, mock.Anything).Return(types.ImageInspect{}, []byte{}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "test-runner").Return(container.CreateResponse{ID: "container-id"}, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+		Mounts: []types.MountPoint{
+			{Type: mount.TypeVolume, Name: "anon-volume", Destination: "/var/lib/docker"},
+		},
+	}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "test-runner-seed").Return(container.CreateResponse{ID: "seed-id"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "seed-id", mock.Anything).Return(nil)
+	// The seeder never exits
+	mockClient.On("ContainerWait", mock.Anything, "seed-id", mock.Anything).Return((<-chan container.WaitResponse)(make(chan container.WaitResponse)), (<-chan error)(make(chan error)))
+	mockClient.On("ContainerRemove", mock.Anything, "seed-id", mock.Anything).Return(nil)
+	mockClient.On("ContainerRemove", mock.Anything, "container-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+	mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+	mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{}, nil)
+
+	_, err := p.CreateInstance(context.Background(), bootstrapParams)
+
+	assert.ErrorContains(t, err, "did not finish within 10ms")
+	mockClient.AssertNotCalled(t, "ContainerStart", mock.Anything, "container-id", mock.Anything)
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceStartFailureRemovesContainer(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{DinDMode: config.DinDModeNone, RemoveVolumes: true},
+		DockerClient: mockClient,
+	}
+
+	bootstrapParams := params.BootstrapInstance{
+		Name:    "test-runner",
+		Image:   "ubuntu:latest",
+		RepoURL: "https://github.com/org/repo",
+	}
+
+	mockClient.On("ImageInspectWithRaw", mock.Anything, mock.Anything).Return(types.ImageInspect{}, []byte{}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "test-runner").Return(container.CreateResponse{ID: "container-id"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "container-id", mock.Anything).Return(errors.New("runtime failed"))
+	mockClient.On("ContainerRemove", mock.Anything, "container-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+	mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+	mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{}, nil)
+
+	_, err := p.CreateInstance(context.Background(), bootstrapParams)
+
+	assert.ErrorContains(t, err, "runtime failed")
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceStartsSocketProxy(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config: &config.ProviderConfig{
+			Runtime:          "runc",
+			DinDMode:         config.DinDModeSocket,
+			DockerSocketPath: "/var/run/docker.sock",
+			SocketProxy:      config.SocketProxyConfig{Enabled: true, Image: "garm-provider-docker:latest"},
+		},
+		DockerClient: mockClient,
+	}
+
+	bootstrapParams := params.BootstrapInstance{
+		Name:    "test-runner",
+		Image:   "ubuntu:latest",
+		RepoURL: "https://github.com/org/repo",
+		PoolID:  "test-pool",
+	}
+
+	mockClient.On("ImageInspectWithRaw", mock.Anything, mock.Anything).Return(types.ImageInspect{}, []byte{}, nil)
+	mockClient.On("VolumeCreate", mock.Anything, mock.MatchedBy(func(opts volume.CreateOptions) bool {
+		return opts.Name == "test-runner-docker-proxy" &&
+			opts.Labels[spec.GarmInstanceNameLabel] == "test-runner" &&
+			opts.Labels[spec.GarmRoleLabel] == spec.RoleSocketProxy
+	})).Return(volume.Volume{Name: "test-runner-docker-proxy"}, nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+		return c.Image == "garm-provider-docker:latest" && c.Cmd[0] == "socket-proxy" && c.Labels[spec.GarmRoleLabel] == spec.RoleSocketProxy
+	}), mock.MatchedBy(func(h *container.HostConfig) bool {
+		return h.Binds[0] == "/var/run/docker.sock:/var/run/docker.sock" && h.Mounts[0].Source == "test-runner-docker-proxy"
+	}), mock.Anything, mock.Anything, "test-runner-docker-proxy").Return(container.CreateResponse{ID: "proxy-id"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "proxy-id", mock.Anything).Return(nil)
+
+	mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+		return c.Image == "ubuntu:latest"
+	}), mock.MatchedBy(func(h *container.HostConfig) bool {
+		// The runner must never see the host socket itself
+		return len(h.Binds) == 0 && len(h.Mounts) == 1 && h.Mounts[0].Source == "test-runner-docker-proxy"
+	}), mock.Anything, mock.Anything, "test-runner").Return(container.CreateResponse{ID: "container-id"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "container-id", mock.Anything).Return(nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "container-id"},
+	}, nil)
+
+	_, err := p.CreateInstance(context.Background(), bootstrapParams)
+	assert.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestDeleteInstanceRemovesSidecarsAndVolumes(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{RemoveVolumes: true},
+		DockerClient: mockClient,
+	}
+
+	instanceArgs := mock.MatchedBy(func(opts any) bool {
+		return listFilters(opts).ExactMatch("label", spec.GarmInstanceNameLabel+"=test-runner")
+	})
+	// Objects a job created through the socket proxy only carry its owner label
+	ownedArgs := mock.MatchedBy(func(opts any) bool {
+		return listFilters(opts).ExactMatch("label", sockproxy.OwnerLabel+"=test-runner")
+	})
+
+	mockClient.On("ContainerInspect", mock.Anything, "test-runner").Return(types.ContainerJSON{}, errdefs.NotFound(errors.New("not found")))
+	mockClient.On("ContainerRemove", mock.Anything, "test-runner", mock.Anything).Return(errdefs.NotFound(errors.New("not found")))
+	mockClient.On("ContainerList", mock.Anything, instanceArgs).Return([]types.Container{
+		{ID: "proxy-id", Labels: map[string]string{spec.GarmRoleLabel: spec.RoleSocketProxy}},
+	}, nil)
+	mockClient.On("ContainerList", mock.Anything, ownedArgs).Return([]types.Container{
+		{ID: "job-id", Labels: map[string]string{sockproxy.OwnerLabel: "test-runner"}},
+	}, nil)
+	mockClient.On("ContainerRemove", mock.Anything, "proxy-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("ContainerRemove", mock.Anything, "job-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("NetworkList", mock.Anything, ownedArgs).Return([]types.NetworkResource{{ID: "job-net-id", Name: "job-net"}}, nil)
+	mockClient.On("NetworkRemove", mock.Anything, "job-net-id").Return(nil)
+	mockClient.On("VolumeList", mock.Anything, instanceArgs).Return(volume.ListResponse{
+		Volumes: []*volume.Volume{{Name: "test-runner-docker-proxy"}},
+	}, nil)
+	mockClient.On("VolumeList", mock.Anything, ownedArgs).Return(volume.ListResponse{
+		Volumes: []*volume.Volume{{Name: "job-cache"}},
+	}, nil)
+	mockClient.On("VolumeRemove", mock.Anything, "test-runner-docker-proxy", true).Return(nil)
+	mockClient.On("VolumeRemove", mock.Anything, "job-cache", true).Return(nil)
+
+	err := p.DeleteInstance(context.Background(), "test-runner")
+	assert.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestRemoveAllInstancesRemovesProxyObjects(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{RemoveVolumes: true},
+		DockerClient: mockClient,
+	}
+
+	controllerArgs := mock.MatchedBy(func(opts any) bool {
+		args := listFilters(opts)
+		return args.ExactMatch("label", spec.GarmControllerIDLabel+"=test-controller") && len(args.Get("label")) == 1
+	})
+	instanceArgs := mock.MatchedBy(func(opts any) bool {
+		return listFilters(opts).ExactMatch("label", spec.GarmInstanceNameLabel+"=test-runner")
+	})
+	ownedArgs := mock.MatchedBy(func(opts any) bool {
+		return listFilters(opts).ExactMatch("label", sockproxy.OwnerLabel+"=test-runner")
+	})
+
+	mockClient.On("ContainerList", mock.Anything, controllerArgs).Return([]types.Container{
+		{ID: "runner-id", Names: []string{"/test-runner"}, Labels: map[string]string{spec.GarmInstanceNameLabel: "test-runner"}},
+		{ID: "proxy-id", Labels: map[string]string{spec.GarmInstanceNameLabel: "test-runner", spec.GarmRoleLabel: spec.RoleSocketProxy}},
+	}, nil)
+	mockClient.On("VolumeList", mock.Anything, controllerArgs).Return(volume.ListResponse{
+		Volumes: []*volume.Volume{{Name: "test-runner-docker-proxy", Labels: map[string]string{spec.GarmInstanceNameLabel: "test-runner"}}},
+	}, nil)
+	mockClient.On("ContainerRemove", mock.Anything, "runner-id", mock.Anything).Return(nil)
+	mockClient.On("ContainerRemove", mock.Anything, "proxy-id", mock.Anything).Return(nil).Once()
+	mockClient.On("ContainerList", mock.Anything, instanceArgs).Return([]types.Container{}, nil)
+	mockClient.On("ContainerList", mock.Anything, ownedArgs).Return([]types.Container{
+		{ID: "job-id", Labels: map[string]string{sockproxy.OwnerLabel: "test-runner"}},
+	}, nil)
+	mockClient.On("ContainerRemove", mock.Anything, "job-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("NetworkList", mock.Anything, ownedArgs).Return([]types.NetworkResource{{ID: "job-net-id", Name: "job-net"}}, nil)
+	mockClient.On("NetworkRemove", mock.Anything, "job-net-id").Return(nil)
+	mockClient.On("VolumeList", mock.Anything, instanceArgs).Return(volume.ListResponse{}, nil)
+	mockClient.On("VolumeList", mock.Anything, ownedArgs).Return(volume.ListResponse{
+		Volumes: []*volume.Volume{{Name: "job-cache"}},
+	}, nil)
+	mockClient.On("VolumeRemove", mock.Anything, "job-cache", true).Return(nil)
+	mockClient.On("VolumeRemove", mock.Anything, "test-runner-docker-proxy", true).Return(nil)
+
+	require.NoError(t, p.RemoveAllInstances(context.Background()))
+	mockClient.AssertExpectations(t)
+}
+
+// listFilters returns the filters of Docker list options.
+func listFilters(opts any) filters.Args {
+	switch o := opts.(type) {
+	case types.ContainerListOptions:
+		return o.Filters
+	case types.NetworkListOptions:
+		return o.Filters
+	case volume.ListOptions:
+		return o.Filters
+	}
+	return filters.NewArgs()
+}
+
+// drainingRunner returns a running runner with the given drain labels.
+func drainingRunner(running bool, labels map[string]string) types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:    "container-id",
+			State: &types.ContainerState{Running: running},
+		},
+		Config: &container.Config{Labels: labels},
+	}
+}
+
+func TestDeleteInstanceDrainsRunner(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		Config:       &config.ProviderConfig{RemoveVolumes: true},
+		DockerClient: mockClient,
+	}
+	drainPollInterval = time.Millisecond
+
+	labels := map[string]string{
+		spec.GarmInstanceNameLabel: "test-runner",
+		spec.GarmDrainTimeoutLabel: "1m",
+		spec.GarmDrainSignalLabel:  "SIGINT",
+	}
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(drainingRunner(true, labels), nil).Twice()
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(drainingRunner(false, labels), nil).Once()
+	mockClient.On("ContainerKill", mock.Anything, "container-id", "SIGINT").Return(nil)
+	mockClient.On("ContainerRemove", mock.Anything, "container-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+	mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+	mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{}, nil)
+
+	err := p.DeleteInstance(context.Background(), "container-id")
+	assert.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestStopDrainsRunnerWithCommand(t *testing.T) {
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		Config:       &config.ProviderConfig{},
+		DockerClient: mockClient,
+	}
+	drainPollInterval = time.Millisecond
+
+	labels := map[string]string{
+		spec.GarmDrainTimeoutLabel: "10ms",
+		spec.GarmDrainCommandLabel: `["/runner/config.sh","remove"]`,
+	}
+	// The runner never exits, so it is stopped after the drain timeout
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(drainingRunner(true, labels), nil)
+	mockClient.On("ContainerExecCreate", mock.Anything, "container-id", types.ExecConfig{
+		Cmd:    []string{"/runner/config.sh", "remove"},
+		Detach: true,
+	}).Return(types.IDResponse{ID: "exec-id"}, nil)
+	mockClient.On("ContainerExecStart", mock.Anything, "exec-id", types.ExecStartCheck{Detach: true}).Return(nil)
+	mockClient.On("ContainerStop", mock.Anything, "container-id", container.StopOptions{}).Return(nil)
+
+	err := p.Stop(context.Background(), "container-id", false)
+	assert.NoError(t, err)
 	mockClient.AssertExpectations(t)
+
+	// Forced stops skip draining
+	zero := 0
+	mockClient.On("ContainerInspect", mock.Anything, "forced-id").Return(drainingRunner(true, labels), nil)
+	mockClient.On("ContainerStop", mock.Anything, "forced-id", container.StopOptions{Timeout: &zero}).Return(nil)
+	assert.NoError(t, p.Stop(context.Background(), "forced-id", true))
+	mockClient.AssertNumberOfCalls(t, "ContainerExecCreate", 1)
+}
+
+func TestStopMarksRunnerForReaper(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{},
+		DockerClient: mockClient,
+	}
+
+	labels := map[string]string{
+		spec.GarmControllerIDLabel: "test-controller",
+		spec.GarmInstanceNameLabel: "test-runner",
+		spec.GarmPoolIDLabel:       "test-pool",
+	}
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(drainingRunner(true, labels), nil)
+	mockClient.On("ContainerStop", mock.Anything, "container-id", mock.Anything).Return(nil)
+	mockClient.On("VolumeCreate", mock.Anything, volume.CreateOptions{
+		Name: "test-runner-garm-stopped",
+		Labels: map[string]string{
+			spec.GarmControllerIDLabel: "test-controller",
+			spec.GarmInstanceNameLabel: "test-runner",
+			spec.GarmPoolIDLabel:       "test-pool",
+			spec.GarmRoleLabel:         spec.RoleStopMarker,
+		},
+	}).Return(volume.Volume{}, nil)
+	require.NoError(t, p.Stop(context.Background(), "container-id", true))
+
+	mockClient.On("ContainerStart", mock.Anything, "container-id", mock.Anything).Return(nil)
+	mockClient.On("VolumeRemove", mock.Anything, "test-runner-garm-stopped", true).Return(nil)
+	require.NoError(t, p.Start(context.Background(), "container-id"))
+	mockClient.AssertExpectations(t)
+}
+
+// multiplexedLogs returns a log stream in the format Docker uses for
+// containers without a TTY.
+func multiplexedLogs(stdout string) io.ReadCloser {
+	var buf bytes.Buffer
+	stdcopy.NewStdWriter(&buf, stdcopy.Stdout).Write([]byte(stdout))
+	return io.NopCloser(&buf)
+}
+
+func runnerState(status string, startedAt, finishedAt time.Time) types.ContainerJSON {
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			State: &types.ContainerState{
+				Status:     status,
+				StartedAt:  startedAt.Format(time.RFC3339Nano),
+				FinishedAt: finishedAt.Format(time.RFC3339Nano),
+			},
+		},
+		Config: &container.Config{},
+	}
+}
+
+func TestReap(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{},
+		DockerClient: mockClient,
+	}
+	now := time.Now()
+
+	labels := func(name string) map[string]string {
+		return map[string]string{
+			spec.GarmControllerIDLabel: "test-controller",
+			spec.GarmInstanceNameLabel: name,
+			spec.GarmPoolIDLabel:       "test-pool",
+			spec.GarmEphemeralLabel:    "true",
+		}
+	}
+	persistent := labels("persistent")
+	persistent[spec.GarmEphemeralLabel] = "false"
+	mockClient.On("ContainerList", mock.Anything, mock.MatchedBy(func(opts types.ContainerListOptions) bool {
+		return opts.Filters.ExactMatch("label", spec.GarmControllerIDLabel+"=test-controller") && opts.All
+	})).Return([]types.Container{
+		{ID: "old-exited", State: "exited", Labels: labels("old-exited")},
+		{ID: "new-exited", State: "exited", Labels: labels("new-exited")},
+		{ID: "persistent", State: "exited", Labels: persistent},
+		{ID: "restarting", State: "exited", Labels: labels("restarting")},
+		{ID: "stopped", State: "exited", Labels: labels("stopped")},
+		{ID: "registered", State: "running", Labels: labels("registered")},
+		{ID: "stuck", State: "running", Labels: labels("stuck")},
+		{ID: "proxy", State: "exited", Labels: map[string]string{spec.GarmRoleLabel: spec.RoleSocketProxy}},
+	}, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "old-exited").Return(runnerState("exited", now.Add(-2*time.Hour), now.Add(-time.Hour)), nil)
+	mockClient.On("ContainerInspect", mock.Anything, "new-exited").Return(runnerState("exited", now.Add(-2*time.Minute), now.Add(-time.Minute)), nil)
+	restarting := runnerState("exited", now.Add(-2*time.Hour), now.Add(-time.Hour))
+	restarting.State.ExitCode = 1
+	restarting.HostConfig = &container.HostConfig{RestartPolicy: container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}}
+	mockClient.On("ContainerInspect", mock.Anything, "restarting").Return(restarting, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "stopped").Return(runnerState("exited", now.Add(-2*time.Hour), now.Add(-time.Hour)), nil)
+	// Garm stopped one runner, which left a marker
+	mockClient.On("VolumeList", mock.Anything, mock.MatchedBy(func(opts volume.ListOptions) bool {
+		return opts.Filters.ExactMatch("label", spec.GarmInstanceNameLabel+"=stopped")
+	})).Return(volume.ListResponse{Volumes: []*volume.Volume{{Name: "stopped-garm-stopped"}}}, nil)
+	mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "registered").Return(runnerState("running", now.Add(-time.Hour), time.Time{}), nil)
+	mockClient.On("ContainerInspect", mock.Anything, "stuck").Return(runnerState("running", now.Add(-time.Hour), time.Time{}), nil)
+	// Only the registration window of the logs is read
+	registrationWindow := mock.MatchedBy(func(o types.ContainerLogsOptions) bool {
+		return o.Since != "" && o.Until != "" && o.Tail == ""
+	})
+	mockClient.On("ContainerLogs", mock.Anything, "registered", registrationWindow).Return(multiplexedLogs("Connected to GitHub\nListening for Jobs\n"), nil)
+	mockClient.On("ContainerLogs", mock.Anything, "stuck", registrationWindow).Return(multiplexedLogs("Connecting to GitHub\n"), nil)
+
+	opts := ReapOptions{
+		ExitedGracePeriod:   10 * time.Minute,
+		RegistrationTimeout: 15 * time.Minute,
+		RegisteredPattern:   regexp.MustCompile("Listening for Jobs"),
+		DryRun:              true,
+	}
+	results, err := p.Reap(context.Background(), opts)
+	assert.NoError(t, err)
+	if assert.Len(t, results, 2) {
+		assert.Equal(t, "old-exited", results[0].Name)
+		assert.Contains(t, results[0].Reason, "exited 1h0m0s ago")
+		assert.Equal(t, "stuck", results[1].Name)
+		assert.Contains(t, results[1].Reason, "not registered")
+		assert.False(t, results[0].Removed)
+	}
+	mockClient.AssertNotCalled(t, "ContainerRemove", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestReapRemovesContainers(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	auditPath := filepath.Join(t.TempDir(), "audit.jsonl")
+	p := &Provider{
+		Config:       &config.ProviderConfig{RemoveVolumes: true, Audit: config.AuditConfig{Path: auditPath}},
+		DockerClient: mockClient,
+	}
+
+	labels := map[string]string{
+		spec.GarmControllerIDLabel: "old-controller",
+		spec.GarmInstanceNameLabel: "old-exited",
+		spec.GarmEphemeralLabel:    "true",
+	}
+	mockClient.On("ContainerList", mock.Anything, mock.MatchedBy(func(opts types.ContainerListOptions) bool {
+		// Without a controller ID, runners of all controllers are reaped
+		return opts.Filters.ExactMatch("label", spec.GarmControllerIDLabel)
+	})).Return([]types.Container{
+		{ID: "old-exited", State: "exited", Labels: labels},
+	}, nil).Once()
+	inspect := runnerState("exited", time.Now().Add(-2*time.Hour), time.Now().Add(-time.Hour))
+	inspect.ID = "old-exited"
+	inspect.Config.Labels = labels
+	mockClient.On("ContainerInspect", mock.Anything, "old-exited").Return(inspect, nil)
+	mockClient.On("ContainerRemove", mock.Anything, "old-exited", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	// The reaped runner's resources belong to its own controller
+	mockClient.On("ContainerList", mock.Anything, mock.MatchedBy(func(opts types.ContainerListOptions) bool {
+		return opts.Filters.ExactMatch("label", spec.GarmControllerIDLabel+"=old-controller")
+	})).Return([]types.Container{}, nil)
+	mockClient.On("ContainerList", mock.Anything, mock.MatchedBy(func(opts types.ContainerListOptions) bool {
+		return opts.Filters.ExactMatch("label", sockproxy.OwnerLabel+"=old-exited")
+	})).Return([]types.Container{}, nil)
+	mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+	mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{}, nil)
+
+	results, err := p.Reap(context.Background(), ReapOptions{ExitedGracePeriod: 10 * time.Minute})
+	assert.NoError(t, err)
+	if assert.Len(t, results, 1) {
+		assert.True(t, results[0].Removed)
+	}
+	mockClient.AssertExpectations(t)
+
+	// Reaping goes through the delete path, so it is audited
+	data, err := os.ReadFile(auditPath)
+	require.NoError(t, err)
+	var entry audit.Entry
+	require.NoError(t, json.Unmarshal(data, &entry))
+	assert.Equal(t, audit.ActionReap, entry.Action)
+	assert.Equal(t, "old-exited", entry.Instance)
+	assert.Equal(t, audit.OutcomeSuccess, entry.Outcome)
+}
+
+func TestGarbageCollect(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		Config:       &config.ProviderConfig{RemoveVolumes: true},
+		DockerClient: mockClient,
+	}
+
+	labels := func(controllerID, poolID, name string) map[string]string {
+		return map[string]string{spec.GarmControllerIDLabel: controllerID, spec.GarmPoolIDLabel: poolID, spec.GarmInstanceNameLabel: name}
+	}
+	owned := func(owner string) map[string]string {
+		return map[string]string{sockproxy.OwnerLabel: owner}
+	}
+	listArgs := func(label string) any {
+		return mock.MatchedBy(func(opts any) bool {
+			return slices.Equal(listFilters(opts).Get("label"), []string{label})
+		})
+	}
+	garmArgs, ownedArgs := listArgs(spec.GarmControllerIDLabel), listArgs(sockproxy.OwnerLabel)
+
+	mockClient.On("ContainerList", mock.Anything, garmArgs).Return([]types.Container{
+		{ID: "live", Names: []string{"/live"}, Labels: labels("controller-1", "pool-1", "live")},
+		{ID: "deleted-pool", Names: []string{"/deleted-pool"}, Labels: labels("controller-1", "pool-2", "deleted-pool")},
+		{ID: "old-controller", Names: []string{"/old-controller"}, Labels: labels("controller-0", "pool-0", "old-controller")},
+	}, nil)
+	mockClient.On("VolumeList", mock.Anything, garmArgs).Return(volume.ListResponse{
+		Volumes: []*volume.Volume{{Name: "old-volume", Labels: labels("controller-0", "pool-0", "old-controller")}},
+	}, nil)
+	mockClient.On("NetworkList", mock.Anything, garmArgs).Return([]types.NetworkResource{
+		{ID: "net-id", Name: "old-network", Labels: labels("controller-0", "", "")},
+	}, nil)
+	// Objects jobs created through the socket proxy follow their runner, and
+	// are orphans once it is gone
+	mockClient.On("ContainerList", mock.Anything, ownedArgs).Return([]types.Container{
+		{ID: "job-live", Names: []string{"/job-live"}, Labels: owned("live")},
+		{ID: "job-gone", Names: []string{"/job-gone"}, Labels: owned("vanished")},
+	}, nil)
+	mockClient.On("VolumeList", mock.Anything, ownedArgs).Return(volume.ListResponse{
+		Volumes: []*volume.Volume{{Name: "job-cache", Labels: owned("old-controller")}},
+	}, nil)
+	mockClient.On("NetworkList", mock.Anything, ownedArgs).Return([]types.NetworkResource{}, nil)
+
+	opts := GCOptions{
+		LiveControllers: []string{"controller-1"},
+		LivePools:       []string{"pool-1"},
+		DryRun:          true,
+	}
+	groups, err := p.GarbageCollect(context.Background(), opts)
+	assert.NoError(t, err)
+	if assert.Len(t, groups, 5) {
+		assert.Equal(t, GCGroup{Objects: []GCObject{
+			{Kind: GCKindContainer, ID: "job-gone", Name: "job-gone", Orphan: true},
+		}}, groups[0])
+		assert.Equal(t, GCGroup{ControllerID: "controller-0", PoolID: "", Objects: []GCObject{
+			{Kind: GCKindNetwork, ID: "net-id", Name: "old-network", Orphan: true},
+		}}, groups[1])
+		assert.Equal(t, "pool-0", groups[2].PoolID)
+		assert.Equal(t, []string{"old-controller", "old-volume", "job-cache"}, []string{groups[2].Objects[0].Name, groups[2].Objects[1].Name, groups[2].Objects[2].Name})
+		assert.Equal(t, "pool-1", groups[3].PoolID)
+		assert.Len(t, groups[3].Objects, 2)
+		assert.False(t, groups[3].Objects[0].Orphan)
+		assert.False(t, groups[3].Objects[1].Orphan)
+		assert.True(t, groups[4].Objects[0].Orphan)
+	}
+	mockClient.AssertNotCalled(t, "ContainerRemove", mock.Anything, mock.Anything, mock.Anything)
+
+	// Orphaned runners are removed like DeleteInstance does it, which also
+	// removes their volumes and the objects their jobs created
+	for _, name := range []string{"deleted-pool", "old-controller"} {
+		mockClient.On("ContainerInspect", mock.Anything, name).Return(types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: name, Name: "/" + name, State: &types.ContainerState{Status: "exited"}},
+			Config:            &container.Config{Labels: map[string]string{spec.GarmInstanceNameLabel: name}},
+		}, nil)
+		mockClient.On("ContainerRemove", mock.Anything, name, types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	}
+	resourceArgs := mock.MatchedBy(func(opts any) bool {
+		for _, label := range listFilters(opts).Get("label") {
+			if strings.HasPrefix(label, spec.GarmInstanceNameLabel+"=") || strings.HasPrefix(label, sockproxy.OwnerLabel+"=") {
+				return true
+			}
+		}
+		return false
+	})
+	mockClient.On("ContainerList", mock.Anything, resourceArgs).Return([]types.Container{}, nil)
+	mockClient.On("NetworkList", mock.Anything, resourceArgs).Return([]types.NetworkResource{}, nil)
+	mockClient.On("VolumeList", mock.Anything, resourceArgs).Return(volume.ListResponse{}, nil)
+	mockClient.On("ContainerRemove", mock.Anything, "job-gone", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("VolumeRemove", mock.Anything, "old-volume", true).Return(nil)
+	mockClient.On("VolumeRemove", mock.Anything, "job-cache", true).Return(nil)
+	mockClient.On("NetworkRemove", mock.Anything, "net-id").Return(nil)
+
+	opts.DryRun = false
+	groups, err = p.GarbageCollect(context.Background(), opts)
+	assert.NoError(t, err)
+	for _, i := range []int{0, 1, 2, 4} {
+		for _, obj := range groups[i].Objects {
+			assert.True(t, obj.Removed, obj.Name)
+		}
+	}
+	assert.False(t, groups[3].Objects[0].Removed)
+	mockClient.AssertExpectations(t)
+	mockClient.AssertNotCalled(t, "ContainerRemove", mock.Anything, "job-live", mock.Anything)
+
+	_, err = p.GarbageCollect(context.Background(), GCOptions{})
+	assert.Error(t, err)
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	out := filepath.Join(t.TempDir(), "instance.json")
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		Config: &config.ProviderConfig{
+			RemoveVolumes: true,
+			Hooks: config.HooksConfig{
+				PreDelete: []config.HookConfig{
+					{Command: []string{"sh", "-c", `test "$GARM_HOOK" = pre_delete && test -z "$GARM_CONTROLLER_ID$REGISTRY_TOKEN" && test -n "$PATH" && cat > ` + out}},
+					{Exec: []string{"/snapshot-logs"}, OnFailure: config.HookFailureIgnore},
+				},
+			},
+		},
+		DockerClient: mockClient,
+	}
+	hookPollInterval = time.Millisecond
+	// Host hooks don't get the provider's environment
+	t.Setenv("GARM_CONTROLLER_ID", "controller")
+	t.Setenv("REGISTRY_TOKEN", "secret")
+
+	labels := map[string]string{spec.GarmInstanceNameLabel: "test-runner"}
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(drainingRunner(false, labels), nil)
+	mockClient.On("ContainerExecCreate", mock.Anything, "container-id", mock.MatchedBy(func(c types.ExecConfig) bool {
+		return c.Cmd[0] == "/snapshot-logs" && c.Env[0] == "GARM_HOOK=pre_delete"
+	})).Return(types.IDResponse{ID: "exec-id"}, nil)
+	mockClient.On("ContainerExecStart", mock.Anything, "exec-id", types.ExecStartCheck{Detach: true}).Return(nil)
+	mockClient.On("ContainerExecInspect", mock.Anything, "exec-id").Return(types.ContainerExecInspect{Running: true}, nil).Once()
+	mockClient.On("ContainerExecInspect", mock.Anything, "exec-id").Return(types.ContainerExecInspect{ExitCode: 1}, nil).Once()
+	mockClient.On("ContainerRemove", mock.Anything, "container-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+	mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+	mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{}, nil)
+
+	// The failing exec hook is ignored
+	err := p.DeleteInstance(context.Background(), "container-id")
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+
+	var instance params.ProviderInstance
+	data, err := os.ReadFile(out)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(data, &instance))
+	assert.Equal(t, "test-runner", instance.Name)
+	assert.Equal(t, "container-id", instance.ProviderID)
+
+	// A failing pre_delete hook can't keep the runner
+	p.Config.Hooks.PreDelete = []config.HookConfig{{Command: []string{"false"}, OnFailure: config.HookFailureWarn}}
+	err = p.DeleteInstance(context.Background(), "container-id")
+	assert.NoError(t, err)
+	mockClient.AssertNumberOfCalls(t, "ContainerRemove", 2)
+}
+
+func TestDeleteInstanceArchivesLogs(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		Config: &config.ProviderConfig{
+			RemoveVolumes: true,
+			LogArchive:    config.LogArchiveConfig{Directory: dir, Timeout: time.Minute},
+		},
+		DockerClient: mockClient,
+	}
+
+	labels := map[string]string{spec.GarmInstanceNameLabel: "test-runner", spec.GarmPoolIDLabel: "test-pool"}
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(drainingRunner(false, labels), nil)
+	mockClient.On("ContainerLogs", mock.Anything, "container-id", types.ContainerLogsOptions{
+		ShowStdout: true,
+		ShowStderr: true,
+		Timestamps: true,
+	}).Return(multiplexedLogs("Failed to register runner\n"), nil)
+	mockClient.On("ContainerRemove", mock.Anything, "container-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+	mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+	mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{}, nil)
+
+	err := p.DeleteInstance(context.Background(), "container-id")
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+
+	files, err := filepath.Glob(filepath.Join(dir, "test-pool", "test-runner-*.log"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	data, err := os.ReadFile(files[0])
+	require.NoError(t, err)
+	assert.Equal(t, "Failed to register runner\n", string(data))
+}
+
+func TestCreateInstanceWaitsForReadiness(t *testing.T) {
+	tests := []struct {
+		name    string
+		state   types.ContainerState
+		logs    []string
+		wantErr string
+	}{
+		{
+			name:  "registered",
+			state: types.ContainerState{Running: true},
+			logs:  []string{"Connecting to GitHub\n", "Connecting to GitHub\nListening for Jobs\n"},
+		},
+		{
+			name:    "crashed",
+			state:   types.ContainerState{ExitCode: 1},
+			logs:    []string{"invalid token\n"},
+			wantErr: "runner exited with code 1, last logs:\ninvalid token",
+		},
+		{
+			name:    "unhealthy",
+			state:   types.ContainerState{Running: true, Health: &types.Health{Status: types.Unhealthy}},
+			logs:    []string{""},
+			wantErr: "runner is unhealthy",
+		},
+	}
+
+	readinessPollInterval = time.Millisecond
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mockClient := new(MockDockerClient)
+			p := &Provider{
+				ControllerID: "test-controller",
+				Config: &config.ProviderConfig{
+					DinDMode:      config.DinDModeNone,
+					RemoveVolumes: true,
+					Readiness: config.ReadinessConfig{
+						WaitHealthy: tc.state.Health != nil,
+						LogPattern:  "Listening for Jobs",
+						Timeout:     time.Minute,
+						LogTail:     10,
+					},
+				},
+				DockerClient: mockClient,
+			}
+
+			mockClient.On("ImageInspectWithRaw", mock.Anything, mock.Anything).Return(types.ImageInspect{}, []byte{}, nil)
+			mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "test-runner").Return(container.CreateResponse{ID: "container-id"}, nil)
+			mockClient.On("ContainerStart", mock.Anything, "container-id", mock.Anything).Return(nil)
+			state := tc.state
+			mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+				ContainerJSONBase: &types.ContainerJSONBase{ID: "container-id", State: &state},
+				Config:            &container.Config{},
+			}, nil)
+			for i, logs := range tc.logs {
+				call := mockClient.On("ContainerLogs", mock.Anything, "container-id", mock.Anything).Return(multiplexedLogs(logs), nil)
+				if i < len(tc.logs)-1 {
+					call.Once()
+				}
+			}
+			if tc.wantErr != "" {
+				mockClient.On("ContainerRemove", mock.Anything, "container-id", types.ContainerRemoveOptions{Force: true, RemoveVolumes: true}).Return(nil)
+				mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+				mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+				mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{}, nil)
+			}
+
+			_, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+				Name:    "test-runner",
+				Image:   "ubuntu:latest",
+				RepoURL: "https://github.com/org/repo",
+			})
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUnhealthyRunnersAreErrors(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{},
+		DockerClient: mockClient,
+	}
+
+	unhealthy := types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID: "container-1",
+			State: &types.ContainerState{
+				Running: true,
+				Health: &types.Health{
+					Status:        types.Unhealthy,
+					FailingStreak: 3,
+					Log:           []*types.HealthcheckResult{{ExitCode: 1, Output: "Runner.Listener not running\n"}},
+				},
+			},
+		},
+		Config: &container.Config{Labels: map[string]string{}},
+	}
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+		{ID: "container-1", Names: []string{"/wedged"}, State: "running", Status: "Up 2 hours (unhealthy)"},
+		{ID: "container-2", Names: []string{"/fine"}, State: "running", Status: "Up 2 hours (healthy)"},
+	}, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container-1").Return(unhealthy, nil)
+
+	instances, err := p.ListInstances(context.Background(), "")
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	assert.Equal(t, params.InstanceError, instances[0].Status)
+	assert.Equal(t, "healthcheck failed 3 times, last exit code 1: Runner.Listener not running", string(instances[0].ProviderFault))
+	assert.Equal(t, params.InstanceRunning, instances[1].Status)
+	assert.Empty(t, instances[1].ProviderFault)
+
+	instance, err := p.GetInstance(context.Background(), "container-1")
+	require.NoError(t, err)
+	assert.Equal(t, params.InstanceError, instance.Status)
+	assert.Equal(t, instances[0].ProviderFault, instance.ProviderFault)
+	mockClient.AssertExpectations(t)
+}
+
+func TestMaxLifetime(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{},
+		DockerClient: mockClient,
+	}
+
+	created := time.Now().Add(-3 * time.Hour)
+	labels := map[string]string{spec.GarmInstanceNameLabel: "old-runner", spec.GarmMaxLifetimeLabel: "2h0m0s"}
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{
+		{ID: "container-1", Names: []string{"/old-runner"}, State: "running", Created: created.Unix(), Labels: labels},
+	}, nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container-1").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:      "container-1",
+			Created: created.Format(time.RFC3339Nano),
+			State:   &types.ContainerState{Running: true},
+		},
+		Config: &container.Config{Labels: labels},
+	}, nil)
+
+	instances, err := p.ListInstances(context.Background(), "")
+	require.NoError(t, err)
+	assert.Equal(t, params.InstanceError, instances[0].Status)
+	assert.Equal(t, "runner exceeded its max lifetime of 2h0m0s", string(instances[0].ProviderFault))
+
+	instance, err := p.GetInstance(context.Background(), "container-1")
+	require.NoError(t, err)
+	assert.Equal(t, params.InstanceError, instance.Status)
+
+	results, err := p.Reap(context.Background(), ReapOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "exceeded max lifetime of 2h0m0s", results[0].Reason)
+}
+
+func TestPulledBytes(t *testing.T) {
+	t.Parallel()
+	stream := strings.Join([]string{
+		`{"status":"Pulling from library/ubuntu","id":"latest"}`,
+		`{"status":"Downloading","progressDetail":{"current":100,"total":300},"id":"layer1"}`,
+		`{"status":"Downloading","progressDetail":{"current":300,"total":300},"id":"layer1"}`,
+		`{"status":"Download complete","progressDetail":{},"id":"layer1"}`,
+		`{"status":"Downloading","progressDetail":{"current":50,"total":50},"id":"layer2"}`,
+		`{"status":"Already exists","progressDetail":{},"id":"layer3"}`,
+		`{"status":"Status: Downloaded newer image for ubuntu:latest"}`,
+	}, "\n")
+	assert.Equal(t, int64(350), pulledBytes(strings.NewReader(stream)))
+	assert.Equal(t, int64(0), pulledBytes(strings.NewReader("not json")))
+}
+
+func TestTracedClientSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	prev := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(prev)
+
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{Runtime: "runc", DinDMode: config.DinDModeNone},
+		DockerClient: newTracedClient(mockClient),
+	}
+
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "ubuntu:latest").Return(types.ImageInspect{}, []byte{}, errdefs.NotFound(errors.New("image not found")))
+	mockClient.On("ImagePull", mock.Anything, "ubuntu:latest", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "test-runner").Return(container.CreateResponse{ID: "container-id"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "container-id", mock.Anything).Return(nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "container-id"},
+	}, nil)
+
+	ctx, parent := otel.Tracer("test").Start(context.Background(), "CreateInstance")
+	_, err := p.CreateInstance(ctx, params.BootstrapInstance{Name: "test-runner", Image: "ubuntu:latest", RepoURL: "https://github.com/org/repo"})
+	parent.End()
+	require.NoError(t, err)
+
+	var names []string
+	for _, s := range recorder.Ended() {
+		if s.Name() == "CreateInstance" {
+			continue
+		}
+		names = append(names, s.Name())
+		assert.Equal(t, parent.SpanContext().SpanID(), s.Parent().SpanID(), s.Name())
+		if s.Name() == "docker.ImageInspectWithRaw" {
+			assert.Equal(t, codes.Error, s.Status().Code)
+		}
+	}
+	assert.Equal(t, []string{
+		"docker.ImageInspectWithRaw",
+		"docker.ImagePull",
+		"docker.ContainerCreate",
+		"docker.ContainerStart",
+		"docker.ContainerInspect",
+	}, names)
+}
+
+func TestDeleteInstanceWritesAuditLog(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{Audit: config.AuditConfig{Path: path}, RemoveVolumes: true},
+		DockerClient: mockClient,
+	}
+
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         "container-id",
+			Image:      "sha256:abc",
+			HostConfig: &container.HostConfig{Privileged: true, Binds: []string{"/cache:/cache"}},
+		},
+		Config: &container.Config{Image: "runner:latest", Labels: map[string]string{spec.GarmInstanceNameLabel: "test-runner"}},
+	}, nil)
+	mockClient.On("ContainerRemove", mock.Anything, "container-id", mock.Anything).Return(nil)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{}, nil)
+	mockClient.On("VolumeList", mock.Anything, mock.Anything).Return(volume.ListResponse{}, nil)
+	mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{}, nil)
+	mockClient.On("ImageInspectWithRaw", mock.Anything, "sha256:abc").Return(types.ImageInspect{
+		ID:          "sha256:abc",
+		RepoDigests: []string{"runner@sha256:def"},
+	}, []byte{}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "gone", mock.Anything).Return(errdefs.NotFound(errors.New("no such container")))
+
+	require.NoError(t, p.DeleteInstance(context.Background(), "container-id"))
+	assert.Error(t, p.Start(context.Background(), "gone"))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	require.Len(t, lines, 2)
+
+	var entry audit.Entry
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &entry))
+	assert.Equal(t, audit.ActionDeleteInstance, entry.Action)
+	assert.Equal(t, "test-runner", entry.Instance)
+	assert.Equal(t, "container-id", entry.ContainerID)
+	assert.Equal(t, "test-controller", entry.Env.ControllerID)
+	assert.Equal(t, []string{"runner@sha256:def"}, entry.ImageDigests)
+	assert.True(t, entry.HostConfig.Privileged)
+	assert.Equal(t, audit.OutcomeSuccess, entry.Outcome)
+
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &entry))
+	assert.Equal(t, audit.ActionStart, entry.Action)
+	assert.Equal(t, audit.OutcomeFailure, entry.Outcome)
+	assert.Contains(t, entry.Error, "no such container")
+}
+
+func TestLogs(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{Config: &config.ProviderConfig{}, DockerClient: mockClient}
+
+	mockClient.On("ContainerInspect", mock.Anything, "test-runner").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "container-id"},
+		Config:            &container.Config{},
+	}, nil)
+	mockClient.On("ContainerLogs", mock.Anything, "container-id", mock.MatchedBy(func(o types.ContainerLogsOptions) bool {
+		return o.ShowStdout && o.ShowStderr && o.Tail == "10" && !o.Follow
+	})).Return(multiplexedLogs("Listening for Jobs\n"), nil)
+
+	var out bytes.Buffer
+	require.NoError(t, p.Logs(context.Background(), "test-runner", &out, LogsOptions{Tail: "10"}))
+	assert.Equal(t, "Listening for Jobs\n", out.String())
+}
+
+func TestCheckDaemon(t *testing.T) {
+	t.Parallel()
+	dockerConfig := filepath.Join(t.TempDir(), "config.json")
+	require.NoError(t, os.WriteFile(dockerConfig, []byte(`{"auths":{"ghcr.io":{"auth":"dXNlcjpwYXNz"}}}`), 0o600))
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		Config: &config.ProviderConfig{
+			Runtime:          config.SysboxRuntime,
+			Network:          "runners",
+			DockerConfigPath: dockerConfig,
+			Mounts:           []config.MountConfig{{Type: config.MountTypeImage, Source: "tools:latest", Target: "/tools"}},
+		},
+		DockerClient: mockClient,
+	}
+
+	mockClient.On("ServerVersion", mock.Anything).Return(types.Version{Version: "24.0.7", APIVersion: "1.43"}, nil)
+	mockClient.On("Info", mock.Anything).Return(types.Info{Runtimes: map[string]types.Runtime{"runc": {}, "io.containerd.runc.v2": {}}}, nil)
+	mockClient.On("NetworkList", mock.Anything, mock.Anything).Return([]types.NetworkResource{{Name: "runners-old"}, {Name: "runners", Driver: "bridge"}}, nil)
+
+	checks := p.CheckDaemon(context.Background(), []string{"ghcr.io/org/runner:latest"})
+	require.Len(t, checks, 5)
+
+	assert.Equal(t, CheckFailed, checks[0].Status)
+	assert.Contains(t, checks[0].Detail, "at least 1.48 is required, needed for image mounts")
+	assert.Equal(t, CheckFailed, checks[1].Status)
+	assert.Contains(t, checks[1].Detail, "available: io.containerd.runc.v2, runc")
+	assert.Equal(t, Check{Name: "network", Status: CheckOK, Detail: "runners (bridge driver)"}, checks[2])
+	assert.Equal(t, CheckOK, checks[3].Status)
+	assert.Contains(t, checks[3].Detail, "tools:latest: no credentials for docker.io")
+	assert.Contains(t, checks[3].Detail, "ghcr.io/org/runner:latest: using credentials for ghcr.io")
+	assert.Equal(t, Check{Name: "image_policy", Status: CheckOK, Detail: "ghcr.io/org/runner:latest: allowed"}, checks[4])
+}
+
+func TestCreateInstanceUsesRegistryMirror(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config: &config.ProviderConfig{
+			DinDMode: config.DinDModeNone,
+			Registries: []config.RegistryConfig{
+				{Match: "docker.io/*", Mirror: "mirror.internal/dockerhub/*"},
+				{Match: "mirror.internal", Username: "garm", Password: "secret"},
+			},
+		},
+		DockerClient: mockClient,
+	}
+	mirrored := "mirror.internal/dockerhub/library/ubuntu:22.04"
+
+	mockClient.On("ImageInspectWithRaw", mock.Anything, mirrored).Return(types.ImageInspect{}, []byte{}, errdefs.NotFound(errors.New("image not found")))
+	mockClient.On("ImagePull", mock.Anything, mirrored, mock.MatchedBy(func(opts types.ImagePullOptions) bool {
+		data, err := base64.URLEncoding.DecodeString(opts.RegistryAuth)
+		if err != nil {
+			return false
+		}
+		var auth registry.AuthConfig
+		return json.Unmarshal(data, &auth) == nil &&
+			auth.Username == "garm" && auth.Password == "secret" && auth.ServerAddress == "mirror.internal"
+	})).Return(io.NopCloser(strings.NewReader("")), nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+		return c.Image == mirrored
+	}), mock.Anything, mock.Anything, mock.Anything, "test-runner").Return(container.CreateResponse{ID: "container-id"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "container-id", mock.Anything).Return(nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "container-id"},
+	}, nil)
+
+	_, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+		Name:    "test-runner",
+		Image:   "ubuntu:22.04",
+		RepoURL: "https://github.com/org/repo",
+	})
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceRejectsImageOutsidePolicy(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		Config: &config.ProviderConfig{
+			DinDMode:    config.DinDModePrivileged,
+			ImagePolicy: config.ImagePolicyConfig{Allowed: []string{"ghcr.io/org/*"}, RequireDigest: config.DigestPolicyPrivileged},
+		},
+		DockerClient: mockClient,
+	}
+
+	// Nothing is pulled or created, the mock fails on any call
+	_, err := p.CreateInstance(context.Background(), params.BootstrapInstance{Name: "test-runner", Image: "docker.io/evil/runner:latest"})
+	assert.ErrorContains(t, err, "image docker.io/evil/runner is not allowed by image_policy")
+	_, err = p.CreateInstance(context.Background(), params.BootstrapInstance{Name: "test-runner", Image: "ghcr.io/org/runner:latest"})
+	assert.ErrorContains(t, err, "must be pinned by digest")
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceRequiresDigestForPoolsWithHostAccess(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		Config: &config.ProviderConfig{
+			DinDMode:         config.DinDModeSysbox,
+			AllowedHostPaths: []string{"/run"},
+			ImagePolicy:      config.ImagePolicyConfig{RequireDigest: config.DigestPolicyPrivileged},
+		},
+		DockerClient: mockClient,
+	}
+
+	// The runner would get the host's Docker socket, so nothing is pulled
+	// or created from an unpinned image
+	_, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+		Name:       "test-runner",
+		Image:      "ghcr.io/org/runner:latest",
+		ExtraSpecs: json.RawMessage(`{"mounts": [{"type": "bind", "source": "/run/docker.sock", "target": "/var/run/docker.sock"}]}`),
+	})
+	assert.ErrorContains(t, err, "must be pinned by digest, runners have root on the host")
+	mockClient.AssertExpectations(t)
+}
+
+func TestCreateInstanceVerifiesImageSignature(t *testing.T) {
+	t.Parallel()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(key.Public())
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "cosign.pub")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o644))
+
+	// A local registry stand-in holding the signature of the signed digest
+	signed := "sha256:" + strings.Repeat("1", 64)
+	payload := `{"critical":{"identity":{"docker-reference":"runner"},"image":{"docker-manifest-digest":"` + signed + `"},"type":"cosign container image signature"}}`
+	sum := sha256.Sum256([]byte(payload))
+	sig, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	require.NoError(t, err)
+	payloadDigest := "sha256:" + hex.EncodeToString(sum[:])
+	sigManifest, err := json.Marshal(map[string]any{"layers": []map[string]any{{
+		"mediaType":   imagesig.SimpleSigningMediaType,
+		"digest":      payloadDigest,
+		"annotations": map[string]string{imagesig.SignatureAnnotation: base64.StdEncoding.EncodeToString(sig)},
+	}}})
+	require.NoError(t, err)
+	reg := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v2/runner/manifests/sha256-" + strings.Repeat("1", 64) + ".sig":
+			_, _ = w.Write(sigManifest)
+		case "/v2/runner/blobs/" + payloadDigest:
+			_, _ = w.Write([]byte(payload))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(reg.Close)
+	host := strings.TrimPrefix(reg.URL, "http://")
+
+	tests := []struct {
+		name    string
+		digest  string
+		wantErr string
+	}{
+		{name: "signed", digest: signed},
+		{name: "unsigned", digest: "sha256:" + strings.Repeat("2", 64), wantErr: "no signature found"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			mockClient := new(MockDockerClient)
+			p := &Provider{
+				ControllerID: "test-controller",
+				Config: &config.ProviderConfig{
+					DinDMode: config.DinDModeNone,
+					ImagePolicy: config.ImagePolicyConfig{
+						Signature: config.ImageSignatureConfig{PublicKey: keyPath, Timeout: 10 * time.Second},
+					},
+				},
+				DockerClient: mockClient,
+			}
+			image := host + "/runner:latest"
+			mockClient.On("ImageInspectWithRaw", mock.Anything, image).Return(types.ImageInspect{
+				RepoDigests: []string{"docker.io/library/runner@sha256:" + strings.Repeat("3", 64), host + "/runner@" + tc.digest},
+			}, []byte{}, nil)
+			if tc.wantErr == "" {
+				mockClient.On("ContainerCreate", mock.Anything, mock.MatchedBy(func(c *container.Config) bool {
+					return c.Image == host+"/runner@"+signed
+				}), mock.Anything, mock.Anything, mock.Anything, "test-runner").Return(container.CreateResponse{ID: "container-id"}, nil)
+				mockClient.On("ContainerStart", mock.Anything, "container-id", mock.Anything).Return(nil)
+				mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+					ContainerJSONBase: &types.ContainerJSONBase{ID: "container-id"},
+				}, nil)
+			}
+
+			_, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+				Name:    "test-runner",
+				Image:   image,
+				RepoURL: "https://github.com/org/repo",
+			})
+			if tc.wantErr == "" {
+				require.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+			mockClient.AssertExpectations(t)
+		})
+	}
+}
+
+func TestCollectImages(t *testing.T) {
+	t.Parallel()
+	digest := func(c string) string { return "sha256:" + strings.Repeat(c, 64) }
+	now := time.Now()
+	images := []types.ImageSummary{
+		// The current runner image, in use
+		{ID: "img-current", RepoTags: []string{"ghcr.io/org/runner:latest"}, RepoDigests: []string{"ghcr.io/org/runner@" + digest("1")}, Created: now.Add(-time.Hour).Unix(), Size: 500},
+		// Not among the newest, but within the retention
+		{ID: "img-recent", RepoDigests: []string{"ghcr.io/org/runner@" + digest("5")}, Created: now.Add(-2 * time.Hour).Unix(), Size: 500},
+		// Replaced by a pull of the same tag, only the digest is left
+		{ID: "img-previous", RepoDigests: []string{"ghcr.io/org/runner@" + digest("2")}, Created: now.Add(-48 * time.Hour).Unix(), Size: 500, SharedSize: 400},
+		{ID: "img-old", RepoTags: []string{"<none>:<none>"}, RepoDigests: []string{"ghcr.io/org/runner@" + digest("3")}, Created: now.Add(-72 * time.Hour).Unix(), Size: 300},
+		// Past the retention, but still used by a stopped runner
+		{ID: "img-used", RepoDigests: []string{"ghcr.io/org/other@" + digest("4")}, Created: now.Add(-60 * 24 * time.Hour).Unix(), Size: 700},
+		{ID: "img-newest", RepoTags: []string{"ghcr.io/org/other:v2"}, Created: now.Add(-2 * time.Hour).Unix(), Size: 200},
+		{ID: "img-expired", RepoTags: []string{"ghcr.io/org/other:v1", "ghcr.io/org/other:stable"}, Created: now.Add(-45 * 24 * time.Hour).Unix(), Size: 200},
+		// A reproducible build, created at the epoch, is still the newest
+		{ID: "img-reproducible", RepoTags: []string{"ghcr.io/org/reproducible:v1"}, Created: 0, Size: 100},
+		// Also tagged in a repository that is not collected
+		{ID: "img-shared", RepoTags: []string{"ghcr.io/org/other:v0", "docker.io/library/ubuntu:22.04"}, Created: now.Add(-90 * 24 * time.Hour).Unix(), Size: 100},
+		{ID: "img-unrelated", RepoTags: []string{"busybox:latest"}, Created: now.Add(-90 * 24 * time.Hour).Unix(), Size: 100},
+	}
+	opts := ImageGCOptions{Images: []string{"ghcr.io/org/*"}, Retention: 24 * time.Hour, KeepDigests: 1}
+
+	newProvider := func() (*Provider, *MockDockerClient) {
+		mockClient := new(MockDockerClient)
+		mockClient.On("ImageList", mock.Anything, types.ImageListOptions{SharedSize: true}).Return(images, nil)
+		mockClient.On("ContainerList", mock.Anything, types.ContainerListOptions{All: true}).Return([]types.Container{
+			{ID: "runner-1", ImageID: "img-current"},
+			{ID: "runner-2", ImageID: "img-used"},
+		}, nil)
+		return &Provider{Config: &config.ProviderConfig{}, DockerClient: mockClient}, mockClient
+	}
+	status := func(report ImageGCReport) map[string]string {
+		result := map[string]string{}
+		for _, img := range report.Images {
+			result[img.ID] = img.Reason
+			if img.InUse {
+				result[img.ID] = "in use"
+			}
+		}
+		return result
+	}
+	wantStatus := map[string]string{
+		"img-current":      "in use",
+		"img-recent":       "",
+		"img-previous":     "created more than 24h0m0s ago",
+		"img-old":          "created more than 24h0m0s ago",
+		"img-used":         "in use",
+		"img-newest":       "",
+		"img-expired":      "created more than 24h0m0s ago",
+		"img-reproducible": "",
+	}
+
+	t.Run("dry run", func(t *testing.T) {
+		t.Parallel()
+		p, mockClient := newProvider()
+		dryRun := opts
+		dryRun.DryRun = true
+		report, err := p.CollectImages(context.Background(), dryRun)
+		require.NoError(t, err)
+		assert.Equal(t, wantStatus, status(report))
+		assert.Equal(t, int64(600), report.Reclaimed)
+		assert.Equal(t, []string{"img-newest", "img-expired", "img-used", "img-reproducible", "img-current", "img-recent", "img-previous", "img-old"}, func() []string {
+			var ids []string
+			for _, img := range report.Images {
+				ids = append(ids, img.ID)
+			}
+			return ids
+		}())
+		mockClient.AssertExpectations(t)
+	})
+
+	t.Run("keep digests only", func(t *testing.T) {
+		t.Parallel()
+		p, _ := newProvider()
+		keepOnly := opts
+		keepOnly.Retention = 0
+		keepOnly.DryRun = true
+		report, err := p.CollectImages(context.Background(), keepOnly)
+		require.NoError(t, err)
+		assert.Equal(t, "older than the 1 newest images", status(report)["img-recent"])
+		assert.Equal(t, "", status(report)["img-reproducible"])
+	})
+
+	t.Run("remove", func(t *testing.T) {
+		t.Parallel()
+		p, mockClient := newProvider()
+		ancestor := func(id string) any {
+			return mock.MatchedBy(func(opts types.ContainerListOptions) bool { return opts.Filters.ExactMatch("ancestor", id) })
+		}
+		mockClient.On("ContainerList", mock.Anything, ancestor("img-expired")).Return([]types.Container{{ID: "foreign", ImageID: "img-expired"}}, nil)
+		mockClient.On("ContainerList", mock.Anything, ancestor("img-previous")).Return([]types.Container{}, nil)
+		mockClient.On("ContainerList", mock.Anything, ancestor("img-old")).Return([]types.Container{}, nil)
+		mockClient.On("DiskUsage", mock.Anything, mock.Anything).Return(types.DiskUsage{LayersSize: 5000}, nil).Once()
+		mockClient.On("DiskUsage", mock.Anything, mock.Anything).Return(types.DiskUsage{LayersSize: 4600}, nil).Once()
+		mockClient.On("ImageRemove", mock.Anything, "ghcr.io/org/runner@"+digest("2"), types.ImageRemoveOptions{PruneChildren: true}).Return([]types.ImageDeleteResponseItem{{Deleted: "img-previous"}}, nil)
+		mockClient.On("ImageRemove", mock.Anything, "ghcr.io/org/runner@"+digest("3"), types.ImageRemoveOptions{PruneChildren: true}).Return([]types.ImageDeleteResponseItem{{Deleted: "img-old"}}, nil)
+
+		report, err := p.CollectImages(context.Background(), opts)
+		require.NoError(t, err)
+		assert.Equal(t, int64(400), report.Reclaimed)
+		for _, img := range report.Images {
+			switch img.ID {
+			case "img-previous", "img-old":
+				assert.True(t, img.Removed)
+			case "img-expired":
+				// None of its tags are removed
+				assert.False(t, img.Removed)
+				assert.Contains(t, img.Error, "in use by container foreign")
+			default:
+				assert.False(t, img.Removed, img.ID)
+			}
+		}
+		mockClient.AssertExpectations(t)
+		mockClient.AssertNotCalled(t, "ImageRemove", mock.Anything, "ghcr.io/org/other:v1", mock.Anything)
+	})
+
+	t.Run("locks images", func(t *testing.T) {
+		t.Parallel()
+		p, _ := newProvider()
+		lockPath := filepath.Join(t.TempDir(), "images.lock")
+		unlock, err := filelock.LockShared(lockPath)
+		require.NoError(t, err)
+
+		locked := opts
+		locked.LockPath = lockPath
+		locked.DryRun = true
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			_, err := p.CollectImages(context.Background(), locked)
+			assert.NoError(t, err)
+		}()
+
+		select {
+		case <-done:
+			t.Fatal("pass ran while a create held the lock")
+		case <-time.After(100 * time.Millisecond):
+		}
+		unlock()
+		<-done
+	})
+}
+
+func TestCreateInstanceCollectsImagesAfterPull(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config: &config.ProviderConfig{
+			DinDMode:   config.DinDModeNone,
+			AlwaysPull: true,
+			ImageGC: config.ImageGCConfig{
+				Images:      []string{"docker.io/library/ubuntu"},
+				KeepDigests: 1,
+				AfterPull:   true,
+				LockPath:    filepath.Join(t.TempDir(), "images.lock"),
+			},
+		},
+		DockerClient: mockClient,
+	}
+
+	mockClient.On("ImagePull", mock.Anything, "ubuntu:22.04", mock.Anything).Return(io.NopCloser(strings.NewReader("")), nil)
+	mockClient.On("ContainerCreate", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, "test-runner").Return(container.CreateResponse{ID: "container-id"}, nil)
+	mockClient.On("ContainerStart", mock.Anything, "container-id", mock.Anything).Return(nil)
+	mockClient.On("ContainerInspect", mock.Anything, "container-id").Return(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "container-id", Image: "img-new"},
+	}, nil)
+	mockClient.On("ImageList", mock.Anything, mock.Anything).Return([]types.ImageSummary{
+		{ID: "img-new", RepoTags: []string{"ubuntu:22.04"}, Created: time.Now().Unix()},
+		{ID: "img-old", RepoDigests: []string{"ubuntu@sha256:" + strings.Repeat("a", 64)}, Created: time.Now().Add(-time.Hour).Unix()},
+	}, nil)
+	mockClient.On("ContainerList", mock.Anything, mock.MatchedBy(func(opts types.ContainerListOptions) bool {
+		return opts.Filters.Contains("ancestor")
+	})).Return([]types.Container{}, nil)
+	mockClient.On("ContainerList", mock.Anything, mock.Anything).Return([]types.Container{{ID: "container-id", ImageID: "img-new"}}, nil)
+	mockClient.On("DiskUsage", mock.Anything, mock.Anything).Return(types.DiskUsage{}, nil)
+	mockClient.On("ImageRemove", mock.Anything, "ubuntu@sha256:"+strings.Repeat("a", 64), mock.Anything).Return([]types.ImageDeleteResponseItem{}, nil)
+
+	_, err := p.CreateInstance(context.Background(), params.BootstrapInstance{
+		Name:    "test-runner",
+		Image:   "ubuntu:22.04",
+		RepoURL: "https://github.com/org/repo",
+	})
+	require.NoError(t, err)
+	mockClient.AssertExpectations(t)
+}
+
+func TestCheckController(t *testing.T) {
+	t.Parallel()
+	mockClient := new(MockDockerClient)
+	p := &Provider{
+		ControllerID: "test-controller",
+		Config:       &config.ProviderConfig{},
+		DockerClient: mockClient,
+	}
+
+	inspect := func(labels map[string]string) types.ContainerJSON {
+		return types.ContainerJSON{
+			ContainerJSONBase: &types.ContainerJSONBase{ID: "id"},
+			Config:            &container.Config{Labels: labels},
+		}
+	}
+	mockClient.On("ContainerInspect", mock.Anything, "runner").Return(inspect(map[string]string{spec.GarmControllerIDLabel: "test-controller"}), nil)
+	mockClient.On("ContainerInspect", mock.Anything, "other-runner").Return(inspect(map[string]string{spec.GarmControllerIDLabel: "other-controller"}), nil)
+	mockClient.On("ContainerInspect", mock.Anything, "sidecar").Return(inspect(map[string]string{spec.GarmControllerIDLabel: "test-controller", spec.GarmRoleLabel: spec.RoleSocketProxy}), nil)
+	mockClient.On("ContainerInspect", mock.Anything, "unrelated").Return(inspect(nil), nil)
+
+	assert.NoError(t, p.CheckController(context.Background(), "runner"))
+	assert.ErrorContains(t, p.CheckController(context.Background(), "other-runner"), `belongs to controller "other-controller"`)
+	assert.ErrorContains(t, p.CheckController(context.Background(), "sidecar"), "not a garm runner")
+	assert.ErrorContains(t, p.CheckController(context.Background(), "unrelated"), "not a garm runner")
 }
@@ -0,0 +1,109 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// readinessPollInterval is how often the runner is checked while waiting for
+// it to become ready.
+var readinessPollInterval = time.Second
+
+// waitReady waits until a started runner passes the configured readiness
+// check. If it doesn't within the timeout, the error includes the last lines
+// of its logs.
+func (p *Provider) waitReady(ctx context.Context, containerID string) error {
+	cfg := p.Config.Readiness
+	if err := p.checkReady(ctx, containerID, cfg); err != nil {
+		// Runner containers are created without a TTY
+		logs, logErr := p.containerLogs(ctx, containerID, false, types.ContainerLogsOptions{Tail: strconv.Itoa(cfg.LogTail)})
+		if logErr != nil || len(logs) == 0 {
+			return err
+		}
+		return fmt.Errorf("%w, last logs:\n%s", err, strings.TrimRight(string(logs), "\n"))
+	}
+	return nil
+}
+
+func (p *Provider) checkReady(ctx context.Context, containerID string, cfg config.ReadinessConfig) error {
+	var pattern *regexp.Regexp
+	if cfg.LogPattern != "" {
+		var err error
+		if pattern, err = regexp.Compile(cfg.LogPattern); err != nil {
+			return fmt.Errorf("invalid readiness log_pattern: %w", err)
+		}
+	}
+
+	checkCtx, cancel := context.WithTimeout(ctx, cfg.Timeout)
+	defer cancel()
+	settled := time.Now().Add(cfg.SettlePeriod)
+	ticker := time.NewTicker(readinessPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ready, err := p.isReady(checkCtx, containerID, settled, cfg.WaitHealthy, pattern)
+		if err != nil {
+			if checkCtx.Err() == nil || ctx.Err() != nil {
+				return err
+			}
+		} else if ready {
+			return nil
+		}
+
+		select {
+		case <-checkCtx.Done():
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("runner not ready after %s", cfg.Timeout)
+		case <-ticker.C:
+		}
+	}
+}
+
+// isReady checks the runner once. It returns an error if the runner can't
+// become ready anymore.
+func (p *Provider) isReady(ctx context.Context, containerID string, settled time.Time, waitHealthy bool, pattern *regexp.Regexp) (bool, error) {
+	inspect, err := p.inspectState(ctx, containerID)
+	if err != nil {
+		return false, err
+	}
+	state := inspect.State
+	if !state.Running {
+		return false, fmt.Errorf("runner exited with code %d", state.ExitCode)
+	}
+	if time.Now().Before(settled) {
+		return false, nil
+	}
+
+	if waitHealthy {
+		if state.Health == nil {
+			return false, fmt.Errorf("runner has no healthcheck to wait for")
+		}
+		switch state.Health.Status {
+		case types.Healthy:
+		case types.Unhealthy:
+			return false, fmt.Errorf("runner is unhealthy")
+		default:
+			return false, nil
+		}
+	}
+
+	if pattern != nil {
+		logs, err := p.containerLogs(ctx, containerID, inspect.Config != nil && inspect.Config.Tty, types.ContainerLogsOptions{Tail: "all"})
+		if err != nil {
+			return false, err
+		}
+		if !pattern.Match(logs) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
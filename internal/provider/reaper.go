@@ -0,0 +1,312 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
+	"github.com/mercedes-benz/garm-provider-docker/internal/audit"
+	"github.com/mercedes-benz/garm-provider-docker/internal/spec"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// ReapOptions controls a reaper pass.
+type ReapOptions struct {
+	// ExitedGracePeriod is how long exited runners are kept.
+	ExitedGracePeriod time.Duration
+	// RegistrationTimeout is how long a runner may take to register.
+	// 0 disables the check.
+	RegistrationTimeout time.Duration
+	// RegisteredPattern matches the log line of a registered runner.
+	RegisteredPattern *regexp.Regexp
+	// DryRun only reports what would be removed.
+	DryRun bool
+}
+
+// ReapOptionsFromConfig returns the reaper options from the provider config.
+func ReapOptionsFromConfig(cfg *config.ProviderConfig) (ReapOptions, error) {
+	pattern, err := regexp.Compile(cfg.Reaper.RegisteredPattern)
+	if err != nil {
+		return ReapOptions{}, fmt.Errorf("invalid registered_pattern: %w", err)
+	}
+	return ReapOptions{
+		ExitedGracePeriod:   cfg.Reaper.ExitedGracePeriod,
+		RegistrationTimeout: cfg.Reaper.RegistrationTimeout,
+		RegisteredPattern:   pattern,
+	}, nil
+}
+
+// ReapResult describes a runner container selected by the reaper.
+type ReapResult struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	PoolID  string `json:"pool_id"`
+	State   string `json:"state"`
+	Reason  string `json:"reason"`
+	Removed bool   `json:"removed"`
+	Error   string `json:"error,omitempty"`
+}
+
+// Reap removes ephemeral runner containers that exited more than the grace
+// period ago, unless Garm stopped them or Docker restarts them, and runners
+// that never registered within the registration timeout. If the provider
+// has no controller ID, runners of all controllers are considered.
+func (p *Provider) Reap(ctx context.Context, opts ReapOptions) ([]ReapResult, error) {
+	filtersArgs := filters.NewArgs()
+	if p.ControllerID != "" {
+		filtersArgs.Add("label", fmt.Sprintf("%s=%s", spec.GarmControllerIDLabel, p.ControllerID))
+	} else {
+		filtersArgs.Add("label", spec.GarmControllerIDLabel)
+	}
+
+	containers, err := p.DockerClient.ContainerList(ctx, types.ContainerListOptions{
+		Filters: filtersArgs,
+		All:     true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %w", err)
+	}
+
+	results := []ReapResult{}
+	for _, c := range containers {
+		if !isRunner(c.Labels) {
+			continue
+		}
+
+		reason, err := p.reapReason(ctx, c, opts)
+		if err != nil {
+			slog.Error("failed to check container", "id", c.ID, "error", err)
+			continue
+		}
+		if reason == "" {
+			continue
+		}
+
+		result := ReapResult{
+			ID:     c.ID,
+			Name:   c.Labels[spec.GarmInstanceNameLabel],
+			PoolID: c.Labels[spec.GarmPoolIDLabel],
+			State:  c.State,
+			Reason: reason,
+		}
+		if !opts.DryRun {
+			if err := p.reap(ctx, c); err != nil {
+				result.Error = err.Error()
+			} else {
+				result.Removed = true
+			}
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// reapReason returns why a container should be reaped, or an empty string
+// if it should be kept.
+func (p *Provider) reapReason(ctx context.Context, c types.Container, opts ReapOptions) (string, error) {
+	if c.State != "exited" && c.State != "dead" {
+		if maxLifetime, exceeded := spec.LifetimeExceeded(c.Labels, time.Unix(c.Created, 0)); exceeded {
+			return fmt.Sprintf("exceeded max lifetime of %s", maxLifetime), nil
+		}
+	}
+
+	switch c.State {
+	case "exited", "dead":
+		// Non-ephemeral runners exit when Garm stops them and are started
+		// again later. Runners created before the ephemeral label have it
+		// missing and are kept too.
+		if c.Labels[spec.GarmEphemeralLabel] != "true" {
+			return "", nil
+		}
+		inspect, err := p.inspectState(ctx, c.ID)
+		if err != nil {
+			return "", err
+		}
+		if willRestart(inspect) {
+			return "", nil
+		}
+		stopped, err := p.stoppedByGarm(ctx, c.Labels)
+		if err != nil {
+			return "", err
+		}
+		if stopped {
+			return "", nil
+		}
+		finishedAt, err := time.Parse(time.RFC3339Nano, inspect.State.FinishedAt)
+		if err != nil {
+			return "", fmt.Errorf("invalid finish time %q: %w", inspect.State.FinishedAt, err)
+		}
+		if age := time.Since(finishedAt); age > opts.ExitedGracePeriod {
+			return fmt.Sprintf("exited %s ago", age.Round(time.Second)), nil
+		}
+	case "created":
+		if opts.RegistrationTimeout == 0 {
+			return "", nil
+		}
+		if age := time.Since(time.Unix(c.Created, 0)); age > opts.RegistrationTimeout {
+			return fmt.Sprintf("never started, created %s ago", age.Round(time.Second)), nil
+		}
+	case "running":
+		if opts.RegistrationTimeout == 0 || opts.RegisteredPattern == nil {
+			return "", nil
+		}
+		inspect, err := p.inspectState(ctx, c.ID)
+		if err != nil {
+			return "", err
+		}
+		startedAt, err := time.Parse(time.RFC3339Nano, inspect.State.StartedAt)
+		if err != nil {
+			return "", fmt.Errorf("invalid start time %q: %w", inspect.State.StartedAt, err)
+		}
+		age := time.Since(startedAt)
+		if age <= opts.RegistrationTimeout {
+			return "", nil
+		}
+		// Only the logs of the registration window are read, not everything
+		// a long-running runner has logged since
+		logs, err := p.containerLogs(ctx, c.ID, inspect.Config != nil && inspect.Config.Tty, types.ContainerLogsOptions{
+			Since: startedAt.Format(time.RFC3339Nano),
+			Until: startedAt.Add(opts.RegistrationTimeout).Format(time.RFC3339Nano),
+		})
+		if err != nil {
+			return "", err
+		}
+		if !opts.RegisteredPattern.Match(logs) {
+			return fmt.Sprintf("not registered %s after start", age.Round(time.Second)), nil
+		}
+	}
+	return "", nil
+}
+
+// willRestart reports whether Docker brings an exited container back by its
+// restart policy.
+func willRestart(inspect types.ContainerJSON) bool {
+	if inspect.State.Restarting {
+		return true
+	}
+	if inspect.HostConfig == nil {
+		return false
+	}
+	policy := inspect.HostConfig.RestartPolicy
+	switch {
+	case policy.IsAlways(), policy.IsUnlessStopped():
+		return true
+	case policy.IsOnFailure():
+		return inspect.State.ExitCode != 0 &&
+			(policy.MaximumRetryCount == 0 || inspect.RestartCount < policy.MaximumRetryCount)
+	}
+	return false
+}
+
+// stopMarkerName returns the name of the volume that records that Garm
+// stopped the given runner.
+func stopMarkerName(instanceName string) string {
+	return instanceName + "-garm-stopped"
+}
+
+// markStopped records that Garm stopped a runner, so the reaper leaves it
+// alone until Garm starts or deletes it. The marker carries the runner's
+// labels, so DeleteInstance and gc remove it with the runner.
+func (p *Provider) markStopped(ctx context.Context, inspect types.ContainerJSON) error {
+	if inspect.Config == nil || inspect.Config.Labels[spec.GarmInstanceNameLabel] == "" {
+		return nil
+	}
+	labels := map[string]string{spec.GarmRoleLabel: spec.RoleStopMarker}
+	for _, key := range []string{spec.GarmControllerIDLabel, spec.GarmInstanceNameLabel, spec.GarmPoolIDLabel} {
+		labels[key] = inspect.Config.Labels[key]
+	}
+	_, err := p.DockerClient.VolumeCreate(ctx, volume.CreateOptions{
+		Name:   stopMarkerName(labels[spec.GarmInstanceNameLabel]),
+		Labels: labels,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create stop marker: %w", err)
+	}
+	return nil
+}
+
+// clearStopped removes the stop marker of a runner Garm started again.
+func (p *Provider) clearStopped(ctx context.Context, instance string) error {
+	inspect, err := p.DockerClient.ContainerInspect(ctx, instance)
+	if err != nil {
+		return fmt.Errorf("failed to inspect container %s: %w", instance, err)
+	}
+	if inspect.Config == nil || inspect.Config.Labels[spec.GarmInstanceNameLabel] == "" {
+		return nil
+	}
+	name := stopMarkerName(inspect.Config.Labels[spec.GarmInstanceNameLabel])
+	if err := p.DockerClient.VolumeRemove(ctx, name, true); err != nil && !client.IsErrNotFound(err) {
+		return fmt.Errorf("failed to remove stop marker %s: %w", name, err)
+	}
+	return nil
+}
+
+// stoppedByGarm reports whether the runner with the given labels has a stop
+// marker.
+func (p *Provider) stoppedByGarm(ctx context.Context, labels map[string]string) (bool, error) {
+	filtersArgs := filters.NewArgs(
+		filters.Arg("label", fmt.Sprintf("%s=%s", spec.GarmRoleLabel, spec.RoleStopMarker)),
+		filters.Arg("label", fmt.Sprintf("%s=%s", spec.GarmControllerIDLabel, labels[spec.GarmControllerIDLabel])),
+		filters.Arg("label", fmt.Sprintf("%s=%s", spec.GarmInstanceNameLabel, labels[spec.GarmInstanceNameLabel])),
+	)
+	volumes, err := p.DockerClient.VolumeList(ctx, volume.ListOptions{Filters: filtersArgs})
+	if err != nil {
+		return false, fmt.Errorf("failed to list stop markers: %w", err)
+	}
+	return len(volumes.Volumes) > 0, nil
+}
+
+// inspectState inspects a container and makes sure its state is set.
+func (p *Provider) inspectState(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	inspect, err := p.DockerClient.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return types.ContainerJSON{}, fmt.Errorf("failed to inspect container: %w", err)
+	}
+	if inspect.ContainerJSONBase == nil || inspect.State == nil {
+		return types.ContainerJSON{}, fmt.Errorf("container %s has no state", containerID)
+	}
+	return inspect, nil
+}
+
+// reap removes a runner through the same path as DeleteInstance, so that its
+// hooks run, its logs are archived and the removal is audited.
+func (p *Provider) reap(ctx context.Context, c types.Container) error {
+	if err := p.deleteInstance(ctx, audit.ActionReap, c.Labels[spec.GarmControllerIDLabel], c.ID); err != nil {
+		return err
+	}
+	slog.Info("reaped runner container", "id", c.ID, "name", c.Labels[spec.GarmInstanceNameLabel])
+	return nil
+}
+
+// containerLogs returns the combined stdout and stderr of a container,
+// limited by the Tail, Since and Until of opts.
+func (p *Provider) containerLogs(ctx context.Context, containerID string, tty bool, opts types.ContainerLogsOptions) ([]byte, error) {
+	opts.ShowStdout = true
+	opts.ShowStderr = true
+	reader, err := p.DockerClient.ContainerLogs(ctx, containerID, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get logs of container %s: %w", containerID, err)
+	}
+	defer reader.Close()
+
+	var buf bytes.Buffer
+	if tty {
+		_, err = io.Copy(&buf, reader)
+	} else {
+		// Without a TTY, stdout and stderr are multiplexed
+		_, err = stdcopy.StdCopy(&buf, &buf, reader)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read logs of container %s: %w", containerID, err)
+	}
+	return buf.Bytes(), nil
+}
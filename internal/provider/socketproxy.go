@@ -0,0 +1,74 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/mercedes-benz/garm-provider-docker/internal/dind"
+	"github.com/mercedes-benz/garm-provider-docker/internal/spec"
+)
+
+// startSocketProxy creates the socket volume and starts the Docker socket
+// proxy sidecar for a runner. The sidecar and volume carry the runner's
+// labels, so DeleteInstance can find and remove them.
+func (p *Provider) startSocketProxy(ctx context.Context, bootstrapParams params.BootstrapInstance) error {
+	proxyCfg := p.Config.SocketProxy
+	name := dind.SocketProxyName(bootstrapParams.Name)
+
+	labels := spec.GetContainerLabels(p.ControllerID, bootstrapParams)
+	labels[spec.GarmRoleLabel] = spec.RoleSocketProxy
+
+	image := p.Config.MirrorImage(proxyCfg.Image)
+	if _, err := p.ensureImage(ctx, image); err != nil {
+		return err
+	}
+
+	if _, err := p.DockerClient.VolumeCreate(ctx, volume.CreateOptions{
+		Name:   name,
+		Labels: labels,
+	}); err != nil {
+		return fmt.Errorf("failed to create socket proxy volume: %w", err)
+	}
+
+	cmd := []string{
+		"socket-proxy",
+		"--listen", dind.SocketProxyDir + "/docker.sock",
+		"--upstream", "/var/run/docker.sock",
+		"--owner", bootstrapParams.Name,
+	}
+	for _, rule := range proxyCfg.AllowedEndpoints {
+		cmd = append(cmd, "--allow", rule)
+	}
+
+	resp, err := p.DockerClient.ContainerCreate(ctx, &container.Config{
+		Image:  image,
+		Cmd:    cmd,
+		Labels: labels,
+	}, &container.HostConfig{
+		Binds: []string{p.Config.DockerSocketPath + ":/var/run/docker.sock"},
+		Mounts: []mount.Mount{
+			{
+				Type:   mount.TypeVolume,
+				Source: name,
+				Target: dind.SocketProxyDir,
+			},
+		},
+		NetworkMode:   "none",
+		RestartPolicy: container.RestartPolicy{Name: "unless-stopped"},
+	}, nil, nil, name)
+	if err != nil {
+		return fmt.Errorf("failed to create socket proxy container: %w", err)
+	}
+
+	if err := p.DockerClient.ContainerStart(ctx, resp.ID, types.ContainerStartOptions{}); err != nil {
+		return fmt.Errorf("failed to start socket proxy container: %w", err)
+	}
+	slog.Info("started docker socket proxy", "name", name, "runner", bootstrapParams.Name)
+	return nil
+}
@@ -0,0 +1,255 @@
+package provider
+
+import (
+	"context"
+	"io"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/mercedes-benz/garm-provider-docker/internal/tracing"
+	v1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracedClient wraps a DockerClient with a span around each call.
+type tracedClient struct {
+	client DockerClient
+}
+
+// newTracedClient returns a DockerClient that traces every call of c.
+func newTracedClient(c DockerClient) DockerClient {
+	return &tracedClient{client: c}
+}
+
+func startSpan(ctx context.Context, method string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracing.Tracer().Start(ctx, "docker."+method,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// spanReader ends its span when the streamed response is closed, so that
+// the span covers the whole transfer and not just the request.
+type spanReader struct {
+	io.ReadCloser
+	span trace.Span
+	err  error
+}
+
+func (r *spanReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		r.err = err
+	}
+	return n, err
+}
+
+func (r *spanReader) Close() error {
+	err := r.ReadCloser.Close()
+	endSpan(r.span, r.err)
+	return err
+}
+
+func containerAttr(id string) attribute.KeyValue {
+	return attribute.String("docker.container", id)
+}
+
+func (t *tracedClient) ImagePull(ctx context.Context, ref string, options types.ImagePullOptions) (io.ReadCloser, error) {
+	ctx, span := startSpan(ctx, "ImagePull", attribute.String("docker.image", ref))
+	rc, err := t.client.ImagePull(ctx, ref, options)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	return &spanReader{ReadCloser: rc, span: span}, nil
+}
+
+func (t *tracedClient) ImageInspectWithRaw(ctx context.Context, imageID string) (types.ImageInspect, []byte, error) {
+	ctx, span := startSpan(ctx, "ImageInspectWithRaw", attribute.String("docker.image", imageID))
+	inspect, raw, err := t.client.ImageInspectWithRaw(ctx, imageID)
+	endSpan(span, err)
+	return inspect, raw, err
+}
+
+func (t *tracedClient) ImageList(ctx context.Context, options types.ImageListOptions) ([]types.ImageSummary, error) {
+	ctx, span := startSpan(ctx, "ImageList")
+	images, err := t.client.ImageList(ctx, options)
+	endSpan(span, err)
+	return images, err
+}
+
+func (t *tracedClient) ImageRemove(ctx context.Context, imageID string, options types.ImageRemoveOptions) ([]types.ImageDeleteResponseItem, error) {
+	ctx, span := startSpan(ctx, "ImageRemove", attribute.String("docker.image", imageID))
+	resp, err := t.client.ImageRemove(ctx, imageID, options)
+	endSpan(span, err)
+	return resp, err
+}
+
+func (t *tracedClient) ContainerCreate(ctx context.Context, config *container.Config, hostConfig *container.HostConfig, networkingConfig *network.NetworkingConfig, platform *v1.Platform, containerName string) (container.CreateResponse, error) {
+	ctx, span := startSpan(ctx, "ContainerCreate", attribute.String("docker.container.name", containerName))
+	resp, err := t.client.ContainerCreate(ctx, config, hostConfig, networkingConfig, platform, containerName)
+	span.SetAttributes(containerAttr(resp.ID))
+	endSpan(span, err)
+	return resp, err
+}
+
+func (t *tracedClient) ContainerStart(ctx context.Context, containerID string, options types.ContainerStartOptions) error {
+	ctx, span := startSpan(ctx, "ContainerStart", containerAttr(containerID))
+	err := t.client.ContainerStart(ctx, containerID, options)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedClient) ContainerRemove(ctx context.Context, containerID string, options types.ContainerRemoveOptions) error {
+	ctx, span := startSpan(ctx, "ContainerRemove", containerAttr(containerID))
+	err := t.client.ContainerRemove(ctx, containerID, options)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedClient) ContainerInspect(ctx context.Context, containerID string) (types.ContainerJSON, error) {
+	ctx, span := startSpan(ctx, "ContainerInspect", containerAttr(containerID))
+	inspect, err := t.client.ContainerInspect(ctx, containerID)
+	endSpan(span, err)
+	return inspect, err
+}
+
+func (t *tracedClient) ContainerList(ctx context.Context, options types.ContainerListOptions) ([]types.Container, error) {
+	ctx, span := startSpan(ctx, "ContainerList")
+	containers, err := t.client.ContainerList(ctx, options)
+	span.SetAttributes(attribute.Int("docker.containers", len(containers)))
+	endSpan(span, err)
+	return containers, err
+}
+
+func (t *tracedClient) ContainerStop(ctx context.Context, containerID string, options container.StopOptions) error {
+	ctx, span := startSpan(ctx, "ContainerStop", containerAttr(containerID))
+	err := t.client.ContainerStop(ctx, containerID, options)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedClient) ContainerKill(ctx context.Context, containerID, signal string) error {
+	ctx, span := startSpan(ctx, "ContainerKill", containerAttr(containerID), attribute.String("docker.signal", signal))
+	err := t.client.ContainerKill(ctx, containerID, signal)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedClient) ContainerExecCreate(ctx context.Context, containerID string, config types.ExecConfig) (types.IDResponse, error) {
+	ctx, span := startSpan(ctx, "ContainerExecCreate", containerAttr(containerID))
+	resp, err := t.client.ContainerExecCreate(ctx, containerID, config)
+	endSpan(span, err)
+	return resp, err
+}
+
+func (t *tracedClient) ContainerExecStart(ctx context.Context, execID string, config types.ExecStartCheck) error {
+	ctx, span := startSpan(ctx, "ContainerExecStart", attribute.String("docker.exec", execID))
+	err := t.client.ContainerExecStart(ctx, execID, config)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedClient) ContainerExecInspect(ctx context.Context, execID string) (types.ContainerExecInspect, error) {
+	ctx, span := startSpan(ctx, "ContainerExecInspect", attribute.String("docker.exec", execID))
+	inspect, err := t.client.ContainerExecInspect(ctx, execID)
+	endSpan(span, err)
+	return inspect, err
+}
+
+func (t *tracedClient) ContainerLogs(ctx context.Context, containerID string, options types.ContainerLogsOptions) (io.ReadCloser, error) {
+	ctx, span := startSpan(ctx, "ContainerLogs", containerAttr(containerID))
+	rc, err := t.client.ContainerLogs(ctx, containerID, options)
+	if err != nil {
+		endSpan(span, err)
+		return nil, err
+	}
+	return &spanReader{ReadCloser: rc, span: span}, nil
+}
+
+func (t *tracedClient) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.WaitResponse, <-chan error) {
+	// The span only covers the call, the wait itself happens on the channels
+	ctx, span := startSpan(ctx, "ContainerWait", containerAttr(containerID))
+	defer span.End()
+	return t.client.ContainerWait(ctx, containerID, condition)
+}
+
+func (t *tracedClient) CopyToContainer(ctx context.Context, containerID, dstPath string, content io.Reader, options types.CopyToContainerOptions) error {
+	ctx, span := startSpan(ctx, "CopyToContainer", containerAttr(containerID), attribute.String("docker.path", dstPath))
+	err := t.client.CopyToContainer(ctx, containerID, dstPath, content, options)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedClient) CopyFromContainer(ctx context.Context, containerID, srcPath string) (io.ReadCloser, types.ContainerPathStat, error) {
+	ctx, span := startSpan(ctx, "CopyFromContainer", containerAttr(containerID), attribute.String("docker.path", srcPath))
+	content, stat, err := t.client.CopyFromContainer(ctx, containerID, srcPath)
+	endSpan(span, err)
+	return content, stat, err
+}
+
+func (t *tracedClient) NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error) {
+	ctx, span := startSpan(ctx, "NetworkList")
+	networks, err := t.client.NetworkList(ctx, options)
+	endSpan(span, err)
+	return networks, err
+}
+
+func (t *tracedClient) NetworkRemove(ctx context.Context, networkID string) error {
+	ctx, span := startSpan(ctx, "NetworkRemove", attribute.String("docker.network", networkID))
+	err := t.client.NetworkRemove(ctx, networkID)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedClient) VolumeCreate(ctx context.Context, options volume.CreateOptions) (volume.Volume, error) {
+	ctx, span := startSpan(ctx, "VolumeCreate", attribute.String("docker.volume", options.Name))
+	v, err := t.client.VolumeCreate(ctx, options)
+	endSpan(span, err)
+	return v, err
+}
+
+func (t *tracedClient) VolumeList(ctx context.Context, options volume.ListOptions) (volume.ListResponse, error) {
+	ctx, span := startSpan(ctx, "VolumeList")
+	volumes, err := t.client.VolumeList(ctx, options)
+	endSpan(span, err)
+	return volumes, err
+}
+
+func (t *tracedClient) VolumeRemove(ctx context.Context, volumeID string, force bool) error {
+	ctx, span := startSpan(ctx, "VolumeRemove", attribute.String("docker.volume", volumeID))
+	err := t.client.VolumeRemove(ctx, volumeID, force)
+	endSpan(span, err)
+	return err
+}
+
+func (t *tracedClient) Info(ctx context.Context) (types.Info, error) {
+	ctx, span := startSpan(ctx, "Info")
+	info, err := t.client.Info(ctx)
+	endSpan(span, err)
+	return info, err
+}
+
+func (t *tracedClient) ServerVersion(ctx context.Context) (types.Version, error) {
+	ctx, span := startSpan(ctx, "ServerVersion")
+	version, err := t.client.ServerVersion(ctx)
+	endSpan(span, err)
+	return version, err
+}
+
+func (t *tracedClient) DiskUsage(ctx context.Context, options types.DiskUsageOptions) (types.DiskUsage, error) {
+	ctx, span := startSpan(ctx, "DiskUsage")
+	usage, err := t.client.DiskUsage(ctx, options)
+	endSpan(span, err)
+	return usage, err
+}
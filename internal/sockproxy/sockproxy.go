@@ -0,0 +1,765 @@
+// Package sockproxy implements a filtering Docker API proxy. It only lets an
+// allow-listed subset of the API through, labels every object created through
+// it with its owner and hides objects that belong to someone else.
+package sockproxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/distribution/reference"
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/mount"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/volume"
+)
+
+// OwnerLabel is forced on every container, volume, network and image built
+// through the proxy.
+const OwnerLabel = "garm.runner/docker-proxy-owner"
+
+// reservedLabelPrefix is the prefix of the labels the provider identifies
+// runners and their resources by.
+const reservedLabelPrefix = "garm.runner/"
+
+// DefaultRules is the subset of the Docker API needed to build images and run
+// containers for a job. BuildKit's /session and /grpc endpoints are left out:
+// they tunnel a gRPC connection the proxy can't inspect, through which a job
+// could tag any image or run build steps on the host network. Builds use the
+// legacy builder instead.
+var DefaultRules = []string{
+	"GET /_ping",
+	"HEAD /_ping",
+	"GET /version",
+	"GET /info",
+	"POST /build",
+	"GET /images/json",
+	"POST /images/create",
+	"GET /images/.+/json",
+	"GET /images/.+/history",
+	"GET /containers/json",
+	"POST /containers/create",
+	"GET /containers/[^/]+/(json|logs|top|stats|archive)",
+	"HEAD /containers/[^/]+/archive",
+	"PUT /containers/[^/]+/archive",
+	"POST /containers/[^/]+/(start|stop|restart|kill|wait|attach|exec|resize)",
+	"DELETE /containers/[^/]+",
+	"POST /exec/[^/]+/(start|resize)",
+	"GET /exec/[^/]+/json",
+	"GET /volumes",
+	"POST /volumes/create",
+	"GET /volumes/[^/]+",
+	"DELETE /volumes/[^/]+",
+	"GET /networks",
+	"POST /networks/create",
+	"GET /networks/[^/]+",
+	"DELETE /networks/[^/]+",
+	"POST /networks/[^/]+/(connect|disconnect)",
+}
+
+// errNotFound is returned when the daemon doesn't know an inspected object.
+var errNotFound = errors.New("not found")
+
+var (
+	versionPrefix = regexp.MustCompile(`^/v[0-9.]+`)
+	objectPath    = regexp.MustCompile(`^/(containers|volumes|networks|exec)/([^/]+)(/.*)?$`)
+	imagePath     = regexp.MustCompile(`^/images/(.+)/(tag|push)$`)
+	execPath      = regexp.MustCompile(`^/containers/[^/]+/exec$`)
+)
+
+// collectionEndpoints list or create objects instead of addressing a single
+// one. Their ownership is handled by rewrite.
+var collectionEndpoints = map[string]bool{
+	"GET /containers/json":    true,
+	"POST /containers/create": true,
+	"POST /volumes/create":    true,
+	"POST /networks/create":   true,
+}
+
+// Rule allows requests with the given method and a path matching the pattern.
+type Rule struct {
+	Method  string
+	Pattern *regexp.Regexp
+}
+
+// ParseRules parses rules of the form "METHOD /path-regex". The path regex is
+// matched against the whole path, without the API version prefix.
+func ParseRules(rules []string) ([]Rule, error) {
+	parsed := make([]Rule, 0, len(rules))
+	for _, r := range rules {
+		method, pattern, ok := strings.Cut(strings.TrimSpace(r), " ")
+		if !ok {
+			return nil, fmt.Errorf("invalid rule %q, expected \"METHOD /path\"", r)
+		}
+		re, err := regexp.Compile("^" + strings.TrimSpace(pattern) + "$")
+		if err != nil {
+			return nil, fmt.Errorf("invalid rule %q: %w", r, err)
+		}
+		parsed = append(parsed, Rule{Method: strings.ToUpper(method), Pattern: re})
+	}
+	return parsed, nil
+}
+
+// Proxy is an http.Handler that forwards allowed requests to a Docker daemon.
+type Proxy struct {
+	owner    string
+	rules    []Rule
+	upstream *url.URL
+	client   *http.Client
+	proxy    *httputil.ReverseProxy
+}
+
+// New returns a proxy that forwards to the Docker API at upstream using the
+// given transport, on behalf of owner.
+func New(upstream *url.URL, transport http.RoundTripper, owner string, rules []Rule) *Proxy {
+	reverseProxy := httputil.NewSingleHostReverseProxy(upstream)
+	reverseProxy.Transport = transport
+	// Stream logs, attach and events as they come
+	reverseProxy.FlushInterval = -1
+
+	return &Proxy{
+		owner:    owner,
+		rules:    rules,
+		upstream: upstream,
+		client:   &http.Client{Transport: transport},
+		proxy:    reverseProxy,
+	}
+}
+
+// NewUnix returns a proxy that forwards to the Docker daemon listening on the
+// given unix socket.
+func NewUnix(socketPath, owner string, rules []Rule) *Proxy {
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	return New(&url.URL{Scheme: "http", Host: "docker"}, transport, owner, rules)
+}
+
+// ListenAndServe serves the proxy on a unix socket until ctx is done.
+func (p *Proxy) ListenAndServe(ctx context.Context, socketPath string) error {
+	if err := os.Remove(socketPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to remove stale socket %s: %w", socketPath, err)
+	}
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", socketPath, err)
+	}
+	// The runner usually doesn't run as root
+	if err := os.Chmod(socketPath, 0o666); err != nil {
+		listener.Close()
+		return fmt.Errorf("failed to set permissions on %s: %w", socketPath, err)
+	}
+
+	server := &http.Server{Handler: p}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+
+	slog.Info("docker socket proxy listening", "socket", socketPath, "owner", p.owner)
+	if err := server.Serve(listener); err != nil && err != http.ErrServerClosed {
+		return fmt.Errorf("socket proxy failed: %w", err)
+	}
+	return nil
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "")
+
+	if !p.allowed(r.Method, path) {
+		p.deny(w, r, http.StatusForbidden, "endpoint is not allowed by the socket proxy")
+		return
+	}
+
+	if err := p.authorize(r, path); err != nil {
+		p.deny(w, r, http.StatusForbidden, err.Error())
+		return
+	}
+
+	if err := p.rewrite(r, path); err != nil {
+		p.deny(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	p.proxy.ServeHTTP(w, r)
+}
+
+func (p *Proxy) allowed(method, path string) bool {
+	for _, rule := range p.rules {
+		if rule.Method == method && rule.Pattern.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Proxy) deny(w http.ResponseWriter, r *http.Request, status int, message string) {
+	slog.Warn("denied docker api request", "method", r.Method, "path", r.URL.Path, "reason", message)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// authorize makes sure requests for a single object only touch objects owned
+// by this proxy's owner, and that images are only tagged or pushed under the
+// owner's repository prefix.
+func (p *Proxy) authorize(r *http.Request, path string) error {
+	if r.Method == http.MethodPost && path == "/build" {
+		return p.checkImageNames(r.URL.Query()["t"]...)
+	}
+	if r.Method == http.MethodPost && path == "/images/create" {
+		return p.checkImageCreate(r.Context(), r.URL.Query())
+	}
+	if m := imagePath.FindStringSubmatch(path); m != nil && r.Method == http.MethodPost {
+		// Tag and push are not in the default rules, but may be allowed
+		if m[2] == "tag" {
+			return p.checkImageNames(r.URL.Query().Get("repo"))
+		}
+		return p.checkImageNames(m[1])
+	}
+
+	m := objectPath.FindStringSubmatch(path)
+	if m == nil || collectionEndpoints[r.Method+" "+path] {
+		return nil
+	}
+	kind, id := m[1], m[2]
+
+	var err error
+	if kind == "exec" {
+		var execInfo struct {
+			ContainerID string
+		}
+		if err = p.inspect(r.Context(), "/exec/"+id+"/json", &execInfo); err == nil {
+			err = p.checkOwner(r.Context(), "containers", execInfo.ContainerID)
+		}
+	} else {
+		err = p.checkOwner(r.Context(), kind, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	if kind == "networks" && (m[3] == "/connect" || m[3] == "/disconnect") {
+		var body struct {
+			Container string
+		}
+		if err := peekJSON(r, &body); err != nil {
+			return err
+		}
+		return p.checkOwner(r.Context(), "containers", body.Container)
+	}
+	return nil
+}
+
+// ImagePrefix returns the repository prefix the images a proxy's owner tags
+// must have, so a job can't replace the tag of another runner's image.
+func ImagePrefix(owner string) string {
+	// Repository names are lowercase
+	return strings.ToLower(owner) + "/"
+}
+
+func (p *Proxy) checkImageNames(names ...string) error {
+	prefix := ImagePrefix(p.owner)
+	for _, name := range names {
+		if !strings.HasPrefix(name, prefix) {
+			return fmt.Errorf("image %q is not under this runner's prefix %q", name, prefix)
+		}
+	}
+	return nil
+}
+
+// checkImageCreate only lets a job pull images. Importing a tarball with
+// fromSrc, or pulling over a tag that already exists locally, would replace
+// an image that other runners are created from, since the provider uses the
+// local copy of a runner image unless always_pull is set.
+func (p *Proxy) checkImageCreate(ctx context.Context, q url.Values) error {
+	if q.Get("fromSrc") != "" {
+		return fmt.Errorf("importing images is not allowed")
+	}
+	named, err := reference.ParseNormalizedNamed(q.Get("fromImage"))
+	if err != nil {
+		return fmt.Errorf("invalid image %q: %w", q.Get("fromImage"), err)
+	}
+
+	tag := q.Get("tag")
+	if _, pinned := named.(reference.Canonical); pinned || strings.Contains(tag, ":") {
+		// Pulls by digest don't move any tag
+		return nil
+	}
+	if tagged, ok := named.(reference.Tagged); ok && tag == "" {
+		tag = tagged.Tag()
+	}
+	if tag == "" {
+		// Pulling all tags of a repository can overwrite any of them
+		return p.checkImageNames(reference.FamiliarName(named))
+	}
+
+	image := reference.FamiliarName(named) + ":" + tag
+	err = p.inspect(ctx, "/images/"+image+"/json", &struct{}{})
+	if errors.Is(err, errNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return p.checkImageNames(image)
+}
+
+func (p *Proxy) checkOwner(ctx context.Context, kind, id string) error {
+	var labels map[string]string
+	switch kind {
+	case "containers":
+		var c struct {
+			Config struct {
+				Labels map[string]string
+			}
+		}
+		if err := p.inspect(ctx, "/containers/"+id+"/json", &c); err != nil {
+			return err
+		}
+		labels = c.Config.Labels
+	case "volumes", "networks":
+		var obj struct {
+			Labels map[string]string
+		}
+		if err := p.inspect(ctx, "/"+kind+"/"+id, &obj); err != nil {
+			return err
+		}
+		labels = obj.Labels
+	}
+
+	if labels[OwnerLabel] != p.owner {
+		return fmt.Errorf("%s %s is not owned by this runner", strings.TrimSuffix(kind, "s"), id)
+	}
+	return nil
+}
+
+func (p *Proxy) inspect(ctx context.Context, path string, v any) error {
+	u := *p.upstream
+	u.Path = path
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to inspect %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("failed to inspect %s: %w", path, errNotFound)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to inspect %s: status %d", path, resp.StatusCode)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// post sends a JSON request to the daemon on the proxy's own behalf.
+func (p *Proxy) post(ctx context.Context, path string, body any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	u := *p.upstream
+	u.Path = path
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, u.String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to post %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("failed to post %s: status %d", path, resp.StatusCode)
+	}
+	return nil
+}
+
+// rewrite forces the owner label on created objects and scopes listings to
+// objects owned by this proxy's owner. Create requests are decoded into the
+// typed API structs and re-encoded, so the daemon sees exactly the settings
+// that were checked, whatever the case of the JSON keys. Fields the vendored
+// API types don't know are dropped.
+func (p *Proxy) rewrite(r *http.Request, path string) error {
+	switch {
+	case r.Method == http.MethodPost && path == "/containers/create":
+		return rewriteJSON(r, func(body *containerCreateRequest) error {
+			return p.checkContainerCreate(r.Context(), body)
+		})
+	case r.Method == http.MethodPost && path == "/volumes/create":
+		return rewriteJSON(r, func(body *volume.CreateOptions) error {
+			if err := checkVolumeDriver(body.Driver, body.DriverOpts); err != nil {
+				return err
+			}
+			labels, err := p.withOwner(body.Labels)
+			body.Labels = labels
+			return err
+		})
+	case r.Method == http.MethodPost && path == "/networks/create":
+		return rewriteJSON(r, func(body *types.NetworkCreateRequest) error {
+			if err := checkNetworkCreate(body); err != nil {
+				return err
+			}
+			labels, err := p.withOwner(body.Labels)
+			body.Labels = labels
+			return err
+		})
+	case r.Method == http.MethodPost && execPath.MatchString(path):
+		return rewriteJSON(r, func(body *types.ExecConfig) error {
+			if body.Privileged {
+				return fmt.Errorf("privileged exec is not allowed")
+			}
+			return nil
+		})
+	case r.Method == http.MethodPost && path == "/build":
+		q := r.URL.Query()
+		if mode := q.Get("networkmode"); mode == "host" || strings.HasPrefix(mode, "container:") {
+			return fmt.Errorf("build networkmode %q is not allowed", mode)
+		}
+		if q.Get("cgroupparent") != "" {
+			return fmt.Errorf("build cgroupparent is not allowed")
+		}
+		labels := map[string]string{}
+		if raw := q.Get("labels"); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &labels); err != nil {
+				return fmt.Errorf("invalid build labels: %w", err)
+			}
+		}
+		labels, err := p.withOwner(labels)
+		if err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(labels)
+		if err != nil {
+			return err
+		}
+		q.Set("labels", string(encoded))
+		r.URL.RawQuery = q.Encode()
+	case r.Method == http.MethodGet && (path == "/containers/json" || path == "/images/json" || path == "/volumes" || path == "/networks"):
+		q := r.URL.Query()
+		args, err := filters.FromJSON(q.Get("filters"))
+		if err != nil {
+			return fmt.Errorf("invalid filters: %w", err)
+		}
+		args.Add("label", OwnerLabel+"="+p.owner)
+		encoded, err := filters.ToJSON(args)
+		if err != nil {
+			return err
+		}
+		q.Set("filters", encoded)
+		r.URL.RawQuery = q.Encode()
+	}
+	return nil
+}
+
+// containerCreateRequest is the body of POST /containers/create, as sent by
+// the Docker client.
+type containerCreateRequest struct {
+	*container.Config
+	HostConfig       *container.HostConfig
+	NetworkingConfig *network.NetworkingConfig
+}
+
+// checkContainerCreate forces the owner label on a new container and rejects
+// settings that would give a job access to the host or to objects of other
+// runners.
+func (p *Proxy) checkContainerCreate(ctx context.Context, body *containerCreateRequest) error {
+	if body.Config == nil {
+		body.Config = &container.Config{}
+	}
+	labels, err := p.withOwner(body.Labels)
+	if err != nil {
+		return err
+	}
+	body.Labels = labels
+
+	if body.HostConfig != nil {
+		if err := checkHostConfig(body.HostConfig); err != nil {
+			return err
+		}
+		if err := p.checkVolumes(ctx, body.HostConfig); err != nil {
+			return err
+		}
+		if err := p.checkNetwork(ctx, string(body.HostConfig.NetworkMode)); err != nil {
+			return err
+		}
+	}
+	if body.NetworkingConfig != nil {
+		for name := range body.NetworkingConfig.EndpointsConfig {
+			if err := p.checkNetwork(ctx, name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// withOwner sets the owner label on the labels of a new object. Other
+// garm.runner/ labels are rejected, so a job can't create objects the provider
+// takes for runners or their sidecars, or for objects of another runner.
+func (p *Proxy) withOwner(labels map[string]string) (map[string]string, error) {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	for key := range labels {
+		if strings.HasPrefix(key, reservedLabelPrefix) && key != OwnerLabel {
+			return nil, fmt.Errorf("label %q is reserved", key)
+		}
+	}
+	labels[OwnerLabel] = p.owner
+	return labels, nil
+}
+
+// checkHostConfig rejects container settings that would give a job access
+// to the host.
+func checkHostConfig(hostConfig *container.HostConfig) error {
+	if hostConfig.Privileged {
+		return fmt.Errorf("privileged containers are not allowed")
+	}
+	for key, n := range map[string]int{
+		"CapAdd":            len(hostConfig.CapAdd),
+		"Devices":           len(hostConfig.Devices),
+		"DeviceCgroupRules": len(hostConfig.DeviceCgroupRules),
+		"DeviceRequests":    len(hostConfig.DeviceRequests),
+		"VolumesFrom":       len(hostConfig.VolumesFrom),
+		"Links":             len(hostConfig.Links),
+	} {
+		if n > 0 {
+			return fmt.Errorf("%s is not allowed", key)
+		}
+	}
+	for key, mode := range map[string]string{
+		"NetworkMode":  string(hostConfig.NetworkMode),
+		"PidMode":      string(hostConfig.PidMode),
+		"IpcMode":      string(hostConfig.IpcMode),
+		"UTSMode":      string(hostConfig.UTSMode),
+		"UsernsMode":   string(hostConfig.UsernsMode),
+		"CgroupnsMode": string(hostConfig.CgroupnsMode),
+		"Cgroup":       string(hostConfig.Cgroup),
+	} {
+		if mode == "host" || strings.HasPrefix(mode, "container:") {
+			return fmt.Errorf("%s %q is not allowed", key, mode)
+		}
+	}
+	for _, opt := range hostConfig.SecurityOpt {
+		if err := checkSecurityOpt(opt); err != nil {
+			return err
+		}
+	}
+	// An empty list unmasks /proc and /sys paths, so any value is an override
+	if hostConfig.MaskedPaths != nil {
+		return fmt.Errorf("MaskedPaths is not allowed")
+	}
+	if hostConfig.ReadonlyPaths != nil {
+		return fmt.Errorf("ReadonlyPaths is not allowed")
+	}
+	if hostConfig.CgroupParent != "" {
+		return fmt.Errorf("CgroupParent is not allowed")
+	}
+	for _, b := range hostConfig.Binds {
+		if strings.HasPrefix(b, "/") {
+			return fmt.Errorf("bind mounts from the host are not allowed")
+		}
+	}
+	for _, m := range hostConfig.Mounts {
+		switch m.Type {
+		case mount.TypeVolume:
+			if m.VolumeOptions != nil && m.VolumeOptions.DriverConfig != nil {
+				return fmt.Errorf("volume driver options are not allowed")
+			}
+		case mount.TypeTmpfs, "image":
+		case mount.TypeBind:
+			return fmt.Errorf("bind mounts from the host are not allowed")
+		default:
+			return fmt.Errorf("%s mounts are not allowed", m.Type)
+		}
+	}
+	return nil
+}
+
+// seccompProfileName matches the name of a profile known to the daemon, as
+// opposed to an inline JSON profile.
+var seccompProfileName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// checkSecurityOpt rejects security options that disable or replace the
+// daemon's confinement. Options are "key=value", or "key:value" in the
+// deprecated form the daemon still accepts.
+func checkSecurityOpt(opt string) error {
+	key, value, ok := strings.Cut(opt, "=")
+	if !ok {
+		key, value, _ = strings.Cut(opt, ":")
+	}
+	switch key {
+	case "seccomp", "apparmor":
+		// An inline seccomp profile could allow any syscall
+		if value == "unconfined" || !seccompProfileName.MatchString(value) {
+			return fmt.Errorf("security option %s=%q is not allowed, only profile names are", key, value)
+		}
+	case "label":
+		// Labels choosing the SELinux type, like spc_t, are as bad as disable
+		if value == "disable" || strings.HasPrefix(value, "type:") {
+			return fmt.Errorf("security option %q is not allowed", opt)
+		}
+	case "no-new-privileges":
+		if value == "false" {
+			return fmt.Errorf("security option %q is not allowed", opt)
+		}
+	default:
+		return fmt.Errorf("security option %q is not allowed", opt)
+	}
+	return nil
+}
+
+// checkNetworkCreate only allows plain bridge networks. Other drivers, like
+// macvlan and ipvlan, and driver options can attach to host interfaces.
+func checkNetworkCreate(body *types.NetworkCreateRequest) error {
+	if body.Driver != "" && body.Driver != "bridge" {
+		return fmt.Errorf("network driver %q is not allowed", body.Driver)
+	}
+	if len(body.Options) > 0 {
+		return fmt.Errorf("network driver options are not allowed")
+	}
+	if body.ConfigOnly || body.ConfigFrom != nil || body.Ingress {
+		return fmt.Errorf("config-only, config-from and ingress networks are not allowed")
+	}
+	if body.Scope != "" && body.Scope != "local" {
+		return fmt.Errorf("network scope %q is not allowed", body.Scope)
+	}
+	if body.IPAM != nil {
+		if body.IPAM.Driver != "" && body.IPAM.Driver != "default" {
+			return fmt.Errorf("IPAM driver %q is not allowed", body.IPAM.Driver)
+		}
+		if len(body.IPAM.Options) > 0 {
+			return fmt.Errorf("IPAM driver options are not allowed")
+		}
+	}
+	return nil
+}
+
+// checkVolumeDriver rejects volumes with another driver than local, or with
+// driver options, which can turn a local volume into a bind of any host path.
+func checkVolumeDriver(driver string, opts map[string]string) error {
+	if driver != "" && driver != "local" {
+		return fmt.Errorf("volume driver %q is not allowed", driver)
+	}
+	if len(opts) > 0 {
+		return fmt.Errorf("volume driver options are not allowed")
+	}
+	return nil
+}
+
+// checkVolumes makes sure the named volumes a container mounts are owned by
+// this proxy's owner. Volumes that don't exist yet are created with the owner
+// label, instead of letting the daemon create them without it.
+func (p *Proxy) checkVolumes(ctx context.Context, hostConfig *container.HostConfig) error {
+	var names []string
+	for _, b := range hostConfig.Binds {
+		// A bind without a source is an anonymous volume
+		if source, _, ok := strings.Cut(b, ":"); ok {
+			names = append(names, source)
+		}
+	}
+	for _, m := range hostConfig.Mounts {
+		if m.Type == mount.TypeVolume && m.Source != "" {
+			names = append(names, m.Source)
+		}
+	}
+
+	for _, name := range names {
+		err := p.checkOwner(ctx, "volumes", name)
+		if !errors.Is(err, errNotFound) {
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		body := volume.CreateOptions{Name: name, Labels: map[string]string{OwnerLabel: p.owner}}
+		if err := p.post(ctx, "/volumes/create", body); err != nil {
+			return err
+		}
+		// Another runner may have created the volume in the meantime
+		if err := p.checkOwner(ctx, "volumes", name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNetwork makes sure a user-defined network a container joins is owned
+// by this proxy's owner.
+func (p *Proxy) checkNetwork(ctx context.Context, name string) error {
+	switch {
+	case name == "", name == "default", name == "bridge", name == "none",
+		name == "host", strings.HasPrefix(name, "container:"):
+		// host and container: are rejected by checkHostConfig
+		return nil
+	}
+	return p.checkOwner(ctx, "networks", name)
+}
+
+// rewriteJSON decodes the JSON request body into a T, lets fn check and
+// modify it and replaces the body with the re-encoded result.
+func rewriteJSON[T any](r *http.Request, fn func(body *T) error) error {
+	body := new(T)
+	if r.Body != nil {
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("failed to read request body: %w", err)
+		}
+		r.Body.Close()
+		if len(bytes.TrimSpace(data)) > 0 {
+			if err := json.Unmarshal(data, body); err != nil {
+				return fmt.Errorf("invalid request body: %w", err)
+			}
+		}
+	}
+
+	if err := fn(body); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	r.ContentLength = int64(len(data))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Del("Transfer-Encoding")
+	return nil
+}
+
+// peekJSON decodes the JSON request body into v and leaves the body readable.
+func peekJSON(r *http.Request, v any) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read request body: %w", err)
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(data))
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
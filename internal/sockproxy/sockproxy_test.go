@@ -0,0 +1,345 @@
+package sockproxy
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types/filters"
+	"github.com/docker/docker/api/types/volume"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeDocker records the requests it receives and answers inspect calls for
+// one container owned by "runner-1" and one owned by "runner-2", and for the
+// volumes it knows.
+type fakeDocker struct {
+	requests []*http.Request
+	bodies   []string
+	// volumes maps volume names to their owner
+	volumes map[string]string
+	// images lists the tagged images that exist locally
+	images map[string]bool
+}
+
+func (f *fakeDocker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	f.requests = append(f.requests, r)
+	f.bodies = append(f.bodies, string(body))
+
+	switch {
+	case r.URL.Path == "/containers/mine/json":
+		json.NewEncoder(w).Encode(map[string]any{"Config": map[string]any{"Labels": map[string]string{OwnerLabel: "runner-1"}}})
+	case r.URL.Path == "/containers/theirs/json":
+		json.NewEncoder(w).Encode(map[string]any{"Config": map[string]any{"Labels": map[string]string{OwnerLabel: "runner-2"}}})
+	case r.URL.Path == "/exec/exec-1/json":
+		json.NewEncoder(w).Encode(map[string]any{"ContainerID": "theirs"})
+	case strings.HasSuffix(r.URL.Path, "/volumes/create"):
+		var v volume.CreateOptions
+		json.Unmarshal(body, &v)
+		f.volumes[v.Name] = v.Labels[OwnerLabel]
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/images/") && strings.HasSuffix(r.URL.Path, "/json"):
+		if !f.images[strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/images/"), "/json")] {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/volumes/"):
+		owner, ok := f.volumes[strings.TrimPrefix(r.URL.Path, "/volumes/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"Labels": map[string]string{OwnerLabel: owner}})
+	default:
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func newTestProxy(t *testing.T) (*Proxy, *fakeDocker) {
+	t.Helper()
+	upstream := &fakeDocker{volumes: map[string]string{
+		"mine-vol":   "runner-1",
+		"theirs-vol": "runner-2",
+		"host-vol":   "",
+	}, images: map[string]bool{
+		"ghcr.io/org/runner:latest": true,
+		"runner-1/app:v1":           true,
+	}}
+	server := httptest.NewServer(upstream)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	require.NoError(t, err)
+	rules, err := ParseRules(DefaultRules)
+	require.NoError(t, err)
+	return New(u, http.DefaultTransport, "runner-1", rules), upstream
+}
+
+func serve(p *Proxy, method, target, body string) *httptest.ResponseRecorder {
+	rec := httptest.NewRecorder()
+	p.ServeHTTP(rec, httptest.NewRequest(method, target, strings.NewReader(body)))
+	return rec
+}
+
+func TestProxyDeniesEndpointsNotAllowed(t *testing.T) {
+	p, upstream := newTestProxy(t)
+
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodPost, "/v1.43/containers/prune", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodGet, "/v1.43/events", "").Code)
+	assert.Equal(t, http.StatusOK, serve(p, http.MethodGet, "/v1.43/_ping", "").Code)
+	assert.Len(t, upstream.requests, 1)
+}
+
+func TestProxyForcesOwnerLabelOnCreate(t *testing.T) {
+	p, upstream := newTestProxy(t)
+
+	rec := serve(p, http.MethodPost, "/v1.43/containers/create?name=job", `{"Image": "alpine", "Labels": {"app": "test"}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var body map[string]any
+	require.NoError(t, json.Unmarshal([]byte(upstream.bodies[0]), &body))
+	assert.Equal(t, "alpine", body["Image"])
+	assert.Equal(t, map[string]any{"app": "test", OwnerLabel: "runner-1"}, body["Labels"])
+
+	rec = serve(p, http.MethodPost, "/v1.43/build?t=runner-1/img&labels=%7B%22a%22%3A%22b%22%7D", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	var labels map[string]string
+	require.NoError(t, json.Unmarshal([]byte(upstream.requests[1].URL.Query().Get("labels")), &labels))
+	assert.Equal(t, map[string]string{"a": "b", OwnerLabel: "runner-1"}, labels)
+}
+
+func TestProxyRejectsReservedLabels(t *testing.T) {
+	p, upstream := newTestProxy(t)
+
+	labels := `{"garm.runner/controller-id": "controller", "garm.runner/instance-name": "runner-2"}`
+	for _, req := range []struct{ path, body string }{
+		{"/containers/create", `{"Image": "alpine", "Labels": ` + labels + `}`},
+		{"/containers/create", `{"Image": "alpine", "labels": {"garm.runner/pool-id": "pool"}}`},
+		{"/volumes/create", `{"Name": "data", "Labels": ` + labels + `}`},
+		{"/networks/create", `{"Name": "job", "Labels": ` + labels + `}`},
+		{"/build?labels=" + url.QueryEscape(labels), ""},
+	} {
+		rec := serve(p, http.MethodPost, req.path, req.body)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, req.path)
+	}
+	assert.Empty(t, upstream.requests)
+}
+
+func TestProxyRejectsHostAccess(t *testing.T) {
+	p, upstream := newTestProxy(t)
+
+	for _, hostConfig := range []string{
+		`{"Privileged": true}`,
+		`{"Binds": ["/:/host"]}`,
+		`{"Mounts": [{"Type": "bind", "Source": "/etc", "Target": "/etc"}]}`,
+		`{"PidMode": "host"}`,
+		`{"NetworkMode": "container:other"}`,
+		`{"CapAdd": ["SYS_ADMIN"]}`,
+		`{"SecurityOpt": ["seccomp=unconfined"]}`,
+		`{"SecurityOpt": ["seccomp={\"defaultAction\": \"SCMP_ACT_ALLOW\"}"]}`,
+		`{"SecurityOpt": ["apparmor:unconfined"]}`,
+		`{"SecurityOpt": ["label=disable"]}`,
+		`{"SecurityOpt": ["label=type:spc_t"]}`,
+		`{"SecurityOpt": ["systempaths=unconfined"]}`,
+		`{"SecurityOpt": ["no-new-privileges=false"]}`,
+		`{"MaskedPaths": []}`,
+		`{"ReadonlyPaths": ["/proc/sys"]}`,
+		`{"CgroupParent": "/system.slice"}`,
+	} {
+		rec := serve(p, http.MethodPost, "/containers/create", `{"Image": "alpine", "HostConfig": `+hostConfig+`}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, hostConfig)
+	}
+	assert.Empty(t, upstream.requests)
+
+	rec := serve(p, http.MethodPost, "/containers/create", `{"Image": "alpine", "HostConfig": {"Binds": ["mine-vol:/cache"], "SecurityOpt": ["no-new-privileges", "seccomp=builtin", "label=level:s0:c100"]}}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	for _, exec := range []string{`{"Cmd": ["sh"], "Privileged": true}`, `{"Cmd": ["sh"], "privileged": true}`} {
+		rec := serve(p, http.MethodPost, "/containers/mine/exec", exec)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, exec)
+	}
+	rec = serve(p, http.MethodPost, "/containers/mine/exec", `{"Cmd": ["sh"], "User": "root"}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	for _, query := range []string{"networkmode=host", "networkmode=container:other", "cgroupparent=/system.slice"} {
+		rec := serve(p, http.MethodPost, "/build?"+query, "")
+		assert.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+}
+
+func TestProxyRejectsHostNetworks(t *testing.T) {
+	p, upstream := newTestProxy(t)
+
+	for _, create := range []string{
+		`{"Name": "lan", "Driver": "macvlan", "Options": {"parent": "eth0"}}`,
+		`{"Name": "lan", "Driver": "ipvlan"}`,
+		`{"Name": "br", "Driver": "bridge", "Options": {"com.docker.network.bridge.name": "docker0"}}`,
+		`{"Name": "lan", "ConfigFrom": {"Network": "host-macvlan"}}`,
+		`{"Name": "lan", "IPAM": {"Driver": "some-plugin"}}`,
+	} {
+		rec := serve(p, http.MethodPost, "/networks/create", create)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, create)
+	}
+	assert.Empty(t, upstream.requests)
+
+	rec := serve(p, http.MethodPost, "/networks/create", `{"Name": "job", "Driver": "bridge", "IPAM": {"Driver": "default", "Config": [{"Subnet": "10.10.0.0/24"}]}}`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestProxyChecksLowercaseKeys(t *testing.T) {
+	p, upstream := newTestProxy(t)
+
+	// Docker decodes keys case-insensitively, so the proxy must too
+	for _, hostConfig := range []string{
+		`{"privileged": true}`,
+		`{"binds": ["/:/host"]}`,
+		`{"mounts": [{"type": "bind", "source": "/etc", "target": "/etc"}]}`,
+		`{"pidmode": "host"}`,
+		`{"capadd": ["SYS_ADMIN"]}`,
+	} {
+		rec := serve(p, http.MethodPost, "/containers/create", `{"Image": "alpine", "hostconfig": `+hostConfig+`}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, hostConfig)
+	}
+	assert.Empty(t, upstream.requests)
+
+	// A lowercase labels key can't replace the owner label
+	rec := serve(p, http.MethodPost, "/containers/create", `{"Image": "alpine", "labels": {"`+OwnerLabel+`": "runner-2"}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	var body map[string]any
+	require.NoError(t, json.Unmarshal([]byte(upstream.bodies[0]), &body))
+	assert.NotContains(t, body, "labels")
+	assert.Equal(t, map[string]any{OwnerLabel: "runner-1"}, body["Labels"])
+}
+
+func TestProxyRejectsOtherVolumes(t *testing.T) {
+	p, upstream := newTestProxy(t)
+
+	for _, create := range []string{
+		// local driver options can bind any host path
+		`{"Name": "root", "DriverOpts": {"type": "none", "o": "bind", "device": "/"}}`,
+		`{"name": "root", "driveropts": {"type": "none", "o": "bind", "device": "/"}}`,
+		`{"Name": "nfs", "Driver": "some-plugin"}`,
+	} {
+		rec := serve(p, http.MethodPost, "/volumes/create", create)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, create)
+	}
+	assert.Empty(t, upstream.requests)
+
+	for _, hostConfig := range []string{
+		`{"Binds": ["theirs-vol:/data"]}`,
+		`{"Binds": ["host-vol:/data"]}`,
+		`{"Mounts": [{"Type": "volume", "Source": "theirs-vol", "Target": "/data"}]}`,
+		`{"Mounts": [{"Type": "volume", "Target": "/data", "VolumeOptions": {"DriverConfig": {"Name": "local", "Options": {"type": "none", "o": "bind", "device": "/"}}}}]}`,
+	} {
+		rec := serve(p, http.MethodPost, "/containers/create", `{"Image": "alpine", "HostConfig": `+hostConfig+`}`)
+		assert.Equal(t, http.StatusBadRequest, rec.Code, hostConfig)
+	}
+}
+
+func TestProxyCreatesMissingVolumesWithOwner(t *testing.T) {
+	p, upstream := newTestProxy(t)
+
+	rec := serve(p, http.MethodPost, "/containers/create", `{"Image": "alpine", "HostConfig": {"Mounts": [{"Type": "volume", "Source": "cache", "Target": "/cache"}]}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "runner-1", upstream.volumes["cache"])
+
+	rec = serve(p, http.MethodPost, "/volumes/create", `{"Name": "data", "Labels": {"`+OwnerLabel+`": "runner-2"}}`)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "runner-1", upstream.volumes["data"])
+}
+
+func TestProxyScopesListings(t *testing.T) {
+	p, upstream := newTestProxy(t)
+
+	rec := serve(p, http.MethodGet, `/v1.43/containers/json?all=1&filters={"status":{"exited":true}}`, "")
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	args, err := filters.FromJSON(upstream.requests[0].URL.Query().Get("filters"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{OwnerLabel + "=runner-1"}, args.Get("label"))
+	assert.Equal(t, []string{"exited"}, args.Get("status"))
+
+	rec = serve(p, http.MethodGet, "/v1.43/images/json", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	args, err = filters.FromJSON(upstream.requests[1].URL.Query().Get("filters"))
+	require.NoError(t, err)
+	assert.Equal(t, []string{OwnerLabel + "=runner-1"}, args.Get("label"))
+}
+
+func TestProxyScopesImageNames(t *testing.T) {
+	p, upstream := newTestProxy(t)
+
+	// Tag and push are not allowed by default
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodPost, "/v1.43/images/runner-1/app/tag?repo=runner-1/other", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodPost, "/v1.43/images/runner-1/app/push", "").Code)
+
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodPost, "/v1.43/build?t=runner-image:latest", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodPost, "/v1.43/build?t=runner-1/app&t=runner-2/app", "").Code)
+	assert.Empty(t, upstream.requests)
+	assert.Equal(t, http.StatusOK, serve(p, http.MethodPost, "/v1.43/build?t=runner-1/app:v1", "").Code)
+	assert.Equal(t, http.StatusOK, serve(p, http.MethodPost, "/v1.43/build", "").Code)
+
+	rules, err := ParseRules(append(DefaultRules, "POST /images/.+/tag", "POST /images/.+/push"))
+	require.NoError(t, err)
+	p.rules = rules
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodPost, "/v1.43/images/runner-1/app/tag?repo=runner-image&tag=latest", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodPost, "/v1.43/images/private/app/push", "").Code)
+	assert.Equal(t, http.StatusOK, serve(p, http.MethodPost, "/v1.43/images/runner-1/app/tag?repo=runner-1/app&tag=v2", "").Code)
+	assert.Equal(t, http.StatusOK, serve(p, http.MethodPost, "/v1.43/images/runner-1/app/push?tag=v2", "").Code)
+}
+
+func TestProxyOnlyPullsNewTags(t *testing.T) {
+	p, _ := newTestProxy(t)
+
+	for _, query := range []string{
+		"fromSrc=-&repo=ghcr.io/org/runner&tag=latest",
+		"fromSrc=-&repo=runner-1/app",
+		// The runner image exists locally, a pull would move its tag
+		"fromImage=ghcr.io/org/runner&tag=latest",
+		"fromImage=ghcr.io/org/runner:latest",
+		"fromImage=ghcr.io/org/runner",
+		"fromImage=",
+	} {
+		assert.Equal(t, http.StatusForbidden, serve(p, http.MethodPost, "/v1.43/images/create?"+query, "").Code, query)
+	}
+
+	for _, query := range []string{
+		"fromImage=alpine&tag=3.19",
+		"fromImage=ghcr.io/org/runner&tag=v2",
+		"fromImage=ghcr.io/org/runner&tag=sha256:" + strings.Repeat("a", 64),
+		"fromImage=runner-1/app&tag=v1",
+	} {
+		assert.Equal(t, http.StatusOK, serve(p, http.MethodPost, "/v1.43/images/create?"+query, "").Code, query)
+	}
+}
+
+func TestProxyChecksOwnership(t *testing.T) {
+	p, _ := newTestProxy(t)
+
+	assert.Equal(t, http.StatusOK, serve(p, http.MethodPost, "/v1.43/containers/mine/stop", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodDelete, "/v1.43/containers/theirs", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodPost, "/v1.43/exec/exec-1/start", "{}").Code)
+
+	// Objects named like the list and create endpoints are still checked
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodDelete, "/v1.43/containers/create", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodDelete, "/v1.43/containers/json", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodGet, "/v1.43/volumes/create", "").Code)
+	assert.Equal(t, http.StatusForbidden, serve(p, http.MethodDelete, "/v1.43/networks/json", "").Code)
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules([]string{"get /_ping"})
+	require.NoError(t, err)
+	assert.Equal(t, "GET", rules[0].Method)
+	assert.True(t, rules[0].Pattern.MatchString("/_ping"))
+	assert.False(t, rules[0].Pattern.MatchString("/_ping/extra"))
+
+	_, err = ParseRules([]string{"/_ping"})
+	assert.Error(t, err)
+}
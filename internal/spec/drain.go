@@ -0,0 +1,74 @@
+package spec
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// Labels recording the drain settings of a runner, as Stop and DeleteInstance
+// don't get the pool's extra specs.
+const (
+	GarmDrainSignalLabel  = "garm.runner/drain-signal"
+	GarmDrainCommandLabel = "garm.runner/drain-command"
+	GarmDrainTimeoutLabel = "garm.runner/drain-timeout"
+)
+
+// GetDrainConfig returns the drain settings from the provider config with the
+// pool's overrides applied.
+func GetDrainConfig(cfg *config.ProviderConfig, extraSpecs ExtraSpecs) (config.DrainConfig, error) {
+	drain := cfg.Drain.Merge(extraSpecs.Drain)
+	if err := drain.Validate(); err != nil {
+		return config.DrainConfig{}, fmt.Errorf("drain: %w", err)
+	}
+	return drain, nil
+}
+
+// ApplyDrain sets the runner's stop signal and timeout, and records the
+// drain settings in its labels.
+func ApplyDrain(drain config.DrainConfig, containerConfig *container.Config) error {
+	containerConfig.StopSignal = drain.StopSignal
+	if drain.StopTimeout != nil {
+		seconds := int(drain.StopTimeout.Round(time.Second) / time.Second)
+		containerConfig.StopTimeout = &seconds
+	}
+
+	if drain.DrainTimeout() == 0 {
+		return nil
+	}
+	containerConfig.Labels[GarmDrainTimeoutLabel] = drain.DrainTimeout().String()
+	if drain.Signal != "" {
+		containerConfig.Labels[GarmDrainSignalLabel] = drain.Signal
+	}
+	if len(drain.Command) > 0 {
+		command, err := json.Marshal(drain.Command)
+		if err != nil {
+			return fmt.Errorf("failed to encode drain command: %w", err)
+		}
+		containerConfig.Labels[GarmDrainCommandLabel] = string(command)
+	}
+	return nil
+}
+
+// DrainFromLabels returns the drain settings recorded in a runner's labels.
+func DrainFromLabels(labels map[string]string) (config.DrainConfig, error) {
+	var drain config.DrainConfig
+	if labels[GarmDrainTimeoutLabel] == "" {
+		return drain, nil
+	}
+	timeout, err := time.ParseDuration(labels[GarmDrainTimeoutLabel])
+	if err != nil {
+		return drain, fmt.Errorf("invalid %s label: %w", GarmDrainTimeoutLabel, err)
+	}
+	drain.Timeout = &timeout
+	drain.Signal = labels[GarmDrainSignalLabel]
+	if command := labels[GarmDrainCommandLabel]; command != "" {
+		if err := json.Unmarshal([]byte(command), &drain.Command); err != nil {
+			return drain, fmt.Errorf("invalid %s label: %w", GarmDrainCommandLabel, err)
+		}
+	}
+	return drain, nil
+}
@@ -0,0 +1,50 @@
+package spec
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDrainFromExtraSpecs(t *testing.T) {
+	t.Parallel()
+	timeout := 10 * time.Minute
+	cfg := &config.ProviderConfig{Drain: config.DrainConfig{Signal: "SIGINT", Timeout: &timeout, StopSignal: "SIGTERM"}}
+
+	extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"drain": {"command": ["/runner/config.sh", "remove"], "timeout": "2m", "stop_timeout": "30s"}}`))
+	require.NoError(t, err)
+
+	drain, err := GetDrainConfig(cfg, extraSpecs)
+	require.NoError(t, err)
+	assert.Empty(t, drain.Signal)
+
+	containerConfig := &container.Config{Labels: map[string]string{}}
+	require.NoError(t, ApplyDrain(drain, containerConfig))
+	assert.Equal(t, "SIGTERM", containerConfig.StopSignal)
+	assert.Equal(t, 30, *containerConfig.StopTimeout)
+
+	fromLabels, err := DrainFromLabels(containerConfig.Labels)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/runner/config.sh", "remove"}, fromLabels.Command)
+	assert.Equal(t, 2*time.Minute, fromLabels.DrainTimeout())
+}
+
+func TestDrainExtraSpecsErrors(t *testing.T) {
+	t.Parallel()
+	_, err := ParseExtraSpecs(json.RawMessage(`{"drain": {"timeout": "soon"}}`))
+	assert.ErrorContains(t, err, "invalid timeout")
+
+	extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"drain": {"timout": "1m"}}`))
+	require.NoError(t, err)
+	assert.Zero(t, extraSpecs.Drain.Timeout)
+
+	extraSpecs, err = ParseExtraSpecs(json.RawMessage(`{"drain": {"timeout": "1m"}}`))
+	require.NoError(t, err)
+	_, err = GetDrainConfig(&config.ProviderConfig{}, extraSpecs)
+	assert.ErrorContains(t, err, "requires a signal or command")
+}
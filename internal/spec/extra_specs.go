@@ -0,0 +1,67 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// ExtraSpecs holds the per-pool settings passed by Garm in the bootstrap
+// params of an instance.
+type ExtraSpecs struct {
+	// Mounts are added to the mounts from the provider config.
+	Mounts []config.MountConfig `json:"mounts,omitempty"`
+	// Security overrides the security settings from the provider config.
+	Security config.SecurityConfig `json:"security,omitempty"`
+	// Drain overrides the drain settings from the provider config.
+	Drain config.DrainConfig `json:"drain,omitempty"`
+	// Healthcheck overrides the healthcheck from the provider config.
+	Healthcheck config.HealthcheckConfig `json:"healthcheck,omitempty"`
+	// Lifecycle overrides the lifecycle settings from the provider config.
+	Lifecycle config.LifecycleConfig `json:"lifecycle,omitempty"`
+}
+
+// providerOnlySecurityKeys are the security settings that decide what pools
+// may do, and can't be set by the pools themselves.
+var providerOnlySecurityKeys = []string{
+	"allow_dangerous",
+	"seccomp_profile_dir",
+	"allowed_apparmor_profiles",
+	"allowed_capabilities",
+	"allowed_userns_modes",
+}
+
+// ParseExtraSpecs decodes the extra specs of a pool. Unknown fields are
+// logged, so typos don't go unnoticed, but ignored, as pools may carry keys
+// for other tools or older provider versions.
+func ParseExtraSpecs(raw json.RawMessage) (ExtraSpecs, error) {
+	var extraSpecs ExtraSpecs
+	if len(bytes.TrimSpace(raw)) == 0 {
+		return extraSpecs, nil
+	}
+
+	if err := config.DecodeExtraSpecsJSON("", raw, &extraSpecs); err != nil {
+		return ExtraSpecs{}, fmt.Errorf("failed to decode extra specs: %w", err)
+	}
+	// Unknown fields are ignored, but a pool trying to allow dangerous
+	// settings for itself is an error
+	var security struct {
+		Security map[string]json.RawMessage `json:"security"`
+	}
+	if err := json.Unmarshal(raw, &security); err == nil {
+		for _, key := range providerOnlySecurityKeys {
+			if _, ok := security.Security[key]; ok {
+				return ExtraSpecs{}, fmt.Errorf("extra specs: security.%s can only be set in the provider config", key)
+			}
+		}
+	}
+
+	for i, m := range extraSpecs.Mounts {
+		if err := m.Validate(); err != nil {
+			return ExtraSpecs{}, fmt.Errorf("extra specs mounts[%d]: %w", i, err)
+		}
+	}
+	return extraSpecs, nil
+}
@@ -0,0 +1,28 @@
+package spec
+
+import (
+	"fmt"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// GetHealthConfig returns the healthcheck from the provider config with the
+// pool's overrides applied, or nil if none is configured and the image's
+// own healthcheck is used.
+func GetHealthConfig(cfg *config.ProviderConfig, extraSpecs ExtraSpecs) (*container.HealthConfig, error) {
+	hc := cfg.Healthcheck.Merge(extraSpecs.Healthcheck)
+	if err := hc.Validate(); err != nil {
+		return nil, fmt.Errorf("healthcheck: %w", err)
+	}
+	if len(hc.Test) == 0 {
+		return nil, nil
+	}
+	return &container.HealthConfig{
+		Test:        hc.Test,
+		Interval:    hc.Interval,
+		Timeout:     hc.Timeout,
+		StartPeriod: hc.StartPeriod,
+		Retries:     hc.Retries,
+	}, nil
+}
@@ -0,0 +1,42 @@
+package spec
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthConfigFromExtraSpecs(t *testing.T) {
+	t.Parallel()
+	cfg := &config.ProviderConfig{Healthcheck: config.HealthcheckConfig{
+		Test:     []string{"CMD-SHELL", "pgrep -f Runner.Listener"},
+		Interval: time.Minute,
+		Retries:  5,
+	}}
+
+	extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"healthcheck": {"interval": "10s", "start_period": "2m"}}`))
+	require.NoError(t, err)
+
+	hc, err := GetHealthConfig(cfg, extraSpecs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"CMD-SHELL", "pgrep -f Runner.Listener"}, hc.Test)
+	assert.Equal(t, 10*time.Second, hc.Interval)
+	assert.Equal(t, 2*time.Minute, hc.StartPeriod)
+	assert.Equal(t, 5, hc.Retries)
+
+	extraSpecs, err = ParseExtraSpecs(json.RawMessage(`{"healthcheck": {"test": ["pgrep", "Runner.Listener"]}}`))
+	require.NoError(t, err)
+	_, err = GetHealthConfig(cfg, extraSpecs)
+	assert.ErrorContains(t, err, "must start with")
+}
+
+func TestNoHealthConfig(t *testing.T) {
+	t.Parallel()
+	hc, err := GetHealthConfig(&config.ProviderConfig{}, ExtraSpecs{})
+	require.NoError(t, err)
+	assert.Nil(t, hc)
+}
@@ -0,0 +1,57 @@
+package spec
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/docker/docker/api/types/container"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// GarmMaxLifetimeLabel records the max lifetime of a runner, as the reaper
+// and GetInstance don't get the pool's extra specs.
+const GarmMaxLifetimeLabel = "garm.runner/max-lifetime"
+
+// GarmEphemeralLabel records whether a runner is ephemeral, so the reaper
+// only removes runners that are done after their job.
+const GarmEphemeralLabel = "garm.runner/ephemeral"
+
+// GetLifecycleConfig returns the lifecycle settings from the provider config
+// with the pool's overrides applied, validated for the instance.
+func GetLifecycleConfig(cfg *config.ProviderConfig, extraSpecs ExtraSpecs, bootstrapParams params.BootstrapInstance) (config.LifecycleConfig, error) {
+	lc := cfg.Lifecycle.Merge(extraSpecs.Lifecycle)
+	if err := lc.Validate(); err != nil {
+		return config.LifecycleConfig{}, fmt.Errorf("lifecycle: %w", err)
+	}
+	if !lc.IsEphemeral() && bootstrapParams.JitConfigEnabled {
+		return config.LifecycleConfig{}, fmt.Errorf("lifecycle: just-in-time runners are always ephemeral")
+	}
+	return lc, nil
+}
+
+// ApplyLifecycle sets the runner's restart policy and records whether it is
+// ephemeral and its max lifetime in its labels.
+func ApplyLifecycle(lc config.LifecycleConfig, containerConfig *container.Config, hostConfig *container.HostConfig) {
+	containerConfig.Labels[GarmEphemeralLabel] = strconv.FormatBool(lc.IsEphemeral())
+	if lc.RestartPolicy.Name != "" {
+		hostConfig.RestartPolicy = container.RestartPolicy{
+			Name:              lc.RestartPolicy.Name,
+			MaximumRetryCount: lc.RestartPolicy.MaxRetries,
+		}
+	}
+	if lc.MaxLifetime > 0 {
+		containerConfig.Labels[GarmMaxLifetimeLabel] = lc.MaxLifetime.String()
+	}
+}
+
+// LifetimeExceeded reports whether a runner created at the given time has
+// outlived the max lifetime recorded in its labels.
+func LifetimeExceeded(labels map[string]string, created time.Time) (time.Duration, bool) {
+	maxLifetime, err := time.ParseDuration(labels[GarmMaxLifetimeLabel])
+	if err != nil || maxLifetime <= 0 {
+		return 0, false
+	}
+	return maxLifetime, time.Since(created) > maxLifetime
+}
@@ -0,0 +1,59 @@
+package spec
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cloudbase/garm-provider-common/params"
+	"github.com/docker/docker/api/types/container"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLifecycleFromExtraSpecs(t *testing.T) {
+	t.Parallel()
+	extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"lifecycle": {"ephemeral": false, "max_lifetime": "24h", "restart_policy": {"name": "on-failure", "max_retries": 3}}}`))
+	require.NoError(t, err)
+
+	lc, err := GetLifecycleConfig(&config.ProviderConfig{}, extraSpecs, params.BootstrapInstance{})
+	require.NoError(t, err)
+	assert.False(t, lc.IsEphemeral())
+
+	containerConfig := &container.Config{Labels: map[string]string{}}
+	hostConfig := &container.HostConfig{}
+	ApplyLifecycle(lc, containerConfig, hostConfig)
+	assert.Equal(t, container.RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}, hostConfig.RestartPolicy)
+	assert.Equal(t, "false", containerConfig.Labels[GarmEphemeralLabel])
+
+	maxLifetime, exceeded := LifetimeExceeded(containerConfig.Labels, time.Now().Add(-25*time.Hour))
+	assert.True(t, exceeded)
+	assert.Equal(t, 24*time.Hour, maxLifetime)
+	_, exceeded = LifetimeExceeded(containerConfig.Labels, time.Now().Add(-time.Hour))
+	assert.False(t, exceeded)
+	_, exceeded = LifetimeExceeded(map[string]string{}, time.Time{})
+	assert.False(t, exceeded)
+
+	envs, err := GetRunnerEnvs(params.BootstrapInstance{RepoURL: "https://github.com/org/repo"}, lc.IsEphemeral())
+	require.NoError(t, err)
+	assert.Contains(t, envs, "RUNNER_EPHEMERAL=false")
+}
+
+func TestLifecycleRejectsConflictsWithEphemeralMode(t *testing.T) {
+	t.Parallel()
+	extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"lifecycle": {"restart_policy": {"name": "on-failure", "max_retries": 3}}}`))
+	require.NoError(t, err)
+	_, err = GetLifecycleConfig(&config.ProviderConfig{}, extraSpecs, params.BootstrapInstance{})
+	assert.ErrorContains(t, err, "can't be used with ephemeral runners")
+
+	extraSpecs, err = ParseExtraSpecs(json.RawMessage(`{"lifecycle": {"ephemeral": false}}`))
+	require.NoError(t, err)
+	_, err = GetLifecycleConfig(&config.ProviderConfig{}, extraSpecs, params.BootstrapInstance{JitConfigEnabled: true})
+	assert.ErrorContains(t, err, "always ephemeral")
+
+	extraSpecs, err = ParseExtraSpecs(json.RawMessage(`{"lifecycle": {"ephemeral": false, "restart_policy": {"name": "always"}}}`))
+	require.NoError(t, err)
+	_, err = GetLifecycleConfig(&config.ProviderConfig{}, extraSpecs, params.BootstrapInstance{})
+	assert.ErrorContains(t, err, "unsupported name")
+}
@@ -0,0 +1,123 @@
+package spec
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/mount"
+	units "github.com/docker/go-units"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// mountTypeImage mounts the filesystem of an image. It is not part of the
+// vendored API types and needs Docker Engine API 1.48 or newer.
+const mountTypeImage mount.Type = "image"
+
+// GetMounts turns the mounts from the provider config and the pool extra specs
+// into bind strings and structured mounts for the container HostConfig.
+// Bind mounts are rendered as bind strings, since only those support SELinux
+// relabeling. Mounts are checked with config.CheckMount: extra specs can only
+// reach allowed host paths and allowed named volumes.
+func GetMounts(cfg *config.ProviderConfig, extraSpecsMounts []config.MountConfig) ([]string, []mount.Mount, error) {
+	var binds []string
+	var mounts []mount.Mount
+
+	add := func(m config.MountConfig, fromExtraSpecs bool) error {
+		if err := cfg.CheckMount(m, fromExtraSpecs); err != nil {
+			return err
+		}
+		if m.Type == config.MountTypeBind {
+			binds = append(binds, toBind(m))
+			return nil
+		}
+
+		dockerMount, err := toMount(m)
+		if err != nil {
+			return err
+		}
+		mounts = append(mounts, dockerMount)
+		return nil
+	}
+
+	for _, m := range cfg.Mounts {
+		if err := add(m, false); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, m := range extraSpecsMounts {
+		if err := add(m, true); err != nil {
+			return nil, nil, fmt.Errorf("extra specs: %w", err)
+		}
+	}
+	return binds, mounts, nil
+}
+
+func toBind(m config.MountConfig) string {
+	var opts []string
+	if m.ReadOnly {
+		opts = append(opts, "ro")
+	}
+	switch m.Relabel {
+	case "shared":
+		opts = append(opts, "z")
+	case "private":
+		opts = append(opts, "Z")
+	}
+	if m.Propagation != "" {
+		opts = append(opts, m.Propagation)
+	}
+
+	bind := m.Source + ":" + m.Target
+	if len(opts) > 0 {
+		bind += ":" + strings.Join(opts, ",")
+	}
+	return bind
+}
+
+func toMount(m config.MountConfig) (mount.Mount, error) {
+	dockerMount := mount.Mount{
+		Source:   m.Source,
+		Target:   m.Target,
+		ReadOnly: m.ReadOnly,
+	}
+
+	switch m.Type {
+	case config.MountTypeVolume:
+		dockerMount.Type = mount.TypeVolume
+		if m.Driver != "" || len(m.DriverOpts) > 0 || m.NoCopy {
+			dockerMount.VolumeOptions = &mount.VolumeOptions{NoCopy: m.NoCopy}
+			if m.Driver != "" || len(m.DriverOpts) > 0 {
+				dockerMount.VolumeOptions.DriverConfig = &mount.Driver{
+					Name:    m.Driver,
+					Options: m.DriverOpts,
+				}
+			}
+		}
+	case config.MountTypeTmpfs:
+		dockerMount.Type = mount.TypeTmpfs
+		if m.Size != "" || m.Mode != "" {
+			dockerMount.TmpfsOptions = &mount.TmpfsOptions{}
+		}
+		if m.Size != "" {
+			size, err := units.RAMInBytes(m.Size)
+			if err != nil {
+				return mount.Mount{}, fmt.Errorf("invalid tmpfs size %q: %w", m.Size, err)
+			}
+			dockerMount.TmpfsOptions.SizeBytes = size
+		}
+		if m.Mode != "" {
+			mode, err := strconv.ParseUint(m.Mode, 8, 32)
+			if err != nil {
+				return mount.Mount{}, fmt.Errorf("invalid tmpfs mode %q: %w", m.Mode, err)
+			}
+			dockerMount.TmpfsOptions.Mode = os.FileMode(mode)
+		}
+	case config.MountTypeImage:
+		dockerMount.Type = mountTypeImage
+	default:
+		return mount.Mount{}, fmt.Errorf("unsupported mount type %q", m.Type)
+	}
+	return dockerMount, nil
+}
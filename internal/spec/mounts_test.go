@@ -0,0 +1,143 @@
+package spec
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/docker/docker/api/types/mount"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetMounts(t *testing.T) {
+	t.Parallel()
+	cfg := &config.ProviderConfig{AllowedHostPaths: []string{"/srv/runners"}}
+	cfg.Mounts = []config.MountConfig{
+		{Type: "bind", Source: "/srv/runners/cache", Target: "/cache", ReadOnly: true, Relabel: "private", Propagation: "rslave"},
+		{Type: "volume", Source: "shared", Target: "/shared", Driver: "local", DriverOpts: map[string]string{"type": "nfs"}},
+		{Type: "volume", Target: "/scratch"},
+		{Type: "tmpfs", Target: "/tmp", Size: "64m", Mode: "1777"},
+		{Type: "image", Source: "alpine:latest", Target: "/tools"},
+	}
+
+	binds, mounts, err := GetMounts(cfg, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"/srv/runners/cache:/cache:ro,Z,rslave"}, binds)
+	require.Len(t, mounts, 4)
+	assert.Equal(t, mount.Mount{
+		Type:   mount.TypeVolume,
+		Source: "shared",
+		Target: "/shared",
+		VolumeOptions: &mount.VolumeOptions{
+			DriverConfig: &mount.Driver{Name: "local", Options: map[string]string{"type": "nfs"}},
+		},
+	}, mounts[0])
+	assert.Equal(t, mount.Mount{Type: mount.TypeVolume, Target: "/scratch"}, mounts[1])
+	assert.Equal(t, mount.TypeTmpfs, mounts[2].Type)
+	assert.Equal(t, int64(64*1024*1024), mounts[2].TmpfsOptions.SizeBytes)
+	assert.Equal(t, os.FileMode(0o1777), mounts[2].TmpfsOptions.Mode)
+	assert.Equal(t, mount.Mount{Type: "image", Source: "alpine:latest", Target: "/tools"}, mounts[3])
+}
+
+func TestGetMountsRejectsDisallowedHostPaths(t *testing.T) {
+	t.Parallel()
+	extraSpecsMounts := []config.MountConfig{
+		{Type: "bind", Source: "/srv/runners/../../etc", Target: "/etc-host"},
+	}
+
+	// Without an allow-list, extra specs can't bind mount host paths at all.
+	_, _, err := GetMounts(&config.ProviderConfig{}, extraSpecsMounts)
+	assert.ErrorContains(t, err, "not in allowed_host_paths")
+
+	cfg := &config.ProviderConfig{AllowedHostPaths: []string{"/srv/runners"}}
+	_, _, err = GetMounts(cfg, extraSpecsMounts)
+	assert.ErrorContains(t, err, "not in allowed_host_paths")
+
+	binds, _, err := GetMounts(cfg, []config.MountConfig{
+		{Type: "bind", Source: "/srv/runners", Target: "/runners"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/srv/runners:/runners"}, binds)
+}
+
+func TestGetMountsChecksVolumeBindDevices(t *testing.T) {
+	t.Parallel()
+	cfg := &config.ProviderConfig{AllowedHostPaths: []string{"/srv/runners"}, AllowedVolumes: []string{"cache"}}
+
+	for _, m := range []config.MountConfig{
+		{Type: "volume", Source: "etc", Target: "/etc-host", DriverOpts: map[string]string{"type": "none", "o": "bind", "device": "/etc"}},
+		{Type: "volume", Source: "etc", Target: "/etc-host", Driver: "local", DriverOpts: map[string]string{"type": "none", "o": "ro,rbind", "device": "/etc"}},
+		{Type: "volume", Source: "rel", Target: "/rel", DriverOpts: map[string]string{"o": "bind", "device": "etc"}},
+	} {
+		_, _, err := GetMounts(cfg, []config.MountConfig{m})
+		assert.ErrorContains(t, err, "not in allowed_host_paths", m.DriverOpts)
+	}
+
+	_, _, err := GetMounts(cfg, []config.MountConfig{
+		{Type: "volume", Source: "nfs", Target: "/nfs", Driver: "some-plugin"},
+	})
+	assert.ErrorContains(t, err, "not allowed in extra specs")
+
+	_, mounts, err := GetMounts(cfg, []config.MountConfig{
+		{Type: "volume", Source: "cache", Target: "/cache", DriverOpts: map[string]string{"type": "none", "o": "bind", "device": "/srv/runners/cache"}},
+	})
+	require.NoError(t, err)
+	assert.Len(t, mounts, 1)
+}
+
+func TestGetMountsRestrictsExtraSpecsVolumes(t *testing.T) {
+	t.Parallel()
+	cfg := &config.ProviderConfig{AllowedHostPaths: []string{"/srv/runners"}, AllowedVolumes: []string{"cache-*"}}
+
+	for _, opts := range []map[string]string{
+		{"type": "ext4", "device": "/dev/sda1"},
+		{"type": "nfs", "o": "addr=10.0.0.1,rw", "device": ":/export"},
+		{"type": "none", "o": "bind,shared", "device": "/srv/runners/cache"},
+		{"type": "none", "o": "bind", "device": "/srv/runners/cache", "size": "1g"},
+	} {
+		_, _, err := GetMounts(cfg, []config.MountConfig{{Type: "volume", Source: "cache-1", Target: "/data", DriverOpts: opts}})
+		assert.ErrorContains(t, err, "driver_opts other than a bind of a host directory are not allowed in extra specs", opts)
+	}
+
+	// Existing volumes of other runners can't be attached by name
+	for _, name := range []string{"runner-2-docker-proxy", "dind-seed"} {
+		_, _, err := GetMounts(cfg, []config.MountConfig{{Type: "volume", Source: name, Target: "/data"}})
+		assert.ErrorContains(t, err, "volume "+name+" is not in allowed_volumes")
+	}
+
+	_, mounts, err := GetMounts(cfg, []config.MountConfig{
+		{Type: "volume", Target: "/scratch"},
+		{Type: "volume", Source: "cache-go", Target: "/go"},
+	})
+	require.NoError(t, err)
+	assert.Len(t, mounts, 2)
+
+	// The provider config is trusted with any driver options
+	cfg.Mounts = []config.MountConfig{{Type: "volume", Source: "disk", Target: "/disk", DriverOpts: map[string]string{"type": "ext4", "device": "/dev/sdb1"}}}
+	_, _, err = GetMounts(cfg, nil)
+	assert.NoError(t, err)
+}
+
+func TestParseExtraSpecs(t *testing.T) {
+	t.Parallel()
+	extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"mounts": [{"type": "tmpfs", "target": "/tmp", "size": "1g"}]}`))
+	require.NoError(t, err)
+	assert.Len(t, extraSpecs.Mounts, 1)
+
+	// Unknown fields are only logged
+	extraSpecs, err = ParseExtraSpecs(json.RawMessage(`{"mount": [], "mounts": [{"type": "tmpfs", "target": "/tmp"}]}`))
+	require.NoError(t, err)
+	assert.Len(t, extraSpecs.Mounts, 1)
+
+	_, err = ParseExtraSpecs(json.RawMessage(`{"mount": [], "mounts": {}}`))
+	assert.ErrorContains(t, err, "cannot unmarshal")
+
+	_, err = ParseExtraSpecs(json.RawMessage(`{"mounts": [{"type": "tmpfs", "source": "x", "target": "/tmp"}]}`))
+	assert.ErrorContains(t, err, "can't have a source")
+
+	_, err = ParseExtraSpecs(json.RawMessage(`{"mounts": [{"type": "volume", "target": "/data", "propagation": "rshared"}]}`))
+	assert.ErrorContains(t, err, "only valid for bind mounts")
+}
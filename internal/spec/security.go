@@ -0,0 +1,77 @@
+package spec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+)
+
+// GetSecurityConfig returns the security settings from the provider config
+// with the pool's overrides applied, validated for the configured dind_mode.
+// Pools can only add to the configured settings, not weaken them.
+func GetSecurityConfig(cfg *config.ProviderConfig, extraSpecs ExtraSpecs) (config.SecurityConfig, error) {
+	if err := cfg.Security.CheckOverride(extraSpecs.Security, cfg.DinDMode); err != nil {
+		return config.SecurityConfig{}, fmt.Errorf("extra specs security: %w", err)
+	}
+	sec := cfg.Security.Merge(extraSpecs.Security)
+	if err := sec.Validate(cfg.DinDMode); err != nil {
+		return config.SecurityConfig{}, fmt.Errorf("security: %w", err)
+	}
+	return sec, nil
+}
+
+// ApplySecurity applies the security settings to the runner's container and
+// host config.
+func ApplySecurity(sec config.SecurityConfig, containerConfig *container.Config, hostConfig *container.HostConfig) error {
+	for _, c := range sec.CapAdd {
+		hostConfig.CapAdd = append(hostConfig.CapAdd, config.NormalizeCapability(c))
+	}
+	for _, c := range sec.CapDrop {
+		hostConfig.CapDrop = append(hostConfig.CapDrop, config.NormalizeCapability(c))
+	}
+
+	switch sec.SeccompProfile {
+	case "":
+	case "unconfined":
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp=unconfined")
+	default:
+		// The API expects the profile itself, not a path
+		profile, err := os.ReadFile(sec.SeccompProfile)
+		if err != nil {
+			return fmt.Errorf("failed to read seccomp profile: %w", err)
+		}
+		var compacted bytes.Buffer
+		if err := json.Compact(&compacted, profile); err != nil {
+			return fmt.Errorf("invalid seccomp profile %s: %w", sec.SeccompProfile, err)
+		}
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "seccomp="+compacted.String())
+	}
+	if sec.AppArmorProfile != "" {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "apparmor="+sec.AppArmorProfile)
+	}
+	if sec.NoNewPrivileges != nil && *sec.NoNewPrivileges {
+		hostConfig.SecurityOpt = append(hostConfig.SecurityOpt, "no-new-privileges=true")
+	}
+
+	if sec.IsReadOnlyRootfs() {
+		hostConfig.ReadonlyRootfs = true
+		if len(sec.WritablePaths) > 0 && hostConfig.Tmpfs == nil {
+			hostConfig.Tmpfs = map[string]string{}
+		}
+		for _, p := range sec.WritablePaths {
+			hostConfig.Tmpfs[p] = "rw"
+		}
+	}
+
+	if sec.UsernsMode != "" {
+		hostConfig.UsernsMode = container.UsernsMode(sec.UsernsMode)
+	}
+	if sec.User != "" {
+		containerConfig.User = sec.User
+	}
+	return nil
+}
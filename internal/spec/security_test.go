@@ -0,0 +1,173 @@
+package spec
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSecurityFromExtraSpecs(t *testing.T) {
+	t.Parallel()
+	profileDir := t.TempDir()
+	profile := filepath.Join(profileDir, "seccomp.json")
+	require.NoError(t, os.WriteFile(profile, []byte("{\n  \"defaultAction\": \"SCMP_ACT_ERRNO\"\n}"), 0o644))
+
+	readOnly := true
+	cfg := &config.ProviderConfig{
+		DinDMode: config.DinDModeSysbox,
+		Security: config.SecurityConfig{
+			CapDrop:             []string{"MKNOD"},
+			ReadOnlyRootfs:      &readOnly,
+			WritablePaths:       []string{"/tmp"},
+			User:                "1001",
+			SeccompProfileDir:   profileDir,
+			AllowedCapabilities: []string{"NET_RAW"},
+		},
+	}
+
+	extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"security": {"cap_add": ["cap_net_raw"], "seccomp_profile": "` + profile + `", "no_new_privileges": true, "writable_paths": ["/tmp", "/runner/_work"]}}`))
+	require.NoError(t, err)
+
+	sec, err := GetSecurityConfig(cfg, extraSpecs)
+	require.NoError(t, err)
+
+	containerConfig := &container.Config{}
+	hostConfig := &container.HostConfig{}
+	require.NoError(t, ApplySecurity(sec, containerConfig, hostConfig))
+
+	assert.Equal(t, []string{"NET_RAW"}, []string(hostConfig.CapAdd))
+	assert.Equal(t, []string{"MKNOD"}, []string(hostConfig.CapDrop))
+	assert.Equal(t, []string{`seccomp={"defaultAction":"SCMP_ACT_ERRNO"}`, "no-new-privileges=true"}, hostConfig.SecurityOpt)
+	assert.True(t, hostConfig.ReadonlyRootfs)
+	assert.Equal(t, map[string]string{"/tmp": "rw", "/runner/_work": "rw"}, hostConfig.Tmpfs)
+	assert.Equal(t, "1001", containerConfig.User)
+}
+
+func TestSecurityExtraSpecsCantWeakenBaseline(t *testing.T) {
+	t.Parallel()
+	profileDir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "seccomp.json")
+	require.NoError(t, os.WriteFile(outside, []byte(`{}`), 0o644))
+	require.NoError(t, os.Symlink(outside, filepath.Join(profileDir, "link.json")))
+
+	enabled := true
+	cfg := &config.ProviderConfig{
+		DinDMode: config.DinDModeSysbox,
+		Security: config.SecurityConfig{
+			CapAdd:            []string{"CHOWN"},
+			CapDrop:           []string{"ALL"},
+			NoNewPrivileges:   &enabled,
+			ReadOnlyRootfs:    &enabled,
+			UsernsMode:        "private",
+			User:              "1001",
+			SeccompProfileDir: profileDir,
+		},
+	}
+
+	// Capabilities to drop are added to the baseline, not replaced
+	extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"security": {"cap_drop": ["NET_RAW"]}}`))
+	require.NoError(t, err)
+	sec, err := GetSecurityConfig(cfg, extraSpecs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ALL", "NET_RAW"}, sec.CapDrop)
+
+	extraSpecs, err = ParseExtraSpecs(json.RawMessage(`{"security": {"cap_drop": []}}`))
+	require.NoError(t, err)
+	sec, err = GetSecurityConfig(cfg, extraSpecs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"ALL"}, sec.CapDrop)
+
+	// Capabilities the baseline adds back can be listed again
+	extraSpecs, err = ParseExtraSpecs(json.RawMessage(`{"security": {"cap_add": ["cap_chown"]}}`))
+	require.NoError(t, err)
+	_, err = GetSecurityConfig(cfg, extraSpecs)
+	require.NoError(t, err)
+
+	for override, wantErr := range map[string]string{
+		`{"no_new_privileges": false}`:                        "can't be turned off",
+		`{"read_only_rootfs": false}`:                         "can't be turned off",
+		`{"userns_mode": "host"}`:                             "not in allowed_userns_modes",
+		`{"user": "0:0"}`:                                     "runs as root",
+		`{"seccomp_profile": "` + outside + `"}`:              "not in seccomp_profile_dir",
+		`{"seccomp_profile": "` + profileDir + `/link.json"}`: "not in seccomp_profile_dir",
+		`{"cap_add": ["NET_RAW"]}`:                            "dropped in the provider config",
+		`{"apparmor_profile": "custom"}`:                      "not in allowed_apparmor_profiles",
+	} {
+		extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"security": ` + override + `}`))
+		require.NoError(t, err)
+		_, err = GetSecurityConfig(cfg, extraSpecs)
+		assert.ErrorContains(t, err, wantErr, override)
+	}
+}
+
+func TestSecurityExtraSpecsAllowLists(t *testing.T) {
+	t.Parallel()
+	cfg := &config.ProviderConfig{
+		DinDMode: config.DinDModeSysbox,
+		Security: config.SecurityConfig{
+			AllowedCapabilities: []string{"cap_net_raw"},
+			AllowedUsernsModes:  []string{"private"},
+		},
+	}
+
+	// Without a baseline, pools still can't add capabilities or turn off
+	// the daemon's userns-remap
+	for override, wantErr := range map[string]string{
+		`{"cap_add": ["SYS_TIME"]}`:      "capability SYS_TIME is not in allowed_capabilities",
+		`{"cap_add": ["MAC_ADMIN"]}`:     "capability MAC_ADMIN is not in allowed_capabilities",
+		`{"userns_mode": "host"}`:        "userns_mode \"host\" is not in allowed_userns_modes",
+		`{"allowed_capabilities": [""]}`: "security.allowed_capabilities can only be set in the provider config",
+		`{"allowed_userns_modes": [""]}`: "security.allowed_userns_modes can only be set in the provider config",
+	} {
+		extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"security": ` + override + `}`))
+		if err == nil {
+			_, err = GetSecurityConfig(cfg, extraSpecs)
+		}
+		assert.ErrorContains(t, err, wantErr, override)
+	}
+
+	extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"security": {"cap_add": ["NET_RAW"], "userns_mode": "private"}}`))
+	require.NoError(t, err)
+	sec, err := GetSecurityConfig(cfg, extraSpecs)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"NET_RAW"}, sec.CapAdd)
+	assert.Equal(t, "private", sec.UsernsMode)
+}
+
+func TestSecurityRejectsDangerousExtraSpecs(t *testing.T) {
+	t.Parallel()
+	cfg := &config.ProviderConfig{DinDMode: config.DinDModeSysbox}
+
+	// Pools can't allow dangerous settings themselves
+	_, err := ParseExtraSpecs(json.RawMessage(`{"security": {"allow_dangerous": true}}`))
+	assert.ErrorContains(t, err, "can only be set in the provider config")
+
+	extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"security": {"cap_add": ["SYS_ADMIN"]}}`))
+	require.NoError(t, err)
+	_, err = GetSecurityConfig(cfg, extraSpecs)
+	assert.ErrorContains(t, err, "dangerous")
+
+	// allow_dangerous only covers the provider config's own settings
+	cfg.Security.AllowDangerous = true
+	cfg.Security.AllowedAppArmorProfiles = []string{"unconfined"}
+	for _, override := range []string{
+		`{"cap_add": ["SYS_ADMIN"]}`,
+		`{"seccomp_profile": "unconfined"}`,
+		`{"apparmor_profile": "unconfined"}`,
+	} {
+		extraSpecs, err := ParseExtraSpecs(json.RawMessage(`{"security": ` + override + `}`))
+		require.NoError(t, err)
+		_, err = GetSecurityConfig(cfg, extraSpecs)
+		assert.ErrorContains(t, err, "can only be set in the provider config", override)
+	}
+
+	cfg.Security.CapAdd = []string{"SYS_ADMIN"}
+	_, err = GetSecurityConfig(cfg, ExtraSpecs{})
+	assert.NoError(t, err)
+}
@@ -15,6 +15,17 @@ const (
 	GarmFlavorLabel       = "garm.runner/flavor"
 	GarmOSTypeLabel       = "garm.runner/os-type"
 	GarmOSArchLabel       = "garm.runner/os-arch"
+	GarmRoleLabel         = "garm.runner/role"
+)
+
+// Roles of the containers and volumes created by the provider. Containers
+// without a role label are runners created by older versions.
+const (
+	RoleRunner      = "runner"
+	RoleSocketProxy = "socket-proxy"
+	RoleSeeder      = "seeder"
+	// RoleStopMarker is an empty volume recording that Garm stopped a runner.
+	RoleStopMarker = "stop-marker"
 )
 
 type GitHubScopeDetails struct {
@@ -24,7 +35,7 @@ type GitHubScopeDetails struct {
 	Enterprise string
 }
 
-func GetRunnerEnvs(bootstrapParams params.BootstrapInstance) ([]string, error) {
+func GetRunnerEnvs(bootstrapParams params.BootstrapInstance, ephemeral bool) ([]string, error) {
 	gitHubScope, err := ExtractGitHubScopeDetails(bootstrapParams.RepoURL)
 	if err != nil {
 		return nil, err
@@ -41,7 +52,7 @@ func GetRunnerEnvs(bootstrapParams params.BootstrapInstance) ([]string, error) {
 		"DISABLE_RUNNER_UPDATE=true",
 		"RUNNER_WORKDIR=/runner/_work/",
 		fmt.Sprintf("GITHUB_URL=%s", gitHubScope.BaseURL),
-		"RUNNER_EPHEMERAL=true",
+		fmt.Sprintf("RUNNER_EPHEMERAL=%t", ephemeral),
 		"RUNNER_TOKEN=dummy",
 		fmt.Sprintf("METADATA_URL=%s", bootstrapParams.MetadataURL),
 		fmt.Sprintf("BEARER_TOKEN=%s", bootstrapParams.InstanceToken),
@@ -96,10 +107,11 @@ func GetContainerLabels(controllerID string, bootstrapParams params.BootstrapIns
 	labels[GarmFlavorLabel] = bootstrapParams.Flavor
 	labels[GarmOSTypeLabel] = string(bootstrapParams.OSType)
 	labels[GarmOSArchLabel] = string(bootstrapParams.OSArch)
+	labels[GarmRoleLabel] = RoleRunner
 	return labels
 }
 
 // GetHostConfigRuntime returns the runtime string to be used for the container
-func GetHostConfigRuntime() string {
-	return config.Config.Runtime
+func GetHostConfigRuntime(cfg *config.ProviderConfig) string {
+	return cfg.Runtime
 }
@@ -0,0 +1,101 @@
+// Package tracing sets up OpenTelemetry tracing for a provider invocation.
+// Spans are exported over OTLP/HTTP and flushed when the provider exits, as
+// the process only lives for a single Garm call.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/mercedes-benz/garm-provider-docker/pkg/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name of the tracer used by the provider.
+const Name = "github.com/mercedes-benz/garm-provider-docker"
+
+// Tracer returns the provider's tracer. It is a no-op until Setup is called.
+func Tracer() trace.Tracer {
+	return otel.Tracer(Name)
+}
+
+// Setup installs a global tracer provider that exports spans to the
+// configured endpoint. The returned function flushes pending spans and must
+// be called before the process exits.
+func Setup(ctx context.Context, cfg config.TracingConfig) (func(context.Context) error, error) {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpointURL(endpointURL(cfg.Endpoint))}
+	if len(cfg.Headers) > 0 {
+		headers := make(map[string]string, len(cfg.Headers))
+		for name, value := range cfg.Headers {
+			headers[name] = value.Value()
+		}
+		opts = append(opts, otlptracehttp.WithHeaders(headers))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+
+	res, err := resource.Merge(resource.Default(),
+		resource.NewSchemaless(attribute.String("service.name", cfg.ServiceName)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace resource: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sampler(cfg)),
+	)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	return tp.Shutdown, nil
+}
+
+// ContextFromEnv returns ctx with the remote parent span passed in the
+// TRACEPARENT and TRACESTATE environment variables, if any.
+func ContextFromEnv(ctx context.Context) context.Context {
+	carrier := propagation.MapCarrier{}
+	if v := os.Getenv("TRACEPARENT"); v != "" {
+		carrier["traceparent"] = v
+	}
+	if v := os.Getenv("TRACESTATE"); v != "" {
+		carrier["tracestate"] = v
+	}
+	return propagation.TraceContext{}.Extract(ctx, carrier)
+}
+
+// endpointURL adds the default OTLP traces path to endpoints without one.
+func endpointURL(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil || (u.Path != "" && u.Path != "/") {
+		return endpoint
+	}
+	u.Path = "/v1/traces"
+	return u.String()
+}
+
+func sampler(cfg config.TracingConfig) sdktrace.Sampler {
+	switch cfg.Sampler {
+	case config.SamplerAlwaysOn:
+		return sdktrace.AlwaysSample()
+	case config.SamplerAlwaysOff:
+		return sdktrace.NeverSample()
+	case config.SamplerTraceIDRatio:
+		return sdktrace.TraceIDRatioBased(cfg.SamplerRatio)
+	case config.SamplerParentBasedAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample())
+	case config.SamplerParentBasedTraceIDRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SamplerRatio))
+	default:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample())
+	}
+}
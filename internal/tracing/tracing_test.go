@@ -0,0 +1,32 @@
+package tracing
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestEndpointURL(t *testing.T) {
+	assert.Equal(t, "http://collector:4318/v1/traces", endpointURL("http://collector:4318"))
+	assert.Equal(t, "http://collector:4318/v1/traces", endpointURL("http://collector:4318/"))
+	assert.Equal(t, "https://otlp.example.com/otel/v1/traces", endpointURL("https://otlp.example.com/otel/v1/traces"))
+}
+
+func TestContextFromEnv(t *testing.T) {
+	t.Setenv("TRACEPARENT", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	t.Setenv("TRACESTATE", "vendor=value")
+
+	sc := trace.SpanContextFromContext(ContextFromEnv(context.Background()))
+	assert.True(t, sc.IsRemote())
+	assert.True(t, sc.IsSampled())
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID().String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID().String())
+	assert.Equal(t, "vendor=value", sc.TraceState().String())
+}
+
+func TestContextFromEnvWithoutParent(t *testing.T) {
+	t.Setenv("TRACEPARENT", "")
+	assert.False(t, trace.SpanContextFromContext(ContextFromEnv(context.Background())).IsValid())
+}
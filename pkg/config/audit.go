@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// AuditConfig controls the audit log of mutating provider actions.
+type AuditConfig struct {
+	// Path of the JSON-lines audit log. Entries are only ever appended.
+	// Auditing is disabled if empty.
+	Path string `koanf:"path"`
+	// HMACKeyFile is a file holding a secret key. If set, each entry carries
+	// an HMAC over itself and the previous entry's HMAC, so that editing or
+	// removing entries breaks the chain. See the "verify-audit" command.
+	HMACKeyFile string `koanf:"hmac_key_file"`
+}
+
+// Enabled reports whether actions are audited.
+func (c AuditConfig) Enabled() bool {
+	return c.Path != ""
+}
+
+// Validate checks the audit settings.
+func (c AuditConfig) Validate() error {
+	if c.Path != "" && !filepath.IsAbs(c.Path) {
+		return fmt.Errorf("path %q must be an absolute path", c.Path)
+	}
+	if c.HMACKeyFile != "" {
+		if c.Path == "" {
+			return fmt.Errorf("hmac_key_file requires a path")
+		}
+		if !filepath.IsAbs(c.HMACKeyFile) {
+			return fmt.Errorf("hmac_key_file %q must be an absolute path", c.HMACKeyFile)
+		}
+	}
+	return nil
+}
@@ -2,64 +2,570 @@ package config
 
 import (
 	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/knadh/koanf/parsers/toml/v2"
 	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/env/v2"
 	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/providers/structs"
 	"github.com/knadh/koanf/v2"
 )
 
-var Config ProviderConfig
+// DinDMode selects how runners get access to a Docker daemon.
+type DinDMode string
 
+const (
+	// DinDModeSysbox runs an inner Docker daemon under the Sysbox runtime.
+	DinDModeSysbox DinDMode = "sysbox"
+	// DinDModePrivileged runs an inner Docker daemon in a privileged container.
+	DinDModePrivileged DinDMode = "privileged"
+	// DinDModeRootless runs a rootless inner Docker daemon using user namespaces.
+	DinDModeRootless DinDMode = "rootless"
+	// DinDModeSocket binds the host Docker socket into the runner.
+	DinDModeSocket DinDMode = "socket"
+	// DinDModeNone gives runners no access to Docker.
+	DinDModeNone DinDMode = "none"
+)
+
+// SysboxRuntime is the container runtime provided by Sysbox.
+const SysboxRuntime = "sysbox-runc"
+
+var dockerHostSchemes = []string{"unix", "tcp", "http", "https", "ssh", "npipe"}
+
+// ProviderConfig is the config of a provider, as loaded by NewConfig.
 type ProviderConfig struct {
 	DockerHost string `koanf:"docker_host"`
+	// Log controls the provider's own logs.
+	Log LogConfig `koanf:"log"`
 	// Runtime to use for the container (e.g., "sysbox-runc", "runc")
-	// Defaults to "sysbox-runc" if not set.
+	// Defaults to "sysbox-runc" in sysbox mode and "runc" otherwise.
 	Runtime string `koanf:"runtime"`
 	// Network to attach the container to. Defaults to "bridge".
 	Network string `koanf:"network"`
 	// RemoveVolumes indicates whether to remove volumes when deleting the container.
 	RemoveVolumes bool `koanf:"remove_volumes"`
+	// DinDMode selects the Docker-in-Docker strategy. If not set, it is derived
+	// from Privileged and Runtime: "privileged" if Privileged is set, "sysbox"
+	// if the runtime is sysbox-runc and "none" otherwise.
+	DinDMode DinDMode `koanf:"dind_mode"`
 	// Privileged runs the container in privileged mode.
-	// Required for Docker-in-Docker without Sysbox.
+	// Deprecated: use dind_mode "privileged" instead.
 	Privileged bool `koanf:"privileged"`
+	// DockerSocketPath is the host Docker socket bound into runners in "socket"
+	// mode. Defaults to "/var/run/docker.sock".
+	DockerSocketPath string `koanf:"docker_socket_path"`
+	// SocketProxy puts a filtering proxy between runners and the Docker socket
+	// in "socket" mode.
+	SocketProxy SocketProxyConfig `koanf:"socket_proxy"`
+	// RootlessDataRoot is the data root of the inner Docker daemon in "rootless"
+	// mode. Defaults to the one used by the docker:dind-rootless image.
+	RootlessDataRoot string `koanf:"rootless_data_root"`
 	// Binds are bind mounts to add to all containers (e.g., "/host/path:/container/path:ro")
 	Binds []string `koanf:"binds"`
+	// Mounts are typed bind, volume, tmpfs and image mounts added to all containers.
+	Mounts []MountConfig `koanf:"mounts"`
+	// AllowedHostPaths lists the host directories bind mount sources must live in.
+	// If empty, bind mounts are only accepted from the provider config, not from
+	// pool extra specs.
+	AllowedHostPaths []string `koanf:"allowed_host_paths"`
+	// AllowedVolumes lists glob patterns of the named volumes pool extra specs
+	// may mount, e.g. "cache-*". Extra specs can always mount anonymous
+	// volumes.
+	AllowedVolumes []string `koanf:"allowed_volumes"`
+	// Security hardens runner containers. Pools can override it in extra specs.
+	Security SecurityConfig `koanf:"security"`
 	// AlwaysPull forces pulling the image before each container creation.
 	// Useful to ensure runners always use the latest image.
 	AlwaysPull bool `koanf:"always_pull"`
 	// DockerConfigPath is the path to a Docker config.json file for registry auth.
 	// If not set, defaults to ~/.docker/config.json
 	DockerConfigPath string `koanf:"docker_config_path"`
+	// Registries holds registry credentials and mirrors by image prefix.
+	// Credentials found here take precedence over the Docker config file.
+	Registries []RegistryConfig `koanf:"registries"`
+	// ImagePolicy restricts the runner images pools may use and verifies
+	// their signatures.
+	ImagePolicy ImagePolicyConfig `koanf:"image_policy"`
+	// Drain asks running runners to finish their job before they are stopped
+	// or deleted. Pools can override it in extra specs.
+	Drain DrainConfig `koanf:"drain"`
+	// Healthcheck is the Docker HEALTHCHECK of runner containers. Pools can
+	// override it in extra specs.
+	Healthcheck HealthcheckConfig `koanf:"healthcheck"`
+	// Lifecycle controls how long runners live and whether they are
+	// restarted. Pools can override it in extra specs.
+	Lifecycle LifecycleConfig `koanf:"lifecycle"`
+	// Hooks run site-specific actions around the runner lifecycle.
+	Hooks HooksConfig `koanf:"hooks"`
+	// Audit records every mutating action in an append-only log.
+	Audit AuditConfig `koanf:"audit"`
+	// LogArchive archives the logs of runners before they are deleted.
+	LogArchive LogArchiveConfig `koanf:"log_archive"`
+	// Readiness makes CreateInstance wait until the runner is up.
+	Readiness ReadinessConfig `koanf:"readiness"`
+	// Reaper removes finished and stuck runner containers. See the "reap" command.
+	Reaper ReaperConfig `koanf:"reaper"`
+	// ImageGC removes old runner images. See the "image-gc" command.
+	ImageGC ImageGCConfig `koanf:"image_gc"`
+	// DinDCache warms up the inner Docker daemon of each runner so that
+	// jobs don't start with an empty image cache.
+	DinDCache DinDCacheConfig `koanf:"dind_cache"`
+	// Metrics emits Prometheus metrics of each provider invocation.
+	Metrics MetricsConfig `koanf:"metrics"`
+	// Tracing exports OpenTelemetry traces of each provider invocation.
+	Tracing TracingConfig `koanf:"tracing"`
+}
+
+// ReaperConfig controls which runner containers the reaper removes.
+type ReaperConfig struct {
+	// ExitedGracePeriod is how long an exited runner container is kept
+	// before it is removed. Defaults to 10m.
+	ExitedGracePeriod time.Duration `koanf:"exited_grace_period"`
+	// RegistrationTimeout is how long a runner may take to register with
+	// GitHub before it is considered stuck and removed. 0 disables the check.
+	RegistrationTimeout time.Duration `koanf:"registration_timeout"`
+	// RegisteredPattern is a regular expression matched against the runner's
+	// logs to tell whether it registered. Defaults to "Listening for Jobs".
+	RegisteredPattern string `koanf:"registered_pattern"`
+	// Interval between passes when the reaper runs continuously. Defaults to 1m.
+	Interval time.Duration `koanf:"interval"`
+}
+
+// ReadinessConfig controls how CreateInstance checks that a runner came up.
+// The check is disabled unless at least one condition is set.
+type ReadinessConfig struct {
+	// SettlePeriod is how long the runner must keep running after start.
+	SettlePeriod time.Duration `koanf:"settle_period"`
+	// WaitHealthy waits until the container's HEALTHCHECK reports healthy.
+	WaitHealthy bool `koanf:"wait_healthy"`
+	// LogPattern is a regular expression the runner's logs must match,
+	// e.g. "Listening for Jobs".
+	LogPattern string `koanf:"log_pattern"`
+	// Timeout bounds the whole check. Defaults to 2m.
+	Timeout time.Duration `koanf:"timeout"`
+	// LogTail is the number of log lines included in the error if the check
+	// fails. Defaults to 50.
+	LogTail int `koanf:"log_tail"`
 }
 
-func NewConfig(path string) error {
+// Enabled reports whether CreateInstance waits for readiness.
+func (r ReadinessConfig) Enabled() bool {
+	return r.SettlePeriod > 0 || r.WaitHealthy || r.LogPattern != ""
+}
+
+// SocketProxyConfig configures the per-runner Docker socket proxy.
+type SocketProxyConfig struct {
+	// Enabled starts a proxy sidecar for each runner instead of binding the
+	// Docker socket directly.
+	Enabled bool `koanf:"enabled"`
+	// Image of the proxy sidecar. Its entrypoint must be the
+	// garm-provider-docker binary.
+	Image string `koanf:"image"`
+	// AllowedEndpoints replaces the default API allow-list. Each entry has
+	// the form "METHOD /path-regex", e.g. "GET /containers/json".
+	AllowedEndpoints []string `koanf:"allowed_endpoints"`
+}
+
+// DinDCacheConfig controls how the inner Docker daemon of a runner is
+// pre-populated before the runner container is started.
+type DinDCacheConfig struct {
+	// SeedVolume is the name of a template volume whose contents are copied
+	// into the runner's /var/lib/docker volume. Only used in privileged mode.
+	SeedVolume string `koanf:"seed_volume"`
+	// SeedTarball is a host path to a tar archive of a Docker data root
+	// (e.g., created with "tar -C /var/lib/docker -cf cache.tar .") that is
+	// extracted into the runner's /var/lib/docker volume. Only used in
+	// privileged mode.
+	SeedTarball string `koanf:"seed_tarball"`
+	// SeederImage is the image of the short-lived helper container that
+	// copies the seed into the volume. Defaults to "busybox:latest".
+	SeederImage string `koanf:"seeder_image"`
+	// SeedTimeout bounds how long the seeder container may run. On timeout
+	// the seeder and the runner container are removed. Defaults to 10m.
+	SeedTimeout time.Duration `koanf:"seed_timeout"`
+	// RegistryMirrors are added to the inner Docker daemon's daemon.json
+	// inside the runner so it pulls through a shared mirror. The file is
+	// /etc/docker/daemon.json, or ~/.config/docker/daemon.json of the
+	// rootless user in "rootless" mode.
+	RegistryMirrors []string `koanf:"registry_mirrors"`
+}
+
+// EnvPrefix is the prefix of environment variables that override config
+// keys. Nested keys are separated by a double underscore, e.g.
+// GARM_DOCKER_LOG__LEVEL sets log.level.
+const EnvPrefix = "GARM_DOCKER_"
+
+// ConfDir is the directory next to the main config file whose *.yaml, *.yml
+// and *.toml files are merged on top of it, in lexical order.
+const ConfDir = "conf.d"
+
+// NewConfig loads the config in layers: the file at path, the files in the
+// conf.d directory next to it, and GARM_DOCKER_* environment variables. Each
+// layer overrides the keys it sets. Defaults are applied to whatever is left
+// unset.
+func NewConfig(path string) (*ProviderConfig, error) {
 	k := koanf.New(".")
 	if path != "" {
-		if err := k.Load(file.Provider(path), yaml.Parser()); err != nil {
-			return fmt.Errorf("failed to load config: %w", err)
+		if err := loadFile(k, path); err != nil {
+			return nil, err
+		}
+		files, err := confDFiles(filepath.Join(filepath.Dir(path), ConfDir))
+		if err != nil {
+			return nil, err
 		}
+		for _, f := range files {
+			if err := loadFile(k, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	envProvider := env.Provider(".", env.Opt{
+		Prefix: EnvPrefix,
+		TransformFunc: func(key, value string) (string, any) {
+			key = strings.ToLower(strings.TrimPrefix(key, EnvPrefix))
+			return strings.ReplaceAll(key, "__", "."), value
+		},
+	})
+	if err := k.Load(envProvider, nil); err != nil {
+		return nil, fmt.Errorf("failed to load config from environment: %w", err)
+	}
+
+	// Unknown keys are errors, so that a typo doesn't silently fall back
+	// to the default
+	var (
+		cfg  ProviderConfig
+		meta mapstructure.Metadata
+	)
+	err := k.UnmarshalWithConf("", &cfg, koanf.UnmarshalConf{
+		DecoderConfig: &mapstructure.DecoderConfig{
+			DecodeHook: mapstructure.ComposeDecodeHookFunc(
+				secretHookFunc(),
+				mapstructure.StringToTimeDurationHookFunc(),
+				mapstructure.TextUnmarshallerHookFunc()),
+			Metadata:         &meta,
+			WeaklyTypedInput: true,
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal config: %w", err)
+	}
+	if len(meta.Unused) > 0 {
+		sort.Strings(meta.Unused)
+		return nil, fmt.Errorf("unknown config keys: %s", strings.Join(meta.Unused, ", "))
 	}
 
-	if err := k.Unmarshal("", &Config); err != nil {
-		return fmt.Errorf("failed to unmarshal config: %w", err)
+	cfg.setDefaults()
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
+	return &cfg, nil
+}
 
-	setDefaults()
+// Marshal returns the effective config as YAML, with secrets redacted.
+func (c *ProviderConfig) Marshal() ([]byte, error) {
+	k := koanf.New(".")
+	if err := k.Load(structs.Provider(c, "koanf"), nil); err != nil {
+		return nil, fmt.Errorf("failed to load config: %w", err)
+	}
+	data, err := k.Marshal(yaml.Parser())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal config: %w", err)
+	}
+	return data, nil
+}
+
+// loadFile merges a YAML or TOML file, chosen by its extension, into k.
+func loadFile(k *koanf.Koanf, path string) error {
+	var parser koanf.Parser = yaml.Parser()
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		parser = toml.Parser()
+	}
+	if err := k.Load(file.Provider(path), parser); err != nil {
+		return fmt.Errorf("failed to load config %s: %w", path, err)
+	}
+	return nil
+}
+
+// confDFiles returns the config files in dir, sorted. A missing directory
+// has no files.
+func confDFiles(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	var files []string
+	for _, e := range entries {
+		switch strings.ToLower(filepath.Ext(e.Name())) {
+		case ".yaml", ".yml", ".toml":
+			if !e.IsDir() {
+				files = append(files, filepath.Join(dir, e.Name()))
+			}
+		}
+	}
+	return files, nil
+}
+
+// Validate checks the config for settings that can't work together.
+func (c *ProviderConfig) Validate() error {
+	if c.DockerHost != "" {
+		if u, err := url.Parse(c.DockerHost); err != nil || !slices.Contains(dockerHostSchemes, u.Scheme) {
+			return fmt.Errorf("docker_host %q must be a unix, tcp, http, https, ssh or npipe URL", c.DockerHost)
+		}
+	}
+	if err := c.Log.Validate(); err != nil {
+		return fmt.Errorf("log: %w", err)
+	}
+	switch c.DinDMode {
+	case DinDModeSysbox:
+		if c.Runtime != SysboxRuntime {
+			return fmt.Errorf("dind_mode %q requires runtime %q, got %q", c.DinDMode, SysboxRuntime, c.Runtime)
+		}
+	case DinDModePrivileged:
+		if c.Runtime == SysboxRuntime {
+			return fmt.Errorf("dind_mode %q can't be used with runtime %q, sysbox does not support privileged containers", c.DinDMode, SysboxRuntime)
+		}
+	case DinDModeRootless, DinDModeNone:
+	case DinDModeSocket:
+		if !filepath.IsAbs(c.DockerSocketPath) {
+			return fmt.Errorf("docker_socket_path %q must be an absolute path", c.DockerSocketPath)
+		}
+	default:
+		return fmt.Errorf("unknown dind_mode %q", c.DinDMode)
+	}
+	if c.SocketProxy.Enabled {
+		if c.DinDMode != DinDModeSocket {
+			return fmt.Errorf("socket_proxy requires dind_mode %q, got %q", DinDModeSocket, c.DinDMode)
+		}
+		if c.SocketProxy.Image == "" {
+			return fmt.Errorf("socket_proxy: image is required")
+		}
+	}
+	if c.Privileged && c.DinDMode != DinDModePrivileged {
+		return fmt.Errorf("privileged can't be combined with dind_mode %q, use dind_mode %q instead", c.DinDMode, DinDModePrivileged)
+	}
+
+	if c.DinDCache.SeedVolume != "" && c.DinDCache.SeedTarball != "" {
+		return fmt.Errorf("dind_cache: seed_volume and seed_tarball are mutually exclusive")
+	}
+	// The seeder copies the seed as root, which a rootless daemon can't
+	// use, since its data root is owned by a subordinate UID range
+	if (c.DinDCache.SeedVolume != "" || c.DinDCache.SeedTarball != "") && c.DinDMode != DinDModePrivileged {
+		return fmt.Errorf("dind_cache: seeding requires dind_mode %q, got %q", DinDModePrivileged, c.DinDMode)
+	}
+	if len(c.DinDCache.RegistryMirrors) > 0 && (c.DinDMode == DinDModeSocket || c.DinDMode == DinDModeNone) {
+		return fmt.Errorf("dind_cache: registry_mirrors requires an inner Docker daemon, but dind_mode is %q", c.DinDMode)
+	}
+	if _, ok := c.RootlessHome(); len(c.DinDCache.RegistryMirrors) > 0 && c.DinDMode == DinDModeRootless && !ok {
+		return fmt.Errorf("dind_cache: registry_mirrors in rootless mode requires a rootless_data_root of the form <home>/.local/share/docker, got %q", c.RootlessDataRoot)
+	}
+	if err := c.Drain.Validate(); err != nil {
+		return fmt.Errorf("drain: %w", err)
+	}
+	if err := c.Healthcheck.Validate(); err != nil {
+		return fmt.Errorf("healthcheck: %w", err)
+	}
+	if err := c.Lifecycle.Validate(); err != nil {
+		return fmt.Errorf("lifecycle: %w", err)
+	}
+	if err := c.Hooks.Validate(); err != nil {
+		return fmt.Errorf("hooks: %w", err)
+	}
+	if err := c.Audit.Validate(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	if err := c.LogArchive.Validate(); err != nil {
+		return fmt.Errorf("log_archive: %w", err)
+	}
+	if err := c.Metrics.Validate(); err != nil {
+		return fmt.Errorf("metrics: %w", err)
+	}
+	if err := c.Tracing.Validate(); err != nil {
+		return fmt.Errorf("tracing: %w", err)
+	}
+	if _, err := regexp.Compile(c.Readiness.LogPattern); err != nil {
+		return fmt.Errorf("readiness: invalid log_pattern: %w", err)
+	}
+	if c.Readiness.Enabled() && c.Readiness.SettlePeriod >= c.Readiness.Timeout {
+		return fmt.Errorf("readiness: settle_period must be shorter than timeout")
+	}
+	if _, err := regexp.Compile(c.Reaper.RegisteredPattern); err != nil {
+		return fmt.Errorf("reaper: invalid registered_pattern: %w", err)
+	}
+	if err := c.Security.Validate(c.DinDMode); err != nil {
+		return fmt.Errorf("security: %w", err)
+	}
+	for _, p := range c.AllowedHostPaths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("allowed_host_paths: %q is not an absolute path", p)
+		}
+	}
+	for _, pattern := range c.AllowedVolumes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("allowed_volumes: invalid pattern %q: %w", pattern, err)
+		}
+	}
+	for i, r := range c.Registries {
+		if err := r.Validate(); err != nil {
+			return fmt.Errorf("registries[%d]: %w", i, err)
+		}
+	}
+	if err := c.ImagePolicy.Validate(); err != nil {
+		return fmt.Errorf("image_policy: %w", err)
+	}
+	if err := c.ImageGC.Validate(); err != nil {
+		return fmt.Errorf("image_gc: %w", err)
+	}
+	for i, b := range c.Binds {
+		if err := ValidateBind(b); err != nil {
+			return fmt.Errorf("binds[%d]: %w", i, err)
+		}
+	}
+	for i, m := range c.Mounts {
+		if err := m.Validate(); err != nil {
+			return fmt.Errorf("mounts[%d]: %w", i, err)
+		}
+		if err := c.CheckMount(m, false); err != nil {
+			return fmt.Errorf("mounts[%d]: %w", i, err)
+		}
+	}
 	return nil
 }
 
-func setDefaults() {
-	if Config.DockerHost == "" {
-		Config.DockerHost = "unix:///var/run/docker.sock"
+// RootlessHome returns the home directory of the rootless inner daemon's
+// user, derived from RootlessDataRoot, which is ~/.local/share/docker by
+// default. It reports false if the data root is elsewhere.
+func (c *ProviderConfig) RootlessHome() (string, bool) {
+	home, ok := strings.CutSuffix(filepath.Clean(c.RootlessDataRoot), "/.local/share/docker")
+	return home, ok && home != ""
+}
+
+// setDefaults fills in the settings left unset.
+func (c *ProviderConfig) setDefaults() {
+	if c.DockerHost == "" {
+		c.DockerHost = "unix:///var/run/docker.sock"
+	}
+	if c.Log.Level == "" {
+		c.Log.Level = "info"
+	}
+	if c.Log.Format == "" {
+		c.Log.Format = "text"
+	}
+	if c.Log.Output == "" {
+		c.Log.Output = LogOutputStderr
+	}
+	if c.Log.File.MaxSizeMB == 0 {
+		c.Log.File.MaxSizeMB = 100
+	}
+	if c.Log.File.MaxBackups == 0 {
+		c.Log.File.MaxBackups = 5
+	}
+	if c.Log.Syslog.Network == "" {
+		c.Log.Syslog.Network = "unixgram"
+	}
+	if c.Log.Syslog.Address == "" {
+		c.Log.Syslog.Address = "/dev/log"
+	}
+	if c.Log.Syslog.Tag == "" {
+		c.Log.Syslog.Tag = "garm-provider-docker"
+	}
+	if c.DinDMode == "" {
+		switch {
+		case c.Privileged:
+			c.DinDMode = DinDModePrivileged
+		case c.Runtime == "" || c.Runtime == SysboxRuntime:
+			c.DinDMode = DinDModeSysbox
+		default:
+			c.DinDMode = DinDModeNone
+		}
+	}
+	if c.Runtime == "" {
+		if c.DinDMode == DinDModeSysbox {
+			c.Runtime = SysboxRuntime
+		} else {
+			c.Runtime = "runc"
+		}
+	}
+	if c.ImagePolicy.RequireDigest == "" {
+		c.ImagePolicy.RequireDigest = DigestPolicyNever
+	}
+	if c.ImagePolicy.Signature.Timeout == 0 {
+		c.ImagePolicy.Signature.Timeout = 30 * time.Second
+	}
+	if c.DockerSocketPath == "" {
+		c.DockerSocketPath = "/var/run/docker.sock"
+	}
+	if c.RootlessDataRoot == "" {
+		c.RootlessDataRoot = "/home/rootless/.local/share/docker"
+	}
+	if c.Network == "" {
+		c.Network = "bridge"
+	}
+	if c.Reaper.ExitedGracePeriod == 0 {
+		c.Reaper.ExitedGracePeriod = 10 * time.Minute
+	}
+	if c.Reaper.RegisteredPattern == "" {
+		c.Reaper.RegisteredPattern = "Listening for Jobs"
+	}
+	if c.Reaper.Interval == 0 {
+		c.Reaper.Interval = time.Minute
+	}
+	if c.Readiness.Timeout == 0 {
+		c.Readiness.Timeout = 2 * time.Minute
+	}
+	if c.Readiness.LogTail == 0 {
+		c.Readiness.LogTail = 50
+	}
+	if c.LogArchive.Timeout == 0 {
+		c.LogArchive.Timeout = time.Minute
+	}
+	if c.LogArchive.S3.MaxSizeMB == 0 {
+		c.LogArchive.S3.MaxSizeMB = 100
+	}
+	if c.LogArchive.S3.Region == "" {
+		c.LogArchive.S3.Region = "us-east-1"
+	}
+	if c.Metrics.Job == "" {
+		c.Metrics.Job = "garm-provider-docker"
+	}
+	if c.ImageGC.LockPath == "" {
+		c.ImageGC.LockPath = filepath.Join(os.TempDir(), "garm-provider-docker-images.lock")
+	}
+	if c.Metrics.Instance == "" {
+		c.Metrics.Instance, _ = os.Hostname()
+	}
+	if c.Metrics.Timeout == 0 {
+		c.Metrics.Timeout = 5 * time.Second
+	}
+	if c.Tracing.Sampler == "" {
+		c.Tracing.Sampler = SamplerParentBasedAlwaysOn
+	}
+	if c.Tracing.ServiceName == "" {
+		c.Tracing.ServiceName = "garm-provider-docker"
+	}
+	if c.Tracing.Timeout == 0 {
+		c.Tracing.Timeout = 5 * time.Second
 	}
-	if Config.Runtime == "" {
-		Config.Runtime = "sysbox-runc"
+	if c.DinDCache.SeederImage == "" {
+		c.DinDCache.SeederImage = "busybox:latest"
 	}
-	if Config.Network == "" {
-		Config.Network = "bridge"
+	if c.DinDCache.SeedTimeout == 0 {
+		c.DinDCache.SeedTimeout = 10 * time.Minute
 	}
 	// Default to removing volumes to keep things clean
-	if !Config.RemoveVolumes {
-		Config.RemoveVolumes = true
+	if !c.RemoveVolumes {
+		c.RemoveVolumes = true
 	}
 }
@@ -0,0 +1,583 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetDefaultsDerivesDinDMode(t *testing.T) {
+	tests := []struct {
+		name        string
+		cfg         ProviderConfig
+		wantMode    DinDMode
+		wantRuntime string
+	}{
+		{name: "default", wantMode: DinDModeSysbox, wantRuntime: SysboxRuntime},
+		{name: "legacy privileged", cfg: ProviderConfig{Privileged: true}, wantMode: DinDModePrivileged, wantRuntime: "runc"},
+		{name: "custom runtime", cfg: ProviderConfig{Runtime: "kata"}, wantMode: DinDModeNone, wantRuntime: "kata"},
+		{name: "explicit mode", cfg: ProviderConfig{DinDMode: DinDModeRootless}, wantMode: DinDModeRootless, wantRuntime: "runc"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			cfg := tc.cfg
+			cfg.setDefaults()
+			assert.Equal(t, tc.wantMode, cfg.DinDMode)
+			assert.Equal(t, tc.wantRuntime, cfg.Runtime)
+			assert.NoError(t, cfg.Validate())
+		})
+	}
+}
+
+func TestValidateRejectsIncompatibleDinDSettings(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     ProviderConfig
+		wantErr string
+	}{
+		{
+			name:    "sysbox with runc",
+			cfg:     ProviderConfig{DinDMode: DinDModeSysbox, Runtime: "runc"},
+			wantErr: "requires runtime",
+		},
+		{
+			name:    "privileged with sysbox runtime",
+			cfg:     ProviderConfig{DinDMode: DinDModePrivileged, Runtime: SysboxRuntime},
+			wantErr: "does not support privileged",
+		},
+		{
+			name:    "privileged flag with socket mode",
+			cfg:     ProviderConfig{DinDMode: DinDModeSocket, DockerSocketPath: "/var/run/docker.sock", Privileged: true},
+			wantErr: "privileged can't be combined",
+		},
+		{
+			name:    "seeding without data root",
+			cfg:     ProviderConfig{DinDMode: DinDModeNone, DinDCache: DinDCacheConfig{SeedVolume: "template"}},
+			wantErr: "seeding requires",
+		},
+		{
+			name:    "seeding in rootless mode",
+			cfg:     ProviderConfig{DinDMode: DinDModeRootless, RootlessDataRoot: "/home/rootless/.local/share/docker", DinDCache: DinDCacheConfig{SeedTarball: "/srv/cache.tar"}},
+			wantErr: "seeding requires",
+		},
+		{
+			name:    "mirrors without inner daemon",
+			cfg:     ProviderConfig{DinDMode: DinDModeSocket, DockerSocketPath: "/var/run/docker.sock", DinDCache: DinDCacheConfig{RegistryMirrors: []string{"https://mirror"}}},
+			wantErr: "requires an inner Docker daemon",
+		},
+		{
+			name:    "rootless mirrors with custom data root",
+			cfg:     ProviderConfig{DinDMode: DinDModeRootless, RootlessDataRoot: "/data/docker", DinDCache: DinDCacheConfig{RegistryMirrors: []string{"https://mirror"}}},
+			wantErr: "<home>/.local/share/docker",
+		},
+		{
+			name:    "unknown mode",
+			cfg:     ProviderConfig{DinDMode: "vm"},
+			wantErr: "unknown dind_mode",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorContains(t, tc.cfg.Validate(), tc.wantErr)
+		})
+	}
+}
+
+func TestSecurityValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		sec     SecurityConfig
+		mode    DinDMode
+		wantErr string
+	}{
+		{name: "hardened", sec: SecurityConfig{CapDrop: []string{"ALL"}, CapAdd: []string{"CHOWN"}}, mode: DinDModeSysbox},
+		{name: "dangerous capability", sec: SecurityConfig{CapAdd: []string{"cap_sys_admin"}}, mode: DinDModeSysbox, wantErr: "SYS_ADMIN"},
+		{name: "dangerous allowed", sec: SecurityConfig{CapAdd: []string{"SYS_ADMIN"}, AllowDangerous: true}, mode: DinDModeSysbox},
+		{name: "dangerous capability for pools", sec: SecurityConfig{AllowedCapabilities: []string{"sys_admin"}, AllowDangerous: true}, mode: DinDModeSysbox, wantErr: "can't be allowed for pools"},
+		{name: "unconfined seccomp", sec: SecurityConfig{SeccompProfile: "unconfined"}, mode: DinDModeNone, wantErr: "dangerous"},
+		{name: "host userns in privileged mode", sec: SecurityConfig{UsernsMode: "host"}, mode: DinDModePrivileged, wantErr: "dangerous"},
+		{name: "capabilities in privileged mode", sec: SecurityConfig{CapDrop: []string{"ALL"}}, mode: DinDModePrivileged, wantErr: "no effect"},
+		{name: "apparmor in rootless mode", sec: SecurityConfig{AppArmorProfile: "docker-default"}, mode: DinDModeRootless, wantErr: "runs unconfined"},
+		{name: "writable paths without read-only rootfs", sec: SecurityConfig{WritablePaths: []string{"/tmp"}}, mode: DinDModeNone, wantErr: "requires read_only_rootfs"},
+		{name: "missing seccomp profile", sec: SecurityConfig{SeccompProfile: "/does/not/exist.json"}, mode: DinDModeNone, wantErr: "seccomp_profile"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.sec.Validate(tc.mode)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewConfigDecodesDrain(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+dind_mode: none
+drain:
+  signal: SIGINT
+  timeout: 5m
+  stop_timeout: 30s
+`), 0o644))
+
+	cfg, err := NewConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "SIGINT", cfg.Drain.Signal)
+	assert.Equal(t, 5*time.Minute, cfg.Drain.DrainTimeout())
+	assert.Equal(t, 30*time.Second, *cfg.Drain.StopTimeout)
+}
+
+func TestDrainValidate(t *testing.T) {
+	minute := time.Minute
+	negative := -time.Second
+	tests := []struct {
+		name    string
+		drain   DrainConfig
+		wantErr string
+	}{
+		{name: "signal", drain: DrainConfig{Signal: "SIGINT", Timeout: &minute}},
+		{name: "stop settings only", drain: DrainConfig{StopSignal: "SIGINT", StopTimeout: &minute}},
+		{name: "timeout without signal or command", drain: DrainConfig{Timeout: &minute}, wantErr: "requires a signal or command"},
+		{name: "signal and command", drain: DrainConfig{Signal: "SIGINT", Command: []string{"true"}, Timeout: &minute}, wantErr: "mutually exclusive"},
+		{name: "negative stop timeout", drain: DrainConfig{StopTimeout: &negative}, wantErr: "can't be negative"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.drain.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestHooksValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		hooks   HooksConfig
+		wantErr string
+	}{
+		{name: "valid", hooks: HooksConfig{PreCreate: []HookConfig{{Command: []string{"/bin/true"}}}, PreStop: []HookConfig{{Exec: []string{"true"}, OnFailure: HookFailureAbort}}}},
+		{name: "empty hook", hooks: HooksConfig{PostStart: []HookConfig{{}}}, wantErr: "post_start[0]: command or exec is required"},
+		{name: "exec before create", hooks: HooksConfig{PreCreate: []HookConfig{{Exec: []string{"true"}}}}, wantErr: "before the container exists"},
+		{name: "unknown policy", hooks: HooksConfig{PreDelete: []HookConfig{{Command: []string{"true"}, OnFailure: "retry"}}}, wantErr: "unknown on_failure"},
+		{name: "abort before delete", hooks: HooksConfig{PreDelete: []HookConfig{{Command: []string{"true"}, OnFailure: HookFailureAbort}}}, wantErr: "pre_delete[0]: on_failure abort can't be used"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.hooks.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestTracingValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		tracing TracingConfig
+		wantErr string
+	}{
+		{name: "disabled", tracing: TracingConfig{}},
+		{name: "endpoint", tracing: TracingConfig{Endpoint: "http://collector:4318", Sampler: SamplerParentBasedAlwaysOn}},
+		{name: "ratio", tracing: TracingConfig{Endpoint: "https://collector", Sampler: SamplerTraceIDRatio, SamplerRatio: 0.1}},
+		{name: "ratio missing", tracing: TracingConfig{Sampler: SamplerParentBasedTraceIDRatio}, wantErr: "requires a sampler_ratio"},
+		{name: "unknown sampler", tracing: TracingConfig{Sampler: "sometimes"}, wantErr: "unknown sampler"},
+		{name: "grpc endpoint", tracing: TracingConfig{Endpoint: "collector:4317"}, wantErr: "must be an http or https URL"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			err := tc.tracing.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewConfigRejectsUnknownKeys(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+dind_mode: none
+remove_volume: true
+drain:
+  signall: SIGINT
+mounts:
+  - type: tmpfs
+    target: /tmp
+    sise: 64m
+`), 0o644))
+
+	_, err := NewConfig(path)
+	assert.EqualError(t, err, "unknown config keys: drain.signall, mounts[0].sise, remove_volume")
+}
+
+func TestValidateBind(t *testing.T) {
+	tests := []struct {
+		bind    string
+		wantErr string
+	}{
+		{bind: "/var/cache:/cache"},
+		{bind: "cache-volume:/cache:ro,rslave"},
+		{bind: "c:/cache"},
+		{bind: "/var/cache:/cache:cached,U"},
+		{bind: "/var/cache:/cache:rw,delegated,z"},
+		{bind: "/var/cache:/cache:consistent,nocopy"},
+		{bind: "/var/cache", wantErr: "must have the form source:target"},
+		{bind: "relative/path:/cache", wantErr: "absolute path or a volume name"},
+		{bind: "/var/cache:cache", wantErr: "target \"cache\" must be an absolute path"},
+		{bind: "/var/cache:/cache:readonly", wantErr: "unknown option \"readonly\""},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.bind, func(t *testing.T) {
+			err := ValidateBind(tc.bind)
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsHostPathAllowedResolvesSymlinks(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	allowed := filepath.Join(dir, "allowed")
+	require.NoError(t, os.Mkdir(allowed, 0o755))
+	require.NoError(t, os.Symlink("/etc", filepath.Join(allowed, "escape")))
+	require.NoError(t, os.Symlink(allowed, filepath.Join(dir, "link")))
+	cfg := &ProviderConfig{AllowedHostPaths: []string{allowed}}
+
+	assert.True(t, cfg.IsHostPathAllowed(filepath.Join(allowed, "cache")))
+	assert.True(t, cfg.IsHostPathAllowed(filepath.Join(allowed, "missing/cache")))
+	assert.True(t, cfg.IsHostPathAllowed(filepath.Join(dir, "link", "cache")))
+	assert.False(t, cfg.IsHostPathAllowed(filepath.Join(allowed, "escape")))
+	assert.False(t, cfg.IsHostPathAllowed(filepath.Join(allowed, "escape", "missing")))
+	assert.False(t, cfg.IsHostPathAllowed(filepath.Join(allowed, "..")))
+}
+
+func TestNewConfigLayers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+docker_host: "unix:///var/run/docker.sock"
+dind_mode: none
+network: bridge
+log:
+  level: info
+  format: json
+`), 0o644))
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ConfDir), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ConfDir, "10-network.yml"), []byte("network: runners\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ConfDir, "20-log.toml"), []byte("[log]\nlevel = \"warn\"\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, ConfDir, "README.md"), []byte("ignored"), 0o644))
+	t.Setenv("GARM_DOCKER_DOCKER_HOST", "tcp://docker:2375")
+	t.Setenv("GARM_DOCKER_LOG__LEVEL", "debug")
+	t.Setenv("GARM_DOCKER_ALWAYS_PULL", "true")
+
+	cfg, err := NewConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://docker:2375", cfg.DockerHost)
+	assert.Equal(t, "runners", cfg.Network)
+	assert.Equal(t, "debug", cfg.Log.Level)
+	assert.Equal(t, "json", cfg.Log.Format)
+	assert.True(t, cfg.AlwaysPull)
+}
+
+func TestNewConfigTOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+dind_mode = "none"
+binds = ["/var/cache:/cache:ro"]
+
+[readiness]
+log_pattern = "Listening for Jobs"
+timeout = "5m"
+`), 0o644))
+
+	cfg, err := NewConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, DinDModeNone, cfg.DinDMode)
+	assert.Equal(t, []string{"/var/cache:/cache:ro"}, cfg.Binds)
+	assert.Equal(t, 5*time.Minute, cfg.Readiness.Timeout)
+}
+
+func TestResolveSecret(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "token")
+	require.NoError(t, os.WriteFile(path, []byte("from-file\n"), 0o600))
+	t.Setenv("GARM_TEST_SECRET", "from-env")
+
+	tests := []struct {
+		ref     string
+		want    string
+		wantErr string
+	}{
+		{ref: "plain", want: "plain"},
+		{ref: "file:" + path, want: "from-file"},
+		{ref: "env:GARM_TEST_SECRET", want: "from-env"},
+		{ref: "exec:echo from-exec", want: "from-exec"},
+		{ref: "literal:env:GARM_TEST_SECRET", want: "env:GARM_TEST_SECRET"},
+		{ref: "literal:literal:x", want: "literal:x"},
+		{ref: "file:/does/not/exist", wantErr: "failed to read secret"},
+		{ref: "env:GARM_TEST_UNSET", wantErr: "GARM_TEST_UNSET is not set"},
+		{ref: "exec:false", wantErr: "secret command false failed"},
+		{ref: "exec:", wantErr: "has no command"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.ref, func(t *testing.T) {
+			got, err := ResolveSecret(tc.ref)
+			if tc.wantErr != "" {
+				assert.ErrorContains(t, err, tc.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestNewConfigResolvesAndRedactsSecrets(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+dind_mode: none
+tracing:
+  endpoint: http://otel-collector:4318
+  headers:
+    Authorization: env:GARM_TEST_OTEL_TOKEN
+log_archive:
+  s3:
+    endpoint: https://s3.example.com
+    bucket: logs
+    access_key_id: minio
+    secret_access_key: minio123
+`), 0o644))
+	t.Setenv("GARM_TEST_OTEL_TOKEN", "Bearer abc")
+
+	cfg, err := NewConfig(path)
+	require.NoError(t, err)
+	assert.Equal(t, "Bearer abc", cfg.Tracing.Headers["Authorization"].Value())
+	assert.Equal(t, "minio123", cfg.LogArchive.S3.SecretAccessKey.Value())
+
+	dump, err := cfg.Marshal()
+	require.NoError(t, err)
+	assert.Contains(t, string(dump), "secret_access_key: '[redacted]'")
+	assert.NotContains(t, string(dump), "minio123")
+	assert.NotContains(t, string(dump), "Bearer abc")
+
+	var logs bytes.Buffer
+	slog.New(slog.NewJSONHandler(&logs, nil)).Info("config", "s3", cfg.LogArchive.S3)
+	assert.NotContains(t, logs.String(), "minio123")
+	assert.NotContains(t, fmt.Sprintf("%v %+v %#v", cfg.LogArchive.S3, cfg.LogArchive.S3, cfg.LogArchive.S3), "minio123")
+
+	t.Setenv("GARM_TEST_OTEL_TOKEN", "")
+	require.NoError(t, os.Unsetenv("GARM_TEST_OTEL_TOKEN"))
+	_, err = NewConfig(path)
+	assert.ErrorContains(t, err, "GARM_TEST_OTEL_TOKEN is not set")
+}
+
+func TestRegistries(t *testing.T) {
+	t.Parallel()
+	cfg := &ProviderConfig{Registries: []RegistryConfig{
+		{Match: "docker.io/*", Mirror: "mirror.internal/dockerhub/*"},
+		{Match: "docker.io/library/postgres", Mirror: "mirror.internal/postgres"},
+		{Match: "mirror.internal", Username: "garm", Password: "pass"},
+		{Match: "ghcr.io/org/*", Token: "token"},
+		{Match: "ghcr.io/org/public"},
+	}}
+
+	assert.Equal(t, "mirror.internal/dockerhub/library/ubuntu:latest", cfg.MirrorImage("ubuntu"))
+	assert.Equal(t, "mirror.internal/dockerhub/org/runner:2.311", cfg.MirrorImage("org/runner:2.311"))
+	assert.Equal(t, "mirror.internal/postgres:16", cfg.MirrorImage("postgres:16"))
+	assert.Equal(t, "ghcr.io/org/runner:latest", cfg.MirrorImage("ghcr.io/org/runner:latest"))
+	assert.Equal(t, "not a valid image", cfg.MirrorImage("not a valid image"))
+
+	reg, ok := cfg.RegistryCredentials("mirror.internal/dockerhub/library/ubuntu:latest")
+	assert.True(t, ok)
+	assert.Equal(t, "garm", reg.Username)
+	reg, ok = cfg.RegistryCredentials("ghcr.io/org/public/runner@sha256:" + strings.Repeat("a", 64))
+	assert.True(t, ok)
+	assert.Equal(t, Secret("token"), reg.Token)
+	_, ok = cfg.RegistryCredentials("ghcr.io/other/runner")
+	assert.False(t, ok)
+	_, ok = cfg.RegistryCredentials("ghcr.io/organization/runner")
+	assert.False(t, ok)
+}
+
+func TestRegistryValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name     string
+		registry RegistryConfig
+		wantErr  string
+	}{
+		{name: "host", registry: RegistryConfig{Match: "registry.internal:5000", Username: "u", Password: "p"}},
+		{name: "mirror", registry: RegistryConfig{Match: "docker.io/*", Mirror: "mirror.internal/dockerhub/*"}},
+		{name: "missing match", registry: RegistryConfig{Token: "t"}, wantErr: "match is required"},
+		{name: "short name", registry: RegistryConfig{Match: "ubuntu", Token: "t"}, wantErr: "not a fully qualified image prefix"},
+		{name: "tagged mirror", registry: RegistryConfig{Match: "docker.io/*", Mirror: "mirror.internal/ubuntu:22.04"}, wantErr: "mirror:"},
+		{name: "username and token", registry: RegistryConfig{Match: "ghcr.io", Username: "u", Password: "p", Token: "t"}, wantErr: "mutually exclusive"},
+		{name: "password without username", registry: RegistryConfig{Match: "ghcr.io", Password: "p"}, wantErr: "must be set together"},
+		{name: "nothing to do", registry: RegistryConfig{Match: "ghcr.io"}, wantErr: "credentials or a mirror are required"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.registry.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckImage(t *testing.T) {
+	t.Parallel()
+	pinned := "ghcr.io/org/runner@sha256:" + strings.Repeat("a", 64)
+	policy := ImagePolicyConfig{
+		Allowed:       []string{"ghcr.io/org/*", "docker.io/library/ubuntu", "registry.internal:5000/runner-*"},
+		RequireDigest: DigestPolicyPrivileged,
+	}
+	cfg := &ProviderConfig{DinDMode: DinDModeSysbox, ImagePolicy: policy}
+
+	assert.NoError(t, cfg.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{}, nil))
+	assert.NoError(t, cfg.CheckImage("ghcr.io/org/team/runner:latest", SecurityConfig{}, nil))
+	assert.NoError(t, cfg.CheckImage("ubuntu:22.04", SecurityConfig{}, nil))
+	assert.NoError(t, cfg.CheckImage("registry.internal:5000/runner-arm64", SecurityConfig{}, nil))
+	assert.ErrorContains(t, cfg.CheckImage("ghcr.io/organization/runner", SecurityConfig{}, nil), "image ghcr.io/organization/runner is not allowed by image_policy")
+	assert.ErrorContains(t, cfg.CheckImage("docker.io/library/debian", SecurityConfig{}, nil), "not allowed")
+	assert.ErrorContains(t, cfg.CheckImage("registry.internal:5000/other/runner-x", SecurityConfig{}, nil), "not allowed")
+
+	privileged := &ProviderConfig{DinDMode: DinDModePrivileged, ImagePolicy: policy}
+	assert.ErrorContains(t, privileged.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{}, nil), "must be pinned by digest")
+	assert.NoError(t, privileged.CheckImage(pinned, SecurityConfig{}, nil))
+
+	socket := &ProviderConfig{DinDMode: DinDModeSocket, ImagePolicy: policy}
+	assert.ErrorContains(t, socket.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{}, nil), "must be pinned by digest")
+	socket.SocketProxy.Enabled = true
+	assert.NoError(t, socket.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{}, nil))
+
+	// Pools with root-equivalent settings or mounts need a digest in any mode
+	assert.ErrorContains(t, cfg.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{CapAdd: []string{"cap_sys_admin"}}, nil), "must be pinned by digest")
+	assert.ErrorContains(t, cfg.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{SeccompProfile: "unconfined"}, nil), "must be pinned by digest")
+	assert.NoError(t, cfg.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{CapAdd: []string{"NET_RAW"}}, nil))
+	for _, m := range []MountConfig{
+		{Type: MountTypeBind, Source: "/var/run/docker.sock", Target: "/var/run/docker.sock"},
+		{Type: MountTypeBind, Source: "/run", Target: "/host/run"},
+		{Type: MountTypeVolume, Source: "sock", Target: "/sock", DriverOpts: map[string]string{"type": "none", "o": "bind", "device": "/run"}},
+		{Type: MountTypeBind, Source: "/", Target: "/host"},
+		{Type: MountTypeBind, Source: "/etc/cron.d", Target: "/cron"},
+		{Type: MountTypeBind, Source: "/var", Target: "/host/var"},
+		{Type: MountTypeBind, Source: "/var/lib/docker", Target: "/docker"},
+		{Type: MountTypeBind, Source: "/dev", Target: "/host/dev", ReadOnly: true},
+		{Type: MountTypeVolume, Source: "etc", Target: "/etc2", DriverOpts: map[string]string{"type": "none", "o": "bind", "device": "/etc"}},
+		{Type: MountTypeVolume, Source: "disk", Target: "/disk", DriverOpts: map[string]string{"type": "ext4", "device": "/dev/sda1"}},
+		{Type: MountTypeVolume, Source: "share", Target: "/share", Driver: "rexray"},
+	} {
+		assert.ErrorContains(t, cfg.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{}, []MountConfig{m}), "must be pinned by digest", m.Source)
+	}
+	for _, m := range []MountConfig{
+		{Type: MountTypeBind, Source: "/srv/cache", Target: "/cache"},
+		{Type: MountTypeBind, Source: "/etc/ssl/certs", Target: "/certs", ReadOnly: true},
+		{Type: MountTypeVolume, Source: "etc", Target: "/etc2", DriverOpts: map[string]string{"type": "none", "o": "bind,ro", "device": "/etc"}},
+		{Type: MountTypeVolume, Source: "cache", Target: "/cache"},
+	} {
+		assert.NoError(t, cfg.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{}, []MountConfig{m}), m.Source)
+	}
+	for _, b := range []string{"/var/run/docker.sock:/var/run/docker.sock:ro", "/etc:/host/etc", "/usr/local:/host/usr"} {
+		binds := &ProviderConfig{DinDMode: DinDModeSysbox, ImagePolicy: policy, Binds: []string{b}}
+		assert.ErrorContains(t, binds.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{}, nil), "must be pinned by digest", b)
+	}
+	binds := &ProviderConfig{DinDMode: DinDModeSysbox, ImagePolicy: policy, Binds: []string{"/etc:/host/etc:ro", "cache:/cache"}}
+	assert.NoError(t, binds.CheckImage("ghcr.io/org/runner:latest", SecurityConfig{}, nil))
+
+	always := &ProviderConfig{DinDMode: DinDModeSysbox, ImagePolicy: ImagePolicyConfig{RequireDigest: DigestPolicyAlways}}
+	assert.ErrorContains(t, always.CheckImage("debian", SecurityConfig{}, nil), "must be pinned by digest")
+	assert.NoError(t, always.CheckImage(pinned, SecurityConfig{}, nil))
+}
+
+func TestImagePolicyValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		policy  ImagePolicyConfig
+		wantErr string
+	}{
+		{name: "valid", policy: ImagePolicyConfig{Allowed: []string{"*.corp.example/*", "localhost/runner"}, RequireDigest: DigestPolicyAlways}},
+		{name: "short name", policy: ImagePolicyConfig{Allowed: []string{"ubuntu"}, RequireDigest: DigestPolicyNever}, wantErr: "allowed[0]: \"ubuntu\" is not a fully qualified image pattern"},
+		{name: "bad glob", policy: ImagePolicyConfig{Allowed: []string{"ghcr.io/[org"}, RequireDigest: DigestPolicyNever}, wantErr: "invalid pattern"},
+		{name: "unknown digest policy", policy: ImagePolicyConfig{RequireDigest: "sometimes"}, wantErr: "unknown require_digest \"sometimes\""},
+		{name: "relative key", policy: ImagePolicyConfig{RequireDigest: DigestPolicyNever, Signature: ImageSignatureConfig{PublicKey: "cosign.pub"}}, wantErr: "must be an absolute path"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.policy.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestImageGCValidate(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		gc      ImageGCConfig
+		wantErr string
+	}{
+		{name: "disabled", gc: ImageGCConfig{}},
+		{name: "valid", gc: ImageGCConfig{Images: []string{"ghcr.io/org/*"}, KeepDigests: 3, AfterPull: true}},
+		{name: "short name", gc: ImageGCConfig{Images: []string{"runner"}, Retention: time.Hour}, wantErr: "images[0]:"},
+		{name: "nothing to remove", gc: ImageGCConfig{Images: []string{"ghcr.io/org/*"}}, wantErr: "retention or keep_digests is required"},
+		{name: "negative keep", gc: ImageGCConfig{Images: []string{"ghcr.io/org/*"}, KeepDigests: -1}, wantErr: "keep_digests must not be negative"},
+		{name: "after pull without images", gc: ImageGCConfig{AfterPull: true}, wantErr: "after_pull requires images"},
+		{name: "relative lock path", gc: ImageGCConfig{Images: []string{"ghcr.io/org/*"}, KeepDigests: 1, LockPath: "images.lock"}, wantErr: "lock_path \"images.lock\" must be an absolute path"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			err := tc.gc.Validate()
+			if tc.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, tc.wantErr)
+			}
+		})
+	}
+}
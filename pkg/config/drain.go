@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// DrainConfig controls how a running runner is asked to finish its job
+// before it is stopped or removed. It can be set in the provider config and
+// overridden per pool in extra specs.
+type DrainConfig struct {
+	// Signal is sent to the runner to start draining, e.g. "SIGINT".
+	Signal string `koanf:"signal" json:"signal,omitempty"`
+	// Command is run inside the runner with "docker exec" to start draining,
+	// e.g. ["/runner/config.sh", "remove"]. Mutually exclusive with Signal.
+	Command []string `koanf:"command" json:"command,omitempty"`
+	// Timeout is how long to wait for the runner to exit after draining
+	// started, before it is stopped or removed anyway. 0 disables draining.
+	Timeout *time.Duration `koanf:"timeout" json:"timeout,omitempty"`
+	// StopSignal is the signal Docker sends to stop the runner. Defaults to
+	// the image's stop signal.
+	StopSignal string `koanf:"stop_signal" json:"stop_signal,omitempty"`
+	// StopTimeout is how long Docker waits after StopSignal before killing
+	// the runner. Defaults to Docker's 10 seconds.
+	StopTimeout *time.Duration `koanf:"stop_timeout" json:"stop_timeout,omitempty"`
+}
+
+// UnmarshalJSON decodes the drain settings of a pool, with durations given
+// as strings like "5m".
+func (d *DrainConfig) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Signal      string   `json:"signal"`
+		Command     []string `json:"command"`
+		Timeout     *string  `json:"timeout"`
+		StopSignal  string   `json:"stop_signal"`
+		StopTimeout *string  `json:"stop_timeout"`
+	}
+	if err := DecodeExtraSpecsJSON("drain", data, &raw); err != nil {
+		return err
+	}
+
+	timeout, err := parseJSONDuration("timeout", raw.Timeout)
+	if err != nil {
+		return err
+	}
+	stopTimeout, err := parseJSONDuration("stop_timeout", raw.StopTimeout)
+	if err != nil {
+		return err
+	}
+
+	*d = DrainConfig{
+		Signal:      raw.Signal,
+		Command:     raw.Command,
+		Timeout:     timeout,
+		StopSignal:  raw.StopSignal,
+		StopTimeout: stopTimeout,
+	}
+	return nil
+}
+
+// Merge returns the settings with the non-empty fields of override applied
+// on top. Setting Signal or Command in override replaces both.
+func (d DrainConfig) Merge(override DrainConfig) DrainConfig {
+	merged := d
+	if override.Signal != "" || override.Command != nil {
+		merged.Signal = override.Signal
+		merged.Command = override.Command
+	}
+	if override.Timeout != nil {
+		merged.Timeout = override.Timeout
+	}
+	if override.StopSignal != "" {
+		merged.StopSignal = override.StopSignal
+	}
+	if override.StopTimeout != nil {
+		merged.StopTimeout = override.StopTimeout
+	}
+	return merged
+}
+
+// Validate checks the drain settings against each other.
+func (d DrainConfig) Validate() error {
+	if d.Signal != "" && len(d.Command) > 0 {
+		return fmt.Errorf("signal and command are mutually exclusive")
+	}
+	if d.Timeout != nil && *d.Timeout < 0 {
+		return fmt.Errorf("timeout can't be negative")
+	}
+	if d.StopTimeout != nil && *d.StopTimeout < 0 {
+		return fmt.Errorf("stop_timeout can't be negative")
+	}
+	if d.DrainTimeout() > 0 && d.Signal == "" && len(d.Command) == 0 {
+		return fmt.Errorf("timeout requires a signal or command to start draining")
+	}
+	return nil
+}
+
+// DrainTimeout returns how long to wait for the runner to drain, or 0 if
+// draining is disabled.
+func (d DrainConfig) DrainTimeout() time.Duration {
+	if d.Timeout == nil {
+		return 0
+	}
+	return *d.Timeout
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"reflect"
+	"time"
+)
+
+// DecodeExtraSpecsJSON decodes a JSON object from pool extra specs into v.
+// Unknown fields are logged, so typos don't go unnoticed, but ignored, as
+// pools may carry keys for other tools or other provider versions.
+func DecodeExtraSpecsJSON(section string, data []byte, v any) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	strictErr := decoder.Decode(v)
+	if strictErr == nil {
+		return nil
+	}
+
+	// encoding/json reports unknown fields with an untyped error, so decode
+	// again without the check. If that succeeds, unknown fields were the
+	// only problem.
+	target := reflect.ValueOf(v).Elem()
+	target.SetZero()
+	if err := json.Unmarshal(data, v); err != nil {
+		return err
+	}
+	slog.Warn("ignoring unknown field in extra specs", "section", section, "error", strictErr)
+	return nil
+}
+
+// parseJSONDuration parses an optional duration given as a string like "5m"
+// in extra specs.
+func parseJSONDuration(name string, s *string) (*time.Duration, error) {
+	if s == nil {
+		return nil, nil
+	}
+	v, err := time.ParseDuration(*s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", name, err)
+	}
+	return &v, nil
+}
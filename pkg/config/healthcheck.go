@@ -0,0 +1,105 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// HealthcheckConfig is the Docker HEALTHCHECK of runner containers. It can
+// be set in the provider config and overridden per pool in extra specs.
+type HealthcheckConfig struct {
+	// Test is the check to run, e.g. ["CMD-SHELL", "pgrep -f Runner.Listener"].
+	// ["NONE"] disables a healthcheck defined in the image.
+	Test []string `koanf:"test" json:"test,omitempty"`
+	// Interval between checks. Defaults to Docker's 30s.
+	Interval time.Duration `koanf:"interval" json:"interval,omitempty"`
+	// Timeout of a single check. Defaults to Docker's 30s.
+	Timeout time.Duration `koanf:"timeout" json:"timeout,omitempty"`
+	// StartPeriod is the time the runner gets to start before failing
+	// checks count. Defaults to 0.
+	StartPeriod time.Duration `koanf:"start_period" json:"start_period,omitempty"`
+	// Retries is the number of consecutive failures after which the runner
+	// is unhealthy. Defaults to Docker's 3.
+	Retries int `koanf:"retries" json:"retries,omitempty"`
+}
+
+// UnmarshalJSON decodes the healthcheck of a pool, with durations given as
+// strings like "30s".
+func (h *HealthcheckConfig) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Test        []string `json:"test"`
+		Interval    *string  `json:"interval"`
+		Timeout     *string  `json:"timeout"`
+		StartPeriod *string  `json:"start_period"`
+		Retries     int      `json:"retries"`
+	}
+	if err := DecodeExtraSpecsJSON("healthcheck", data, &raw); err != nil {
+		return err
+	}
+
+	*h = HealthcheckConfig{Test: raw.Test, Retries: raw.Retries}
+	for _, d := range []struct {
+		name  string
+		value *string
+		dst   *time.Duration
+	}{
+		{"interval", raw.Interval, &h.Interval},
+		{"timeout", raw.Timeout, &h.Timeout},
+		{"start_period", raw.StartPeriod, &h.StartPeriod},
+	} {
+		v, err := parseJSONDuration(d.name, d.value)
+		if err != nil {
+			return err
+		}
+		if v != nil {
+			*d.dst = *v
+		}
+	}
+	return nil
+}
+
+// Merge returns the healthcheck with the non-empty fields of override
+// applied on top.
+func (h HealthcheckConfig) Merge(override HealthcheckConfig) HealthcheckConfig {
+	merged := h
+	if override.Test != nil {
+		merged.Test = override.Test
+	}
+	if override.Interval != 0 {
+		merged.Interval = override.Interval
+	}
+	if override.Timeout != 0 {
+		merged.Timeout = override.Timeout
+	}
+	if override.StartPeriod != 0 {
+		merged.StartPeriod = override.StartPeriod
+	}
+	if override.Retries != 0 {
+		merged.Retries = override.Retries
+	}
+	return merged
+}
+
+// Validate checks the healthcheck settings.
+func (h HealthcheckConfig) Validate() error {
+	if len(h.Test) > 0 {
+		switch h.Test[0] {
+		case "NONE":
+		case "CMD", "CMD-SHELL":
+			if len(h.Test) < 2 {
+				return fmt.Errorf("test %s needs a command", h.Test[0])
+			}
+		default:
+			return fmt.Errorf("test must start with \"CMD\", \"CMD-SHELL\" or \"NONE\", got %q", h.Test[0])
+		}
+	}
+	for name, d := range map[string]time.Duration{"interval": h.Interval, "timeout": h.Timeout, "start_period": h.StartPeriod} {
+		if d < 0 || (d > 0 && d < time.Millisecond) {
+			return fmt.Errorf("%s must be at least 1ms", name)
+		}
+	}
+	if h.Retries < 0 {
+		return fmt.Errorf("retries can't be negative")
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// HookEvent is a point in the lifecycle of a runner where hooks run.
+type HookEvent string
+
+const (
+	// HookPreCreate runs before the runner container is created.
+	HookPreCreate HookEvent = "pre_create"
+	// HookPostStart runs after the runner container started.
+	HookPostStart HookEvent = "post_start"
+	// HookPreStop runs before a runner is stopped.
+	HookPreStop HookEvent = "pre_stop"
+	// HookPreDelete runs before a runner is removed.
+	HookPreDelete HookEvent = "pre_delete"
+)
+
+// HookFailurePolicy decides what happens when a hook fails or times out.
+type HookFailurePolicy string
+
+const (
+	// HookFailureIgnore carries on silently.
+	HookFailureIgnore HookFailurePolicy = "ignore"
+	// HookFailureWarn logs a warning and carries on.
+	HookFailureWarn HookFailurePolicy = "warn"
+	// HookFailureAbort fails the operation the hook runs for.
+	HookFailureAbort HookFailurePolicy = "abort"
+)
+
+// DefaultHookTimeout is used for hooks without a timeout.
+const DefaultHookTimeout = 30 * time.Second
+
+// HooksConfig lists the hooks to run for each lifecycle event, in order.
+type HooksConfig struct {
+	PreCreate []HookConfig `koanf:"pre_create"`
+	PostStart []HookConfig `koanf:"post_start"`
+	PreStop   []HookConfig `koanf:"pre_stop"`
+	PreDelete []HookConfig `koanf:"pre_delete"`
+}
+
+// HookConfig is a single lifecycle hook. The instance's JSON is passed on
+// stdin to host commands and in the GARM_INSTANCE environment variable to
+// both kinds of hooks.
+type HookConfig struct {
+	// Command is an executable on the host running the provider, and its
+	// arguments.
+	Command []string `koanf:"command"`
+	// Exec is a command run inside the runner container with "docker exec".
+	// Mutually exclusive with Command.
+	Exec []string `koanf:"exec"`
+	// Timeout of the hook. Defaults to 30s.
+	Timeout time.Duration `koanf:"timeout"`
+	// OnFailure is "ignore", "warn" or "abort". Defaults to "warn". "abort"
+	// can't be used for pre_delete hooks.
+	OnFailure HookFailurePolicy `koanf:"on_failure"`
+}
+
+// Hooks returns the hooks for an event.
+func (h HooksConfig) Hooks(event HookEvent) []HookConfig {
+	switch event {
+	case HookPreCreate:
+		return h.PreCreate
+	case HookPostStart:
+		return h.PostStart
+	case HookPreStop:
+		return h.PreStop
+	case HookPreDelete:
+		return h.PreDelete
+	default:
+		return nil
+	}
+}
+
+// Validate checks every hook.
+func (h HooksConfig) Validate() error {
+	for _, event := range []HookEvent{HookPreCreate, HookPostStart, HookPreStop, HookPreDelete} {
+		for i, hook := range h.Hooks(event) {
+			if err := hook.Validate(event); err != nil {
+				return fmt.Errorf("%s[%d]: %w", event, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks a hook run for the given event.
+func (h HookConfig) Validate(event HookEvent) error {
+	switch {
+	case len(h.Command) == 0 && len(h.Exec) == 0:
+		return fmt.Errorf("command or exec is required")
+	case len(h.Command) > 0 && len(h.Exec) > 0:
+		return fmt.Errorf("command and exec are mutually exclusive")
+	case len(h.Exec) > 0 && event == HookPreCreate:
+		return fmt.Errorf("exec can't be used before the container exists")
+	}
+	if h.Timeout < 0 {
+		return fmt.Errorf("timeout can't be negative")
+	}
+	switch h.OnFailure {
+	case "", HookFailureIgnore, HookFailureWarn, HookFailureAbort:
+	default:
+		return fmt.Errorf("unknown on_failure %q", h.OnFailure)
+	}
+	if h.OnFailure == HookFailureAbort && event == HookPreDelete {
+		// Garm retries a failed delete forever, so a failing pre_delete hook
+		// would keep the runner around for good
+		return fmt.Errorf("on_failure abort can't be used before a runner is removed")
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+)
+
+// ImageGCConfig controls which runner images the image garbage collector
+// removes. See the "image-gc" command. Images in use by a Garm container are
+// always kept.
+type ImageGCConfig struct {
+	// Images lists patterns of the runner image repositories to collect, with
+	// the syntax of image_policy allowed. Images not matching are never
+	// touched.
+	Images []string `koanf:"images"`
+	// Retention removes images created longer ago than this. 0 disables it.
+	Retention time.Duration `koanf:"retention"`
+	// KeepDigests is how many of the most recently created images are always
+	// kept per repository, whatever their age. Older ones are removed once
+	// they are past the retention, or right away without one. 0 disables it.
+	KeepDigests int `koanf:"keep_digests"`
+	// AfterPull runs a pass after CreateInstance pulled a runner image.
+	AfterPull bool `koanf:"after_pull"`
+	// LockPath is the lock file that keeps a pass from removing an image
+	// another provider process pulled but hasn't created its container from
+	// yet. Defaults to "garm-provider-docker-images.lock" in the temporary
+	// directory.
+	LockPath string `koanf:"lock_path"`
+}
+
+// Enabled reports whether runner images are collected.
+func (c ImageGCConfig) Enabled() bool {
+	return len(c.Images) > 0
+}
+
+// Matches reports whether a fully qualified repository name matches one of
+// the configured patterns.
+func (c ImageGCConfig) Matches(name string) bool {
+	for _, pattern := range c.Images {
+		if MatchImagePattern(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the image garbage collector settings.
+func (c ImageGCConfig) Validate() error {
+	for i, pattern := range c.Images {
+		if err := validateImagePattern(pattern); err != nil {
+			return fmt.Errorf("images[%d]: %w", i, err)
+		}
+	}
+	if c.Retention < 0 {
+		return fmt.Errorf("retention must not be negative")
+	}
+	if c.KeepDigests < 0 {
+		return fmt.Errorf("keep_digests must not be negative")
+	}
+	if c.Enabled() && c.Retention == 0 && c.KeepDigests == 0 {
+		return fmt.Errorf("retention or keep_digests is required")
+	}
+	if c.LockPath != "" && !filepath.IsAbs(c.LockPath) {
+		return fmt.Errorf("lock_path %q must be an absolute path", c.LockPath)
+	}
+	if c.AfterPull && !c.Enabled() {
+		return fmt.Errorf("after_pull requires images")
+	}
+	return nil
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/distribution/reference"
+)
+
+// DigestPolicy selects which runner images must be pinned by digest.
+type DigestPolicy string
+
+const (
+	// DigestPolicyNever accepts tags for all runners.
+	DigestPolicyNever DigestPolicy = "never"
+	// DigestPolicyPrivileged requires a digest for runners that have root on
+	// the host, see RunnersPrivileged.
+	DigestPolicyPrivileged DigestPolicy = "privileged"
+	// DigestPolicyAlways requires a digest for all runners.
+	DigestPolicyAlways DigestPolicy = "always"
+)
+
+// ImagePolicyConfig restricts the runner images pools may use. It applies to
+// the image requested by the pool, before a registries mirror rewrite, and
+// not to the images of the provider's own helper containers.
+type ImagePolicyConfig struct {
+	// Allowed lists glob patterns of fully qualified repositories, such as
+	// "ghcr.io/org/*" or "docker.io/library/ubuntu". "*" matches within a
+	// path element, but a pattern ending in "/*" also matches repositories
+	// nested deeper. If empty, all images are allowed.
+	Allowed []string `koanf:"allowed"`
+	// RequireDigest is "never", "privileged" or "always". Defaults to "never".
+	RequireDigest DigestPolicy `koanf:"require_digest"`
+	// Signature verifies the cosign signature of runner images.
+	Signature ImageSignatureConfig `koanf:"signature"`
+}
+
+// ImageSignatureConfig controls the verification of cosign signatures.
+// Signatures are looked up in the repository the image is pulled from and
+// checked against a public key only, without a transparency log, so the
+// verification needs nothing but the registry.
+type ImageSignatureConfig struct {
+	// PublicKey is the path of a PEM-encoded cosign public key. Verification
+	// is enabled if it is set.
+	PublicKey string `koanf:"public_key"`
+	// InsecureRegistries are registry hosts reached over plain HTTP.
+	// "localhost" and loopback addresses always are, as in Docker.
+	InsecureRegistries []string `koanf:"insecure_registries"`
+	// Timeout for fetching the signature of an image. Defaults to 30s.
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// Enabled reports whether signatures are verified.
+func (c ImageSignatureConfig) Enabled() bool {
+	return c.PublicKey != ""
+}
+
+// Validate checks the image policy.
+func (c ImagePolicyConfig) Validate() error {
+	for i, pattern := range c.Allowed {
+		if err := validateImagePattern(pattern); err != nil {
+			return fmt.Errorf("allowed[%d]: %w", i, err)
+		}
+	}
+	switch c.RequireDigest {
+	case DigestPolicyNever, DigestPolicyPrivileged, DigestPolicyAlways:
+	default:
+		return fmt.Errorf("unknown require_digest %q", c.RequireDigest)
+	}
+	if c.Signature.PublicKey != "" && !filepath.IsAbs(c.Signature.PublicKey) {
+		return fmt.Errorf("signature: public_key %q must be an absolute path", c.Signature.PublicKey)
+	}
+	if c.Signature.Timeout < 0 {
+		return fmt.Errorf("signature: timeout must not be negative")
+	}
+	return nil
+}
+
+// validateImagePattern checks that pattern is a valid glob with an explicit
+// registry host.
+func validateImagePattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	host, _, ok := strings.Cut(pattern, "/")
+	if !ok || (!strings.ContainsAny(host, ".:") && host != "localhost") {
+		return fmt.Errorf("%q is not a fully qualified image pattern, such as \"ghcr.io/org/*\"", pattern)
+	}
+	return nil
+}
+
+// MatchImagePattern reports whether a fully qualified repository name
+// matches an image pattern, as used in image_policy and image_gc.
+func MatchImagePattern(pattern, name string) bool {
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	if !strings.HasSuffix(pattern, "/*") {
+		return false
+	}
+	// Match the parents of name against the pattern, so that "ghcr.io/org/*"
+	// also covers "ghcr.io/org/team/runner"
+	for i := strings.LastIndex(name, "/"); i > 0; i = strings.LastIndex(name[:i], "/") {
+		if ok, _ := path.Match(pattern, name[:i]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// RunnersPrivileged reports whether runners with the given security settings
+// and extra specs mounts have root on the host: they are privileged, they get
+// the host Docker socket without a proxy, their security settings are
+// dangerous, such as adding SYS_ADMIN or disabling seccomp, or a mount gives
+// root on the host, see GivesHostRoot.
+func (c *ProviderConfig) RunnersPrivileged(sec SecurityConfig, mounts []MountConfig) bool {
+	if c.DinDMode == DinDModePrivileged || (c.DinDMode == DinDModeSocket && !c.SocketProxy.Enabled) {
+		return true
+	}
+	if sec.checkDangerous(c.DinDMode) != nil {
+		return true
+	}
+	all := append(append([]MountConfig{}, c.Mounts...), mounts...)
+	for _, b := range c.Binds {
+		all = append(all, bindMount(b))
+	}
+	for _, m := range all {
+		if c.GivesHostRoot(m) {
+			return true
+		}
+	}
+	return false
+}
+
+// exposesDockerSocket reports whether binding the host path source gives
+// access to a Docker socket of the host, because it is the socket or one of
+// its parent directories.
+func (c *ProviderConfig) exposesDockerSocket(source string) bool {
+	sockets := []string{"/var/run/docker.sock", "/run/docker.sock"}
+	if socket, ok := strings.CutPrefix(c.DockerHost, "unix://"); ok {
+		sockets = append(sockets, socket)
+	}
+	source = resolveHostPath(source)
+	for _, socket := range sockets {
+		rel, err := filepath.Rel(source, resolveHostPath(socket))
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckImage checks a runner image requested by a pool against the image
+// policy. sec and mounts are the pool's security settings, merged with the
+// provider config, and extra specs mounts.
+func (c *ProviderConfig) CheckImage(image string, sec SecurityConfig, mounts []MountConfig) error {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return fmt.Errorf("invalid image %q: %w", image, err)
+	}
+
+	if len(c.ImagePolicy.Allowed) > 0 {
+		allowed := false
+		for _, pattern := range c.ImagePolicy.Allowed {
+			if MatchImagePattern(pattern, named.Name()) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("image %s is not allowed by image_policy", named.Name())
+		}
+	}
+
+	if _, pinned := named.(reference.Canonical); !pinned {
+		switch {
+		case c.ImagePolicy.RequireDigest == DigestPolicyAlways:
+			return fmt.Errorf("image %s must be pinned by digest", image)
+		case c.ImagePolicy.RequireDigest == DigestPolicyPrivileged && c.RunnersPrivileged(sec, mounts):
+			return fmt.Errorf("image %s must be pinned by digest, runners have root on the host", image)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// RestartPolicyOnFailure restarts a runner that exited with a non-zero code.
+const RestartPolicyOnFailure = "on-failure"
+
+// LifecycleConfig controls how long runners live and whether they are
+// restarted. It can be set in the provider config and overridden per pool in
+// extra specs.
+type LifecycleConfig struct {
+	// Ephemeral runners take a single job and exit. Defaults to true.
+	Ephemeral *bool `koanf:"ephemeral" json:"ephemeral,omitempty"`
+	// MaxLifetime is how long a runner may live. Older runners are reported
+	// to Garm as errors and removed by the reaper. 0 disables the limit.
+	MaxLifetime time.Duration `koanf:"max_lifetime" json:"max_lifetime,omitempty"`
+	// RestartPolicy restarts crashed runners. Only allowed for non-ephemeral
+	// runners.
+	RestartPolicy RestartPolicyConfig `koanf:"restart_policy" json:"restart_policy,omitempty"`
+}
+
+// RestartPolicyConfig is a Docker restart policy.
+type RestartPolicyConfig struct {
+	// Name of the policy. Only "on-failure" is supported.
+	Name string `koanf:"name" json:"name,omitempty"`
+	// MaxRetries is the number of restarts before Docker gives up.
+	MaxRetries int `koanf:"max_retries" json:"max_retries,omitempty"`
+}
+
+// UnmarshalJSON decodes the lifecycle settings of a pool, with max_lifetime
+// given as a string like "24h".
+func (l *LifecycleConfig) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Ephemeral     *bool               `json:"ephemeral"`
+		MaxLifetime   *string             `json:"max_lifetime"`
+		RestartPolicy RestartPolicyConfig `json:"restart_policy"`
+	}
+	if err := DecodeExtraSpecsJSON("lifecycle", data, &raw); err != nil {
+		return err
+	}
+
+	maxLifetime, err := parseJSONDuration("max_lifetime", raw.MaxLifetime)
+	if err != nil {
+		return err
+	}
+	*l = LifecycleConfig{Ephemeral: raw.Ephemeral, RestartPolicy: raw.RestartPolicy}
+	if maxLifetime != nil {
+		l.MaxLifetime = *maxLifetime
+	}
+	return nil
+}
+
+// Merge returns the settings with the non-empty fields of override applied
+// on top.
+func (l LifecycleConfig) Merge(override LifecycleConfig) LifecycleConfig {
+	merged := l
+	if override.Ephemeral != nil {
+		merged.Ephemeral = override.Ephemeral
+	}
+	if override.MaxLifetime != 0 {
+		merged.MaxLifetime = override.MaxLifetime
+	}
+	if override.RestartPolicy.Name != "" {
+		merged.RestartPolicy = override.RestartPolicy
+	}
+	return merged
+}
+
+// IsEphemeral reports whether runners take a single job.
+func (l LifecycleConfig) IsEphemeral() bool {
+	return l.Ephemeral == nil || *l.Ephemeral
+}
+
+// Validate checks the settings against each other.
+func (l LifecycleConfig) Validate() error {
+	if l.MaxLifetime < 0 {
+		return fmt.Errorf("max_lifetime can't be negative")
+	}
+	switch l.RestartPolicy.Name {
+	case "":
+		if l.RestartPolicy.MaxRetries != 0 {
+			return fmt.Errorf("restart_policy: max_retries requires a name")
+		}
+	case RestartPolicyOnFailure:
+		if l.RestartPolicy.MaxRetries <= 0 {
+			return fmt.Errorf("restart_policy: max_retries must be positive")
+		}
+		if l.IsEphemeral() {
+			// A restarted ephemeral runner would register again with its used credentials
+			return fmt.Errorf("restart_policy can't be used with ephemeral runners")
+		}
+	default:
+		return fmt.Errorf("restart_policy: unsupported name %q, only %q is supported", l.RestartPolicy.Name, RestartPolicyOnFailure)
+	}
+	return nil
+}
@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"time"
+)
+
+// LogArchiveConfig controls where the logs of a runner are archived before
+// DeleteInstance removes its container. Set either Directory or S3.
+type LogArchiveConfig struct {
+	// Directory on the host running the provider to write logs to. Each
+	// pool gets its own subdirectory.
+	Directory string `koanf:"directory"`
+	// MaxFiles is the number of archived logs kept in Directory. Older ones
+	// are removed. 0 keeps all.
+	MaxFiles int `koanf:"max_files"`
+	// MaxAge is how long archived logs are kept in Directory. 0 keeps them
+	// forever.
+	MaxAge time.Duration `koanf:"max_age"`
+	// S3 uploads logs to an S3-compatible bucket instead.
+	S3 S3Config `koanf:"s3"`
+	// Timeout for archiving the logs of one runner. Defaults to 1m.
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// S3Config is an S3-compatible bucket, such as AWS S3 or MinIO.
+type S3Config struct {
+	// Endpoint is the URL of the S3 API, e.g. "https://s3.eu-central-1.amazonaws.com".
+	Endpoint string `koanf:"endpoint"`
+	// Region of the bucket. Defaults to "us-east-1".
+	Region string `koanf:"region"`
+	Bucket string `koanf:"bucket"`
+	// Prefix is prepended to the object keys, e.g. "runner-logs/".
+	Prefix string `koanf:"prefix"`
+	// PathStyle addresses the bucket as "<endpoint>/<bucket>" instead of
+	// "<bucket>.<endpoint host>". MinIO usually needs it.
+	PathStyle bool `koanf:"path_style"`
+	// AccessKeyID, SecretAccessKey and SessionToken default to the
+	// AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+	// environment variables.
+	AccessKeyID     string `koanf:"access_key_id"`
+	SecretAccessKey Secret `koanf:"secret_access_key"`
+	SessionToken    Secret `koanf:"session_token"`
+	// MaxSizeMB is the size logs are truncated to before they are uploaded.
+	// They are spooled to a temporary file to sign them. Defaults to 100.
+	MaxSizeMB int `koanf:"max_size_mb"`
+}
+
+// Enabled reports whether logs are archived.
+func (c LogArchiveConfig) Enabled() bool {
+	return c.Directory != "" || c.S3.Bucket != ""
+}
+
+// Validate checks the log archive settings.
+func (c LogArchiveConfig) Validate() error {
+	if c.Directory != "" && c.S3.Bucket != "" {
+		return fmt.Errorf("directory and s3 are mutually exclusive")
+	}
+	if c.Directory != "" && !filepath.IsAbs(c.Directory) {
+		return fmt.Errorf("directory %q must be an absolute path", c.Directory)
+	}
+	if c.MaxFiles < 0 || c.MaxAge < 0 {
+		return fmt.Errorf("max_files and max_age can't be negative")
+	}
+	if c.S3.MaxSizeMB < 0 {
+		return fmt.Errorf("s3: max_size_mb can't be negative")
+	}
+	if c.S3.Bucket != "" {
+		u, err := url.Parse(c.S3.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("s3: endpoint %q must be an http or https URL", c.S3.Endpoint)
+		}
+	}
+	return nil
+}
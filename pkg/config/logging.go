@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"path/filepath"
+)
+
+// Log outputs.
+const (
+	LogOutputStderr = "stderr"
+	LogOutputFile   = "file"
+	LogOutputSyslog = "syslog"
+)
+
+// LogConfig controls the provider's own logs.
+type LogConfig struct {
+	// Level is "debug", "info", "warn" or "error". Defaults to "info".
+	Level string `koanf:"level"`
+	// Format is "text" or "json". Defaults to "text".
+	Format string `koanf:"format"`
+	// Output is "stderr", "file" or "syslog". Defaults to "stderr".
+	Output string `koanf:"output"`
+	// File is used with output "file".
+	File LogFileConfig `koanf:"file"`
+	// Syslog is used with output "syslog".
+	Syslog LogSyslogConfig `koanf:"syslog"`
+}
+
+// LogFileConfig is a log file rotated by size.
+type LogFileConfig struct {
+	Path string `koanf:"path"`
+	// MaxSizeMB is the size at which the file is rotated. Defaults to 100.
+	MaxSizeMB int `koanf:"max_size_mb"`
+	// MaxBackups is the number of rotated files kept. Defaults to 5.
+	MaxBackups int `koanf:"max_backups"`
+}
+
+// LogSyslogConfig is a syslog daemon, or journald's syslog socket.
+type LogSyslogConfig struct {
+	// Network is "unix", "unixgram", "udp" or "tcp". Defaults to "unixgram".
+	Network string `koanf:"network"`
+	// Address of the daemon. Defaults to "/dev/log", which journald also
+	// listens on.
+	Address string `koanf:"address"`
+	// Tag of the messages. Defaults to "garm-provider-docker".
+	Tag string `koanf:"tag"`
+}
+
+// Validate checks the log settings. Empty fields are left to their defaults.
+func (c LogConfig) Validate() error {
+	if _, err := c.SlogLevel(); err != nil {
+		return err
+	}
+	if c.Format != "" && c.Format != "text" && c.Format != "json" {
+		return fmt.Errorf("format must be \"text\" or \"json\", got %q", c.Format)
+	}
+	switch c.Output {
+	case "", LogOutputStderr, LogOutputSyslog:
+	case LogOutputFile:
+		if !filepath.IsAbs(c.File.Path) {
+			return fmt.Errorf("file: path %q must be an absolute path", c.File.Path)
+		}
+		if c.File.MaxSizeMB < 0 || c.File.MaxBackups < 0 {
+			return fmt.Errorf("file: max_size_mb and max_backups can't be negative")
+		}
+	default:
+		return fmt.Errorf("unknown output %q", c.Output)
+	}
+	return nil
+}
+
+// SlogLevel returns the configured level. It defaults to info.
+func (c LogConfig) SlogLevel() (slog.Level, error) {
+	var level slog.Level
+	if c.Level == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(c.Level)); err != nil {
+		return level, fmt.Errorf("invalid level %q", c.Level)
+	}
+	return level, nil
+}
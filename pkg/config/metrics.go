@@ -0,0 +1,56 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// MetricsConfig controls where the metrics of each provider invocation are
+// emitted. Set TextfilePath, PushgatewayURL or both.
+type MetricsConfig struct {
+	// TextfilePath is a file in the node_exporter textfile collector
+	// directory, e.g. "/var/lib/node_exporter/garm-provider-docker.prom".
+	TextfilePath string `koanf:"textfile_path"`
+	// PushgatewayURL is the base URL of a Prometheus Pushgateway, e.g.
+	// "http://pushgateway:9091".
+	PushgatewayURL string `koanf:"pushgateway_url"`
+	// Job is the job label metrics are pushed under. Defaults to
+	// "garm-provider-docker".
+	Job string `koanf:"job"`
+	// Instance is the instance label metrics are pushed under, so that the
+	// pushes of several provider hosts don't replace each other. Defaults to
+	// the hostname.
+	Instance string `koanf:"instance"`
+	// Timeout for pushing metrics. Defaults to 5s.
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// Enabled reports whether metrics are emitted.
+func (c MetricsConfig) Enabled() bool {
+	return c.TextfilePath != "" || c.PushgatewayURL != ""
+}
+
+// Validate checks the metrics settings.
+func (c MetricsConfig) Validate() error {
+	if c.TextfilePath != "" {
+		if !filepath.IsAbs(c.TextfilePath) {
+			return fmt.Errorf("textfile_path %q must be an absolute path", c.TextfilePath)
+		}
+		if !strings.HasSuffix(c.TextfilePath, ".prom") {
+			return fmt.Errorf("textfile_path %q must end in .prom to be read by node_exporter", c.TextfilePath)
+		}
+	}
+	if c.PushgatewayURL != "" {
+		u, err := url.Parse(c.PushgatewayURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("pushgateway_url %q must be an http or https URL", c.PushgatewayURL)
+		}
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout can't be negative")
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	units "github.com/docker/go-units"
+)
+
+const (
+	MountTypeBind   = "bind"
+	MountTypeVolume = "volume"
+	MountTypeTmpfs  = "tmpfs"
+	MountTypeImage  = "image"
+)
+
+var validPropagations = []string{"rprivate", "private", "rshared", "shared", "rslave", "slave"}
+
+// MountConfig describes a single mount. It is used both in the provider
+// config and in pool extra specs.
+type MountConfig struct {
+	// Type is one of "bind", "volume", "tmpfs" or "image".
+	Type string `koanf:"type" json:"type"`
+	// Source is the host path for binds, the volume name for volumes (empty
+	// for an anonymous volume) and the image reference for image mounts.
+	// Must be empty for tmpfs.
+	Source string `koanf:"source" json:"source,omitempty"`
+	// Target is the absolute path inside the container.
+	Target   string `koanf:"target" json:"target"`
+	ReadOnly bool   `koanf:"read_only" json:"read_only,omitempty"`
+
+	// Propagation is the bind propagation mode (e.g., "rslave"). Bind only.
+	Propagation string `koanf:"propagation" json:"propagation,omitempty"`
+	// Relabel is the SELinux relabel mode: "shared" (z) or "private" (Z). Bind only.
+	Relabel string `koanf:"relabel" json:"relabel,omitempty"`
+
+	// Driver is the volume driver used if the volume has to be created. Volume only.
+	Driver string `koanf:"driver" json:"driver,omitempty"`
+	// DriverOpts are passed to the volume driver. Volume only.
+	DriverOpts map[string]string `koanf:"driver_opts" json:"driver_opts,omitempty"`
+	// NoCopy disables copying image data into a new volume. Volume only.
+	NoCopy bool `koanf:"no_copy" json:"no_copy,omitempty"`
+
+	// Size is the tmpfs size (e.g., "64m"). Tmpfs only.
+	Size string `koanf:"size" json:"size,omitempty"`
+	// Mode is the octal file mode of the tmpfs root (e.g., "1777"). Tmpfs only.
+	Mode string `koanf:"mode" json:"mode,omitempty"`
+}
+
+// Validate checks a mount definition on its own, without looking at the
+// host path allow-list.
+func (m MountConfig) Validate() error {
+	if !filepath.IsAbs(m.Target) {
+		return fmt.Errorf("target %q must be an absolute path", m.Target)
+	}
+
+	switch m.Type {
+	case MountTypeBind:
+		if !filepath.IsAbs(m.Source) {
+			return fmt.Errorf("bind source %q must be an absolute path", m.Source)
+		}
+		if m.Propagation != "" && !slices.Contains(validPropagations, m.Propagation) {
+			return fmt.Errorf("invalid propagation %q", m.Propagation)
+		}
+		if m.Relabel != "" && m.Relabel != "shared" && m.Relabel != "private" {
+			return fmt.Errorf("invalid relabel %q, must be \"shared\" or \"private\"", m.Relabel)
+		}
+	case MountTypeVolume:
+		if m.Source == "" && (m.Driver != "" || len(m.DriverOpts) > 0) {
+			return fmt.Errorf("driver options require a named volume")
+		}
+	case MountTypeTmpfs:
+		if m.Source != "" {
+			return fmt.Errorf("tmpfs mounts can't have a source")
+		}
+		if m.Size != "" {
+			if _, err := units.RAMInBytes(m.Size); err != nil {
+				return fmt.Errorf("invalid tmpfs size %q: %w", m.Size, err)
+			}
+		}
+		if m.Mode != "" {
+			if _, err := strconv.ParseUint(m.Mode, 8, 32); err != nil {
+				return fmt.Errorf("invalid tmpfs mode %q: %w", m.Mode, err)
+			}
+		}
+	case MountTypeImage:
+		if m.Source == "" {
+			return fmt.Errorf("image mounts require a source image")
+		}
+	default:
+		return fmt.Errorf("unknown mount type %q", m.Type)
+	}
+
+	if m.Type != MountTypeBind && (m.Propagation != "" || m.Relabel != "") {
+		return fmt.Errorf("propagation and relabel are only valid for bind mounts")
+	}
+	if m.Type != MountTypeVolume && (m.Driver != "" || len(m.DriverOpts) > 0 || m.NoCopy) {
+		return fmt.Errorf("driver, driver_opts and no_copy are only valid for volume mounts")
+	}
+	if m.Type != MountTypeTmpfs && (m.Size != "" || m.Mode != "") {
+		return fmt.Errorf("size and mode are only valid for tmpfs mounts")
+	}
+	return nil
+}
+
+// bindVolumeOptions are the mount options, besides bind or rbind, a local
+// volume that binds a host directory may use.
+var bindVolumeOptions = []string{"ro", "rw", "nosuid", "nodev", "noexec"}
+
+// HostSource reports whether a mount gives the container access to the host,
+// and to which host path: the source of a bind mount, or the device of a
+// local volume whose driver options bind a host directory, e.g.
+// {type: none, o: bind, device: /srv/cache}. Volumes of other drivers or with
+// other driver options, such as a block device or a network share, reach the
+// host in ways no path describes and are reported with an empty path.
+func (m MountConfig) HostSource() (string, bool) {
+	switch {
+	case m.Type == MountTypeBind:
+		return m.Source, true
+	case m.Type != MountTypeVolume:
+		return "", false
+	case m.Driver != "" && m.Driver != "local":
+		return "", true
+	case len(m.DriverOpts) == 0:
+		return "", false
+	}
+	return bindVolumeDevice(m.DriverOpts), true
+}
+
+// bindVolumeDevice returns the device of local volume driver options that
+// only bind a host directory, or "" for any other options.
+func bindVolumeDevice(opts map[string]string) string {
+	for key := range opts {
+		if key != "type" && key != "o" && key != "device" {
+			return ""
+		}
+	}
+	if opts["type"] != "" && opts["type"] != "none" {
+		return ""
+	}
+	bind := false
+	for _, opt := range strings.Split(opts["o"], ",") {
+		switch opt = strings.TrimSpace(opt); {
+		case opt == "bind" || opt == "rbind":
+			bind = true
+		case !slices.Contains(bindVolumeOptions, opt):
+			return ""
+		}
+	}
+	if !bind {
+		return ""
+	}
+	return opts["device"]
+}
+
+// rootHostPaths are host directories that give root on the host to whoever
+// can write to them, to a directory inside them or to one of their parents.
+var rootHostPaths = []string{
+	"/etc", "/root", "/boot", "/usr", "/bin", "/sbin", "/lib", "/lib64",
+	"/var/lib/docker", "/var/lib/containerd", "/var/lib/kubelet", "/proc", "/sys",
+}
+
+// GivesHostRoot reports whether a mount gives the container root on the
+// host, by the same classification as HostSource: a volume that reaches the
+// host in ways no path describes, a bind of a Docker socket of the host or of
+// /dev, even read-only, or a writable bind of a system directory.
+func (c *ProviderConfig) GivesHostRoot(m MountConfig) bool {
+	source, hostAccess := m.HostSource()
+	switch {
+	case !hostAccess:
+		return false
+	case !filepath.IsAbs(source):
+		return true
+	case c.exposesDockerSocket(source) || hostPathOverlaps(source, "/dev"):
+		return true
+	}
+	readOnly := m.ReadOnly
+	if m.Type == MountTypeVolume {
+		readOnly = readOnly || slices.Contains(strings.Split(m.DriverOpts["o"], ","), "ro")
+	}
+	if readOnly {
+		return false
+	}
+	for _, p := range rootHostPaths {
+		if hostPathOverlaps(source, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// hostPathOverlaps reports whether the host path source is sensitive, one of
+// the directories inside it or one of its parents.
+func hostPathOverlaps(source, sensitive string) bool {
+	source, sensitive = resolveHostPath(source), resolveHostPath(sensitive)
+	for _, rel := range []string{relPath(source, sensitive), relPath(sensitive, source)} {
+		if rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+// relPath is filepath.Rel, with ".." for paths it can't relate.
+func relPath(base, target string) string {
+	rel, err := filepath.Rel(base, target)
+	if err != nil {
+		return ".."
+	}
+	return filepath.ToSlash(rel)
+}
+
+// bindMount returns the mount a bind in the "source:target[:options]" form
+// stands for. Sources that aren't absolute paths are volume names.
+func bindMount(bind string) MountConfig {
+	parts := strings.SplitN(bind, ":", 3)
+	m := MountConfig{Type: MountTypeVolume, Source: parts[0]}
+	if filepath.IsAbs(parts[0]) {
+		m.Type = MountTypeBind
+	}
+	if len(parts) > 1 {
+		m.Target = parts[1]
+	}
+	if len(parts) > 2 {
+		m.ReadOnly = slices.Contains(strings.Split(parts[2], ","), "ro")
+	}
+	return m
+}
+
+// CheckMount checks a mount against allowed_host_paths and allowed_volumes.
+// Mounts from the provider config only have to be in allowed_host_paths if
+// it is set. Mounts from pool extra specs can only reach the host through
+// allowed host paths, and can only mount anonymous volumes or named volumes
+// in allowed_volumes.
+func (c *ProviderConfig) CheckMount(m MountConfig, fromExtraSpecs bool) error {
+	source, hostAccess := m.HostSource()
+	switch {
+	case !hostAccess:
+	case source == "":
+		if !fromExtraSpecs {
+			break
+		}
+		if m.Driver != "" && m.Driver != "local" {
+			return fmt.Errorf("volume driver %q is not allowed in extra specs", m.Driver)
+		}
+		return fmt.Errorf("volume driver_opts other than a bind of a host directory are not allowed in extra specs")
+	case fromExtraSpecs || len(c.AllowedHostPaths) > 0:
+		if filepath.IsAbs(source) && c.IsHostPathAllowed(source) {
+			break
+		}
+		if m.Type == MountTypeBind {
+			return fmt.Errorf("bind source %s is not in allowed_host_paths", source)
+		}
+		return fmt.Errorf("volume device %s is not in allowed_host_paths", source)
+	}
+
+	// Docker attaches an existing volume whatever driver options are given,
+	// so a pool could otherwise mount the volumes of other runners
+	if fromExtraSpecs && m.Type == MountTypeVolume && m.Source != "" && !c.IsVolumeAllowed(m.Source) {
+		return fmt.Errorf("volume %s is not in allowed_volumes", m.Source)
+	}
+	return nil
+}
+
+// IsVolumeAllowed reports whether a named volume matches one of the
+// allowed_volumes patterns.
+func (c *ProviderConfig) IsVolumeAllowed(name string) bool {
+	for _, pattern := range c.AllowedVolumes {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	volumeNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+	// validBindOptions are the access mode, SELinux label, copy, consistency
+	// and ownership options Docker accepts, and the propagation modes
+	validBindOptions = append([]string{"ro", "rw", "z", "Z", "nocopy", "consistent", "cached", "delegated", "default", "U"}, validPropagations...)
+)
+
+// ValidateBind checks a bind in the "source:target[:options]" form used by
+// Docker, where source is a host path or a volume name.
+func ValidateBind(bind string) error {
+	parts := strings.Split(bind, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return fmt.Errorf("%q must have the form source:target[:options]", bind)
+	}
+	if !filepath.IsAbs(parts[0]) && !volumeNamePattern.MatchString(parts[0]) {
+		return fmt.Errorf("source %q must be an absolute path or a volume name", parts[0])
+	}
+	if !filepath.IsAbs(parts[1]) {
+		return fmt.Errorf("target %q must be an absolute path", parts[1])
+	}
+	if len(parts) == 3 {
+		for _, opt := range strings.Split(parts[2], ",") {
+			if !slices.Contains(validBindOptions, opt) {
+				return fmt.Errorf("unknown option %q", opt)
+			}
+		}
+	}
+	return nil
+}
+
+// IsHostPathAllowed reports whether path is inside one of the allowed host
+// directories. Symlinks in path and in the allowed directories are resolved
+// first, so a link inside an allowed directory can't point outside of it.
+func (c *ProviderConfig) IsHostPathAllowed(path string) bool {
+	path = resolveHostPath(path)
+	for _, allowed := range c.AllowedHostPaths {
+		rel, err := filepath.Rel(resolveHostPath(allowed), path)
+		if err != nil {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, "../") {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveHostPath returns path with all symlinks resolved. Docker creates
+// missing bind sources, so only the longest existing parent is resolved and
+// the rest of the path is appended to it.
+func resolveHostPath(path string) string {
+	path = filepath.Clean(path)
+	missing := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(path)
+		if err == nil {
+			return filepath.Join(resolved, missing)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, missing)
+		}
+		missing = filepath.Join(filepath.Base(path), missing)
+		path = parent
+	}
+}
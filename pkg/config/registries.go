@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/distribution/reference"
+)
+
+// RegistryConfig holds the credentials and mirror for the images matching
+// a pattern.
+type RegistryConfig struct {
+	// Match is a fully qualified image prefix: a registry host such as
+	// "ghcr.io", a path ending in "/*" such as "ghcr.io/org/*", or a single
+	// repository such as "docker.io/library/ubuntu". Images on Docker Hub are
+	// matched as "docker.io/library/ubuntu" and "docker.io/org/image". If
+	// several entries match, the longest pattern wins.
+	Match string `koanf:"match"`
+	// Username and Password log in to the registry. Password may be a
+	// secret reference.
+	Username string `koanf:"username"`
+	Password Secret `koanf:"password"`
+	// Token is a bearer token sent to the registry instead of a username and
+	// password. It may be a secret reference.
+	Token Secret `koanf:"token"`
+	// Mirror replaces the matched prefix of images before they are pulled
+	// and run, e.g. "mirror.internal/dockerhub/*" for "docker.io/*". The
+	// credentials for the mirror come from the entry matching it.
+	Mirror string `koanf:"mirror"`
+}
+
+// HasCredentials reports whether the entry logs in to the registry.
+func (r RegistryConfig) HasCredentials() bool {
+	return r.Username != "" || r.Token != ""
+}
+
+// Validate checks a registries entry.
+func (r RegistryConfig) Validate() error {
+	if r.Match == "" {
+		return fmt.Errorf("match is required")
+	}
+	if err := validatePrefix(r.Match); err != nil {
+		return fmt.Errorf("match: %w", err)
+	}
+	if r.Username != "" && r.Token != "" {
+		return fmt.Errorf("username and token are mutually exclusive")
+	}
+	if (r.Username == "") != (r.Password == "") {
+		return fmt.Errorf("username and password must be set together")
+	}
+	if r.Mirror != "" {
+		if err := validatePrefix(r.Mirror); err != nil {
+			return fmt.Errorf("mirror: %w", err)
+		}
+	}
+	if !r.HasCredentials() && r.Mirror == "" {
+		return fmt.Errorf("credentials or a mirror are required")
+	}
+	return nil
+}
+
+// matchLen returns the length of the pattern if it matches the repository
+// name, or -1.
+func (r RegistryConfig) matchLen(name string) int {
+	prefix := trimWildcard(r.Match)
+	if name == prefix || strings.HasPrefix(name, prefix+"/") {
+		return len(prefix)
+	}
+	return -1
+}
+
+// validatePrefix checks that pattern is a fully qualified image prefix,
+// without a tag or digest.
+func validatePrefix(pattern string) error {
+	// A registry host alone is not a valid reference, a repository below it is
+	prefix := trimWildcard(pattern)
+	named, err := reference.ParseNormalizedNamed(prefix + "/x")
+	if err != nil || !strings.HasPrefix(prefix+"/", reference.Domain(named)+"/") {
+		return fmt.Errorf("%q is not a fully qualified image prefix, such as \"ghcr.io/org/*\"", pattern)
+	}
+	return nil
+}
+
+// trimWildcard removes the optional "/*" of an image prefix.
+func trimWildcard(pattern string) string {
+	return strings.TrimSuffix(pattern, "/*")
+}
+
+// lookupRegistry returns the entry with the longest pattern matching the
+// image, among those accepted by use, and the image's repository name and
+// tag or digest.
+func (c *ProviderConfig) lookupRegistry(image string, use func(RegistryConfig) bool) (RegistryConfig, string, string, bool) {
+	named, err := reference.ParseNormalizedNamed(image)
+	if err != nil {
+		return RegistryConfig{}, "", "", false
+	}
+	named = reference.TagNameOnly(named)
+	name := named.Name()
+	suffix := strings.TrimPrefix(named.String(), name)
+
+	best, bestLen := RegistryConfig{}, -1
+	for _, r := range c.Registries {
+		if n := r.matchLen(name); use(r) && n > bestLen {
+			best, bestLen = r, n
+		}
+	}
+	return best, name, suffix, bestLen >= 0
+}
+
+// RegistryCredentials returns the registries entry holding the credentials
+// for an image.
+func (c *ProviderConfig) RegistryCredentials(image string) (RegistryConfig, bool) {
+	r, _, _, ok := c.lookupRegistry(image, RegistryConfig.HasCredentials)
+	return r, ok
+}
+
+// MirrorImage returns the image rewritten to its mirror, or the image itself
+// if no mirror is configured for it.
+func (c *ProviderConfig) MirrorImage(image string) string {
+	r, name, suffix, ok := c.lookupRegistry(image, func(r RegistryConfig) bool { return r.Mirror != "" })
+	if !ok {
+		return image
+	}
+	rest := strings.TrimPrefix(name, trimWildcard(r.Match))
+	return trimWildcard(r.Mirror) + rest + suffix
+}
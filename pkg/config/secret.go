@@ -0,0 +1,133 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/go-viper/mapstructure/v2"
+)
+
+// Prefixes of secret references.
+const (
+	SecretRefFile = "file:"
+	SecretRefEnv  = "env:"
+	SecretRefExec = "exec:"
+	// SecretLiteral escapes a secret that starts with one of the prefixes
+	// above, e.g. "literal:env:not-a-reference".
+	SecretLiteral = "literal:"
+)
+
+// secretExecTimeout bounds an exec: secret reference.
+const secretExecTimeout = 30 * time.Second
+
+// redacted replaces secrets when they are printed, logged or marshaled.
+const redacted = "[redacted]"
+
+// Secret is a credential in the config. In the config file it is either the
+// secret itself or a reference that NewConfig resolves:
+//
+//   - "file:/run/secrets/token" reads a file, without its trailing newline
+//   - "env:REGISTRY_PASSWORD" reads an environment variable
+//   - "exec:/usr/bin/helper arg" runs a command and takes its output, without
+//     the trailing newline. The command is not run by a shell.
+//   - "literal:env:abc" is the secret "env:abc", for secrets that start with
+//     one of the prefixes above
+//
+// A Secret redacts itself when formatted, logged or marshaled. Use Value to
+// get the secret.
+type Secret string
+
+// Value returns the secret.
+func (s Secret) Value() string {
+	return string(s)
+}
+
+// String returns a placeholder instead of the secret.
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// GoString keeps the secret out of %#v.
+func (s Secret) GoString() string {
+	return fmt.Sprintf("config.Secret(%q)", s.String())
+}
+
+// MarshalText keeps the secret out of JSON, YAML and TOML.
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// LogValue keeps the secret out of logs.
+func (s Secret) LogValue() slog.Value {
+	return slog.StringValue(s.String())
+}
+
+// ResolveSecret returns the secret a config value refers to, or the value
+// itself if it is not a reference.
+func ResolveSecret(ref string) (string, error) {
+	switch {
+	case strings.HasPrefix(ref, SecretLiteral):
+		return strings.TrimPrefix(ref, SecretLiteral), nil
+	case strings.HasPrefix(ref, SecretRefFile):
+		path := strings.TrimPrefix(ref, SecretRefFile)
+		if path == "" {
+			return "", fmt.Errorf("secret reference %q has no path", ref)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret: %w", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(ref, SecretRefEnv):
+		name := strings.TrimPrefix(ref, SecretRefEnv)
+		if name == "" {
+			return "", fmt.Errorf("secret reference %q has no variable name", ref)
+		}
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("secret environment variable %s is not set", name)
+		}
+		return value, nil
+	case strings.HasPrefix(ref, SecretRefExec):
+		args := strings.Fields(strings.TrimPrefix(ref, SecretRefExec))
+		if len(args) == 0 {
+			return "", fmt.Errorf("secret reference %q has no command", ref)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), secretExecTimeout)
+		defer cancel()
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stderr = &stderr
+		out, err := cmd.Output()
+		if err != nil {
+			return "", fmt.Errorf("secret command %s failed: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimRight(string(out), "\r\n"), nil
+	}
+	return ref, nil
+}
+
+// secretHookFunc resolves secret references while the config is decoded.
+func secretHookFunc() mapstructure.DecodeHookFuncType {
+	secretType := reflect.TypeOf(Secret(""))
+	return func(from, to reflect.Type, data any) (any, error) {
+		if to != secretType || from.Kind() != reflect.String {
+			return data, nil
+		}
+		value, err := ResolveSecret(reflect.ValueOf(data).String())
+		if err != nil {
+			return nil, err
+		}
+		return Secret(value), nil
+	}
+}
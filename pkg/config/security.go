@@ -0,0 +1,269 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// dangerousCapabilities give a container enough power over the host or its
+// kernel to escape. Adding them requires allow_dangerous.
+var dangerousCapabilities = []string{
+	"ALL",
+	"SYS_ADMIN",
+	"SYS_MODULE",
+	"SYS_PTRACE",
+	"SYS_RAWIO",
+	"SYS_BOOT",
+	"DAC_READ_SEARCH",
+	"NET_ADMIN",
+	"BPF",
+	"PERFMON",
+}
+
+// SecurityConfig hardens runner containers. It can be set in the provider
+// config and tightened per pool in extra specs.
+type SecurityConfig struct {
+	// CapAdd lists capabilities to add, e.g. "NET_RAW".
+	CapAdd []string `koanf:"cap_add" json:"cap_add,omitempty"`
+	// CapDrop lists capabilities to drop, e.g. "ALL".
+	CapDrop []string `koanf:"cap_drop" json:"cap_drop,omitempty"`
+	// SeccompProfile is the path to a seccomp profile JSON file on the host
+	// running the provider, or "unconfined".
+	SeccompProfile string `koanf:"seccomp_profile" json:"seccomp_profile,omitempty"`
+	// AppArmorProfile is the name of a loaded AppArmor profile, or "unconfined".
+	AppArmorProfile string `koanf:"apparmor_profile" json:"apparmor_profile,omitempty"`
+	// NoNewPrivileges prevents processes from gaining privileges through
+	// setuid binaries.
+	NoNewPrivileges *bool `koanf:"no_new_privileges" json:"no_new_privileges,omitempty"`
+	// ReadOnlyRootfs mounts the container's root filesystem read-only.
+	ReadOnlyRootfs *bool `koanf:"read_only_rootfs" json:"read_only_rootfs,omitempty"`
+	// WritablePaths get a tmpfs mount when the root filesystem is read-only,
+	// e.g. "/tmp" and "/runner/_work".
+	WritablePaths []string `koanf:"writable_paths" json:"writable_paths,omitempty"`
+	// UsernsMode sets the user namespace mode, e.g. "host".
+	UsernsMode string `koanf:"userns_mode" json:"userns_mode,omitempty"`
+	// User is the user (and optionally group) the runner runs as, e.g. "1001:1001".
+	User string `koanf:"user" json:"user,omitempty"`
+	// AllowDangerous permits settings that weaken the container's isolation,
+	// such as adding SYS_ADMIN or disabling seccomp. It can only be set in
+	// the provider config, not per pool.
+	AllowDangerous bool `koanf:"allow_dangerous" json:"-"`
+	// SeccompProfileDir is the host directory pools may pick seccomp profiles
+	// from. If empty, pools can't set a seccomp profile path. It can only be
+	// set in the provider config.
+	SeccompProfileDir string `koanf:"seccomp_profile_dir" json:"-"`
+	// AllowedAppArmorProfiles lists the AppArmor profiles pools may pick. If
+	// empty, pools can't set an AppArmor profile. It can only be set in the
+	// provider config.
+	AllowedAppArmorProfiles []string `koanf:"allowed_apparmor_profiles" json:"-"`
+	// AllowedCapabilities lists the capabilities pools may add on top of
+	// CapAdd, e.g. "NET_RAW". If empty, pools can't add capabilities.
+	// Dangerous capabilities can't be listed. It can only be set in the
+	// provider config.
+	AllowedCapabilities []string `koanf:"allowed_capabilities" json:"-"`
+	// AllowedUsernsModes lists the user namespace modes pools may pick
+	// instead of UsernsMode. If empty, pools can't change it. It can only be
+	// set in the provider config.
+	AllowedUsernsModes []string `koanf:"allowed_userns_modes" json:"-"`
+}
+
+// Merge returns the settings with the non-empty fields of override applied
+// on top. Capabilities and writable paths are added to the configured ones
+// instead of replacing them. AllowDangerous, SeccompProfileDir and the
+// allow-lists for pools are never taken from override. CheckOverride rejects
+// overrides that would weaken the settings.
+func (s SecurityConfig) Merge(override SecurityConfig) SecurityConfig {
+	merged := s
+	merged.CapAdd = union(s.CapAdd, override.CapAdd, NormalizeCapability)
+	merged.CapDrop = union(s.CapDrop, override.CapDrop, NormalizeCapability)
+	merged.WritablePaths = union(s.WritablePaths, override.WritablePaths, filepath.Clean)
+	if override.SeccompProfile != "" {
+		merged.SeccompProfile = override.SeccompProfile
+	}
+	if override.AppArmorProfile != "" {
+		merged.AppArmorProfile = override.AppArmorProfile
+	}
+	if override.NoNewPrivileges != nil {
+		merged.NoNewPrivileges = override.NoNewPrivileges
+	}
+	if override.ReadOnlyRootfs != nil {
+		merged.ReadOnlyRootfs = override.ReadOnlyRootfs
+	}
+	if override.UsernsMode != "" {
+		merged.UsernsMode = override.UsernsMode
+	}
+	if override.User != "" {
+		merged.User = override.User
+	}
+	return merged
+}
+
+// CheckOverride rejects pool settings that would weaken the baseline:
+// dangerous settings, even if the baseline allows them for itself, adding
+// capabilities the baseline drops or that are not in AllowedCapabilities,
+// turning off no_new_privileges or read_only_rootfs, user namespace modes
+// not in AllowedUsernsModes, running as root instead of a configured user,
+// seccomp profiles outside SeccompProfileDir and AppArmor profiles not in
+// AllowedAppArmorProfiles.
+func (s SecurityConfig) CheckOverride(override SecurityConfig, mode DinDMode) error {
+	// allow_dangerous is for the operator's own settings, not for pools
+	probe := override
+	if probe.UsernsMode == "" && len(override.CapAdd) > 0 {
+		probe.UsernsMode = s.UsernsMode
+	}
+	if err := probe.checkDangerous(mode); err != nil {
+		return fmt.Errorf("%w and can only be set in the provider config", err)
+	}
+	for _, c := range override.CapAdd {
+		c = NormalizeCapability(c)
+		if slices.ContainsFunc(s.CapAdd, func(a string) bool { return NormalizeCapability(a) == c }) {
+			continue
+		}
+		for _, dropped := range s.CapDrop {
+			if dropped = NormalizeCapability(dropped); dropped == c || dropped == "ALL" {
+				return fmt.Errorf("capability %s is dropped in the provider config and can't be added", c)
+			}
+		}
+		if !slices.ContainsFunc(s.AllowedCapabilities, func(a string) bool { return NormalizeCapability(a) == c }) {
+			return fmt.Errorf("capability %s is not in allowed_capabilities of the provider config", c)
+		}
+	}
+	if override.AppArmorProfile != "" && !slices.Contains(s.AllowedAppArmorProfiles, override.AppArmorProfile) {
+		return fmt.Errorf("apparmor_profile %q is not in allowed_apparmor_profiles of the provider config", override.AppArmorProfile)
+	}
+	if s.NoNewPrivileges != nil && *s.NoNewPrivileges && override.NoNewPrivileges != nil && !*override.NoNewPrivileges {
+		return fmt.Errorf("no_new_privileges is enabled in the provider config and can't be turned off")
+	}
+	if s.IsReadOnlyRootfs() && override.ReadOnlyRootfs != nil && !*override.ReadOnlyRootfs {
+		return fmt.Errorf("read_only_rootfs is enabled in the provider config and can't be turned off")
+	}
+	// An empty userns_mode uses the daemon's userns-remap, so setting one is
+	// a change too
+	if override.UsernsMode != "" && override.UsernsMode != s.UsernsMode && !slices.Contains(s.AllowedUsernsModes, override.UsernsMode) {
+		return fmt.Errorf("userns_mode %q is not in allowed_userns_modes of the provider config", override.UsernsMode)
+	}
+	if s.User != "" && !isRootUser(s.User) && override.User != "" && isRootUser(override.User) {
+		return fmt.Errorf("user %q runs as root, but the provider config sets user %q", override.User, s.User)
+	}
+	if override.SeccompProfile != "" && override.SeccompProfile != "unconfined" {
+		if s.SeccompProfileDir == "" {
+			return fmt.Errorf("seccomp_profile paths require security.seccomp_profile_dir in the provider config")
+		}
+		if !filepath.IsAbs(override.SeccompProfile) {
+			return fmt.Errorf("seccomp_profile %q must be an absolute path or \"unconfined\"", override.SeccompProfile)
+		}
+		// Resolve symlinks, so that a link in the directory can't point
+		// outside of it
+		profile, err := filepath.EvalSymlinks(override.SeccompProfile)
+		if err != nil {
+			return fmt.Errorf("seccomp_profile: %w", err)
+		}
+		dir, err := filepath.EvalSymlinks(s.SeccompProfileDir)
+		if err != nil {
+			return fmt.Errorf("seccomp_profile_dir: %w", err)
+		}
+		if rel, err := filepath.Rel(dir, profile); err != nil || rel == ".." || strings.HasPrefix(rel, "../") {
+			return fmt.Errorf("seccomp_profile %q is not in seccomp_profile_dir %s", override.SeccompProfile, s.SeccompProfileDir)
+		}
+	}
+	return nil
+}
+
+// isRootUser reports whether a "user[:group]" spec runs as root.
+func isRootUser(user string) bool {
+	name, _, _ := strings.Cut(user, ":")
+	return name == "0" || name == "root"
+}
+
+// union returns the values of a followed by those of b that a doesn't
+// contain, compared after normalizing them with norm.
+func union(a, b []string, norm func(string) string) []string {
+	if b == nil {
+		return a
+	}
+	merged := slices.Clone(a)
+	for _, v := range b {
+		if !slices.ContainsFunc(merged, func(m string) bool { return norm(m) == norm(v) }) {
+			merged = append(merged, v)
+		}
+	}
+	return merged
+}
+
+// Validate checks the settings against each other and the Docker-in-Docker
+// mode they are used with, and rejects dangerous settings unless
+// AllowDangerous is set.
+func (s SecurityConfig) Validate(mode DinDMode) error {
+	if s.SeccompProfile != "" && s.SeccompProfile != "unconfined" {
+		if !filepath.IsAbs(s.SeccompProfile) {
+			return fmt.Errorf("seccomp_profile %q must be an absolute path or \"unconfined\"", s.SeccompProfile)
+		}
+		if _, err := os.Stat(s.SeccompProfile); err != nil {
+			return fmt.Errorf("seccomp_profile: %w", err)
+		}
+	}
+	for _, p := range s.WritablePaths {
+		if !filepath.IsAbs(p) {
+			return fmt.Errorf("writable_paths: %q is not an absolute path", p)
+		}
+	}
+	if len(s.WritablePaths) > 0 && !s.IsReadOnlyRootfs() {
+		return fmt.Errorf("writable_paths requires read_only_rootfs")
+	}
+	if s.SeccompProfileDir != "" && !filepath.IsAbs(s.SeccompProfileDir) {
+		return fmt.Errorf("seccomp_profile_dir %q must be an absolute path", s.SeccompProfileDir)
+	}
+	for _, c := range s.AllowedCapabilities {
+		if slices.Contains(dangerousCapabilities, NormalizeCapability(c)) {
+			return fmt.Errorf("allowed_capabilities: adding capability %s is dangerous and can't be allowed for pools", NormalizeCapability(c))
+		}
+	}
+
+	switch mode {
+	case DinDModePrivileged:
+		if len(s.CapAdd) > 0 || len(s.CapDrop) > 0 || s.SeccompProfile != "" || s.AppArmorProfile != "" {
+			return fmt.Errorf("capabilities, seccomp and apparmor settings have no effect with dind_mode %q", mode)
+		}
+	case DinDModeRootless:
+		if s.SeccompProfile != "" || s.AppArmorProfile != "" {
+			return fmt.Errorf("seccomp and apparmor profiles can't be set with dind_mode %q, it runs unconfined", mode)
+		}
+	}
+
+	if s.AllowDangerous {
+		return nil
+	}
+	if err := s.checkDangerous(mode); err != nil {
+		return fmt.Errorf("%w, set security.allow_dangerous to allow it", err)
+	}
+	return nil
+}
+
+// checkDangerous rejects settings that weaken the container's isolation.
+func (s SecurityConfig) checkDangerous(mode DinDMode) error {
+	for _, c := range s.CapAdd {
+		if slices.Contains(dangerousCapabilities, NormalizeCapability(c)) {
+			return fmt.Errorf("adding capability %s is dangerous, set security.allow_dangerous to allow it", NormalizeCapability(c))
+		}
+	}
+	if s.SeccompProfile == "unconfined" || s.AppArmorProfile == "unconfined" {
+		return fmt.Errorf("disabling seccomp or apparmor is dangerous")
+	}
+	if s.UsernsMode == "host" && (mode == DinDModePrivileged || len(s.CapAdd) > 0) {
+		return fmt.Errorf("userns_mode \"host\" with privileges or added capabilities is dangerous")
+	}
+	return nil
+}
+
+// IsReadOnlyRootfs reports whether the root filesystem is read-only.
+func (s SecurityConfig) IsReadOnlyRootfs() bool {
+	return s.ReadOnlyRootfs != nil && *s.ReadOnlyRootfs
+}
+
+// NormalizeCapability turns "cap_sys_admin" into "SYS_ADMIN".
+func NormalizeCapability(c string) string {
+	return strings.TrimPrefix(strings.ToUpper(c), "CAP_")
+}
@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Trace samplers, as in the OTEL_TRACES_SAMPLER environment variable.
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIDRatio            = "traceidratio"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIDRatio = "parentbased_traceidratio"
+)
+
+// TracingConfig exports OpenTelemetry traces of provider commands and the
+// Docker API calls they make. Tracing is disabled unless Endpoint is set.
+type TracingConfig struct {
+	// Endpoint is the URL of an OTLP/HTTP receiver, e.g.
+	// "http://otel-collector:4318". "/v1/traces" is appended unless the URL
+	// has a path.
+	Endpoint string `koanf:"endpoint"`
+	// Headers are added to export requests, e.g. for authentication. Values
+	// may be secret references.
+	Headers map[string]Secret `koanf:"headers"`
+	// Sampler is one of the OTEL_TRACES_SAMPLER values "always_on",
+	// "always_off", "traceidratio", "parentbased_always_on",
+	// "parentbased_always_off" or "parentbased_traceidratio". Defaults to
+	// "parentbased_always_on", which follows the sampling decision of a
+	// parent passed in TRACEPARENT.
+	Sampler string `koanf:"sampler"`
+	// SamplerRatio is the fraction of traces sampled by the ratio samplers.
+	SamplerRatio float64 `koanf:"sampler_ratio"`
+	// ServiceName is the service.name resource attribute. Defaults to
+	// "garm-provider-docker".
+	ServiceName string `koanf:"service_name"`
+	// Timeout for exporting spans when the provider exits. Defaults to 5s.
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// Enabled reports whether traces are exported.
+func (c TracingConfig) Enabled() bool {
+	return c.Endpoint != ""
+}
+
+// Validate checks the tracing settings.
+func (c TracingConfig) Validate() error {
+	if c.Endpoint != "" {
+		u, err := url.Parse(c.Endpoint)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("endpoint %q must be an http or https URL", c.Endpoint)
+		}
+	}
+	switch c.Sampler {
+	case "", SamplerAlwaysOn, SamplerAlwaysOff, SamplerParentBasedAlwaysOn, SamplerParentBasedAlwaysOff:
+	case SamplerTraceIDRatio, SamplerParentBasedTraceIDRatio:
+		if c.SamplerRatio <= 0 || c.SamplerRatio > 1 {
+			return fmt.Errorf("sampler %q requires a sampler_ratio greater than 0 and at most 1", c.Sampler)
+		}
+	default:
+		return fmt.Errorf("unknown sampler %q", c.Sampler)
+	}
+	if c.Timeout < 0 {
+		return fmt.Errorf("timeout can't be negative")
+	}
+	return nil
+}